@@ -1,26 +1,35 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/bevelgacom/wapipedia/pkg/wikipedia"
 	"github.com/spf13/cobra"
 )
 
 var (
-	downloadLang string
-	downloadDest string
+	downloadLang    string
+	downloadDest    string
+	downloadTimeout int
+	downloadForce   bool
+	downloadTries   int
 )
 
 var downloadCmd = &cobra.Command{
 	Use:   "download",
 	Short: "Download Wikipedia dump files",
 	Long: `Download Wikipedia dump files from the Kiwix repository.
-Various language editions and sizes are available.`,
+Various language editions and sizes are available.
+
+Besides the shortcuts shown by 'wapipedia list', -lang accepts the full URL of
+any ZIM file, e.g. another language, a different date or Wiktionary.`,
 	Example: `  wapipedia download -lang simple -dest ./data
   wapipedia download -lang en -dest ./data
-  wapipedia download -lang top100 -dest ./data`,
+  wapipedia download -lang top100 -dest ./data
+  wapipedia download -lang https://download.kiwix.org/zim/wikipedia/wikipedia_nl_all_nopic_2025-11.zim`,
 	Run: func(cmd *cobra.Command, args []string) {
 		runDownload()
 	},
@@ -29,26 +38,26 @@ Various language editions and sizes are available.`,
 func init() {
 	rootCmd.AddCommand(downloadCmd)
 
-	downloadCmd.Flags().StringVarP(&downloadLang, "lang", "l", "simple", "Language/dump to download (simple, en, nl, fr, de, es, top100)")
+	downloadCmd.Flags().StringVarP(&downloadLang, "lang", "l", "simple", "Language/dump to download (see 'wapipedia list'), or the URL of a ZIM file")
 	downloadCmd.Flags().StringVarP(&downloadDest, "dest", "d", "./data", "Destination directory for download")
+	downloadCmd.Flags().BoolVar(&downloadForce, "force", false, "Download even if the dump looks larger than the free disk space")
+	downloadCmd.Flags().IntVar(&downloadTries, "attempts", wikipedia.DefaultDownloadAttempts, "Times in a row the download may fail before giving up, resuming where it stopped in between")
+	downloadCmd.Flags().IntVar(&downloadTimeout, "timeout", int(wikipedia.DefaultDownloadTimeout/time.Second), "Seconds to wait for the mirror to connect, answer or send more data (0 to wait forever)")
 }
 
 func runDownload() {
-	fmt.Printf("Downloading Wikipedia dump '%s' to %s...\n", downloadLang, downloadDest)
+	wikipedia.SetDownloadTimeout(time.Duration(downloadTimeout) * time.Second)
+	wikipedia.SetCheckDiskSpace(!downloadForce)
+	wikipedia.SetDownloadAttempts(downloadTries)
 
-	path, err := wikipedia.DownloadDump(downloadLang, downloadDest, func(progress wikipedia.DownloadProgress) {
-		if progress.TotalBytes > 0 {
-			fmt.Printf("\rDownloading: %.1f%% (%d MB / %d MB)",
-				progress.Percentage,
-				progress.DownloadedBytes/(1024*1024),
-				progress.TotalBytes/(1024*1024))
-		} else {
-			fmt.Printf("\rDownloaded: %d MB", progress.DownloadedBytes/(1024*1024))
-		}
-	})
+	fmt.Printf("Downloading Wikipedia dump '%s' to %s...\n", downloadLang, downloadDest)
 
+	path, err := wikipedia.DownloadDump(downloadLang, downloadDest, printDownloadProgress)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+		if errors.Is(err, wikipedia.ErrInsufficientDiskSpace) {
+			fmt.Fprintln(os.Stderr, "Free up space, or use --force if the free space is misreported.")
+		}
 		os.Exit(1)
 	}
 
@@ -56,3 +65,21 @@ func runDownload() {
 	fmt.Printf("\nTo use this dump, run:\n  WAPIPEDIA_ZIM=%s wapipedia serve\n", path)
 	fmt.Printf("Or:\n  wapipedia serve -zim %s\n", path)
 }
+
+// printDownloadProgress shows download progress on a single terminal line
+func printDownloadProgress(progress wikipedia.DownloadProgress) {
+	rate := progress.BytesPerSecond / (1024 * 1024)
+	if progress.TotalBytes > 0 {
+		eta := "unknown"
+		if progress.ETA > 0 {
+			eta = progress.ETA.Round(time.Second).String()
+		}
+		fmt.Printf("\rDownloading: %.1f%% (%d MB / %d MB, %.1f MB/s, ETA %s)   ",
+			progress.Percentage,
+			progress.DownloadedBytes/(1024*1024),
+			progress.TotalBytes/(1024*1024),
+			rate, eta)
+	} else {
+		fmt.Printf("\rDownloaded: %d MB (%.1f MB/s)   ", progress.DownloadedBytes/(1024*1024), rate)
+	}
+}
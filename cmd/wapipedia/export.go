@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bevelgacom/wapipedia/pkg/wikipedia"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportZimPath  string
+	exportIDs      string
+	exportAll      bool
+	exportLimit    int
+	exportOutDir   string
+	exportDeckSize int
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export articles as static WML files",
+	Long: `Export articles as static WML decks that any web server can serve, for
+devices that should work without wapipedia or the ZIM file.
+
+The articles named with --ids, or with --all the first --limit articles, are
+split into pages of at most --deck-size bytes. Page N of an article is written
+as <id>-<N>.wml, and index.wml lists all articles by title. Links between
+exported articles lead to their decks, links to other articles are reduced to
+their text and images are left out.
+
+The web server must serve .wml files as text/vnd.wap.wml.`,
+	Example: `  wapipedia export -z ./data/wikipedia.zim --ids 1,2,3 --out ./wml
+  wapipedia export -z ./data/wikipedia.zim --all --limit 500 --out ./wml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runExport()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	defaultZim := os.Getenv("WAPIPEDIA_ZIM")
+	if defaultZim == "" {
+		defaultZim = "./data/wikipedia.zim"
+	}
+
+	exportCmd.Flags().StringVarP(&exportZimPath, "zim", "z", defaultZim, "Path to Wikipedia ZIM file")
+	exportCmd.Flags().StringVar(&exportIDs, "ids", "", "Comma separated IDs of the articles to export")
+	exportCmd.Flags().BoolVar(&exportAll, "all", false, "Export the first --limit articles instead of --ids")
+	exportCmd.Flags().IntVar(&exportLimit, "limit", wikipedia.DefaultExportLimit, "Number of articles to export with --all")
+	exportCmd.Flags().StringVarP(&exportOutDir, "out", "o", "./wml", "Directory to write the WML files to")
+	exportCmd.Flags().IntVar(&exportDeckSize, "deck-size", wikipedia.DefaultExportDeckSize, "Largest deck in bytes")
+	exportCmd.MarkFlagsMutuallyExclusive("ids", "all")
+	exportCmd.MarkFlagsOneRequired("ids", "all")
+}
+
+func runExport() {
+	// Check if ZIM file exists
+	if _, err := os.Stat(exportZimPath); os.IsNotExist(err) {
+		log.Fatalf("ZIM file not found: %s", exportZimPath)
+	}
+
+	if exportLimit < 1 {
+		log.Fatalf("Invalid --limit %d: must be at least 1", exportLimit)
+	}
+	if exportDeckSize < 1 {
+		log.Fatalf("Invalid --deck-size %d: must be at least 1", exportDeckSize)
+	}
+
+	var ids []uint32
+	for _, s := range strings.Split(exportIDs, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			log.Fatalf("Invalid article ID %q in --ids", s)
+		}
+		ids = append(ids, uint32(id))
+	}
+	if !exportAll && len(ids) == 0 {
+		log.Fatalf("No article IDs in --ids")
+	}
+
+	w, err := wikipedia.NewWikipedia(exportZimPath)
+	if err != nil {
+		log.Fatalf("Failed to open ZIM file: %v", err)
+	}
+	defer w.Close()
+
+	startTime := time.Now()
+
+	report, err := w.ExportWML(context.Background(), exportOutDir, wikipedia.ExportOptions{
+		IDs:         ids,
+		All:         exportAll,
+		Limit:       exportLimit,
+		MaxDeckSize: exportDeckSize,
+	})
+	if err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+
+	fmt.Printf("\nExported to %s in %s\n", exportOutDir, time.Since(startTime).Round(time.Second))
+	fmt.Printf("  Articles: %d\n", report.Articles)
+	fmt.Printf("  Decks:    %d\n", report.Decks)
+	if len(report.Skipped) > 0 {
+		fmt.Printf("\nSkipped %d articles:\n", len(report.Skipped))
+		for _, skipped := range report.Skipped {
+			fmt.Printf("  %s\n", skipped)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/bevelgacom/wapipedia/pkg/wikipedia"
+	"github.com/spf13/cobra"
+)
+
+var (
+	getZimPath   string
+	getIndexPath string
+	getTitle     string
+	getID        uint32
+	getRawHTML   bool
+	getTables    bool
+	getFollow    bool
+	getText      bool
+)
+
+var getCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Print an article as WML",
+	Long: `Load an article from a ZIM file and print its rendered WML to stdout.
+Useful for reproducing HTML to WML conversion bugs without a WAP browser.
+
+The article is looked up by exact title, or by URL if no title matches.
+With --index the search index is loaded too and the best search hit is
+used when neither matches.`,
+	Example: `  wapipedia get -z ./data/wikipedia.zim --title "Amsterdam"
+  wapipedia get -z ./data/wikipedia.zim --id 1234 --tables
+  wapipedia get -z ./data/wikipedia.zim --title "Amsterdam" --text
+  wapipedia get -z ./data/wikipedia.zim --title "Amsterdam" --raw-html > amsterdam.html`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("title") && !cmd.Flags().Changed("id") {
+			log.Fatal("Either --title or --id is required")
+		}
+		runGet()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+
+	defaultZim := os.Getenv("WAPIPEDIA_ZIM")
+	if defaultZim == "" {
+		defaultZim = "./data/wikipedia.zim"
+	}
+
+	getCmd.Flags().StringVarP(&getZimPath, "zim", "z", defaultZim, "Path to Wikipedia ZIM file")
+	getCmd.Flags().StringVarP(&getIndexPath, "index", "i", "", "Path to search index used to resolve --title (default: not loaded)")
+	getCmd.Flags().StringVarP(&getTitle, "title", "t", "", "Title of the article")
+	getCmd.Flags().Uint32Var(&getID, "id", 0, "Directory index of the article")
+	getCmd.Flags().BoolVar(&getRawHTML, "raw-html", false, "Print the original HTML from the ZIM file instead of WML")
+	getCmd.Flags().BoolVar(&getTables, "tables", false, "Render tables as WML tables, as for devices that support them")
+	getCmd.Flags().BoolVar(&getText, "text", false, "Print the article as plain text instead of WML")
+	getCmd.Flags().BoolVar(&getFollow, "follow-redirects", false, "Print the article an HTML redirect page points at instead of the redirect page")
+	getCmd.MarkFlagsMutuallyExclusive("title", "id")
+	getCmd.MarkFlagsMutuallyExclusive("raw-html", "text")
+}
+
+func runGet() {
+	if _, err := os.Stat(getZimPath); os.IsNotExist(err) {
+		log.Fatalf("ZIM file not found: %s", getZimPath)
+	}
+
+	var w *wikipedia.Wikipedia
+	var err error
+	if getIndexPath != "" {
+		// A one-off lookup can't wait for an index to be built in memory
+		wikipedia.SetInMemoryIndexLimit(0)
+		w, err = wikipedia.NewWikipediaWithIndex(getZimPath, getIndexPath)
+	} else {
+		w, err = wikipedia.NewWikipedia(getZimPath)
+	}
+	if err != nil {
+		log.Fatalf("Failed to open ZIM file: %v", err)
+	}
+	defer w.Close()
+
+	idx := getID
+	if getTitle != "" {
+		idx, err = w.FindArticleByTitle(getTitle)
+		if err != nil && getIndexPath != "" {
+			results, searchErr := w.Search(context.Background(), getTitle, 1)
+			if searchErr == nil && len(results) > 0 {
+				log.Printf("No exact match for %q, using search result %q", getTitle, results[0].Title)
+				idx, err = results[0].Index, nil
+			}
+		}
+		if err != nil {
+			log.Fatalf("Article %q not found", getTitle)
+		}
+	}
+
+	if getRawHTML {
+		html, err := w.GetRawHTML(idx)
+		if err != nil {
+			log.Fatalf("Failed to read article %d: %v", idx, err)
+		}
+		fmt.Print(html)
+		return
+	}
+
+	opts := wikipedia.RenderOptions{SupportsTables: getTables, SupportsImages: true, FollowRedirects: getFollow}
+	format := "WML"
+	if getText {
+		opts = wikipedia.RenderOptions{Mode: wikipedia.RenderPlainText, FollowRedirects: getFollow}
+		format = "text"
+	}
+	article, err := w.GetArticleWithOptions(context.Background(), idx, opts)
+	if err != nil {
+		log.Fatalf("Failed to render article %d: %v", idx, err)
+	}
+	log.Printf("Article %d: %s (%d bytes of %s)", article.Index, article.Title, len(article.Content), format)
+	if article.RedirectTarget != "" {
+		log.Printf("Article %d is an HTML redirect to %s", article.Index, article.RedirectTarget)
+	}
+	fmt.Println(article.Content)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"runtime"
 	"time"
 
 	"github.com/bevelgacom/wapipedia/pkg/wikipedia"
@@ -13,6 +14,10 @@ import (
 var (
 	indexZimPath    string
 	indexOutputPath string
+	indexFullText   bool
+	indexWorkers    int
+	indexBatchSize  int
+	indexRedirects  bool
 )
 
 var indexCmd = &cobra.Command{
@@ -21,9 +26,22 @@ var indexCmd = &cobra.Command{
 	Long: `Build a persistent Bluge search index from a Wikipedia ZIM file.
 The index enables fast search queries without loading the entire ZIM into memory.
 
-The index is stored next to the ZIM file with a .bluge extension by default.`,
+The index is stored next to the ZIM file with a .bluge extension by default.
+
+By default only article titles are indexed. With --full-text the article body
+text is indexed too, so searches also find words that only appear in articles
+and search results show a snippet of the matching text.
+This reads and converts every article, so indexing takes much longer and the
+index grows substantially (often several times the size of a title-only index).
+
+With --index-redirects the titles of redirect entries are indexed too, so
+alternate spellings and aliases find the article they redirect to. This adds
+one document per redirect, which can be more than the number of articles.`,
 	Example: `  wapipedia index -z ./data/wikipedia.zim
-  wapipedia index -z ./data/wikipedia.zim -o ./data/wikipedia.bluge`,
+  wapipedia index -z ./data/wikipedia.zim -o ./data/wikipedia.bluge
+  wapipedia index -z ./data/wikipedia.zim --full-text
+  wapipedia index -z ./data/wikipedia.zim --index-redirects
+  wapipedia index -z ./data/wikipedia.zim --workers 2 --batch-size 1000  # low memory`,
 	Run: func(cmd *cobra.Command, args []string) {
 		runIndex()
 	},
@@ -39,6 +57,10 @@ func init() {
 
 	indexCmd.Flags().StringVarP(&indexZimPath, "zim", "z", defaultZim, "Path to Wikipedia ZIM file")
 	indexCmd.Flags().StringVarP(&indexOutputPath, "output", "o", "", "Output path for index (default: ZIM path with .bluge extension)")
+	indexCmd.Flags().BoolVar(&indexFullText, "full-text", false, "Also index article body text (much larger index, slower to build)")
+	indexCmd.Flags().IntVar(&indexWorkers, "workers", runtime.NumCPU(), "Number of indexing workers")
+	indexCmd.Flags().BoolVar(&indexRedirects, "index-redirects", false, "Also index redirect titles, pointing at their target article (larger index)")
+	indexCmd.Flags().IntVar(&indexBatchSize, "batch-size", wikipedia.DefaultIndexBatchSize, "Documents per index write (lower uses less memory)")
 }
 
 func runIndex() {
@@ -47,6 +69,13 @@ func runIndex() {
 		log.Fatalf("ZIM file not found: %s", indexZimPath)
 	}
 
+	if indexWorkers < 1 || indexWorkers > 256 {
+		log.Fatalf("Invalid --workers %d: must be between 1 and 256", indexWorkers)
+	}
+	if indexBatchSize < 100 || indexBatchSize > 1000000 {
+		log.Fatalf("Invalid --batch-size %d: must be between 100 and 1000000", indexBatchSize)
+	}
+
 	// Determine output path
 	outputPath := indexOutputPath
 	if outputPath == "" {
@@ -54,13 +83,22 @@ func runIndex() {
 	}
 
 	fmt.Printf("Building search index...\n")
-	fmt.Printf("  ZIM file: %s\n", indexZimPath)
-	fmt.Printf("  Output:   %s\n", outputPath)
+	fmt.Printf("  ZIM file:  %s\n", indexZimPath)
+	fmt.Printf("  Output:    %s\n", outputPath)
+	fmt.Printf("  Full text: %v\n", indexFullText)
+	fmt.Printf("  Redirects: %v\n", indexRedirects)
+	fmt.Printf("  Workers:   %d\n", indexWorkers)
+	fmt.Printf("  Batch:     %d\n", indexBatchSize)
 	fmt.Println()
 
 	startTime := time.Now()
 
-	if err := wikipedia.BuildBlugeIndex(indexZimPath, outputPath); err != nil {
+	if err := wikipedia.BuildBlugeIndex(indexZimPath, outputPath, wikipedia.IndexOptions{
+		FullText:  indexFullText,
+		Workers:   indexWorkers,
+		BatchSize: indexBatchSize,
+		Redirects: indexRedirects,
+	}); err != nil {
 		log.Fatalf("Failed to build index: %v", err)
 	}
 
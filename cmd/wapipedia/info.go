@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/bevelgacom/wapipedia/pkg/wikipedia"
+	"github.com/spf13/cobra"
+)
+
+// maxInfoValueLength is the number of characters of a metadata value info prints
+const maxInfoValueLength = 70
+
+var (
+	infoZimPath    string
+	infoFull       bool
+	infoSampleSize int
+)
+
+var infoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show what a ZIM file is made of",
+	Long: `Show the header, MIME types, cluster compression and metadata of a ZIM file.
+
+The compression of a sample of the clusters, spread over the whole file, is
+counted from their info bytes. With --full every cluster is counted, which
+takes one read per cluster. Metadata values that are not text, such as the
+illustrations, are shown by their MIME type and size.`,
+	Example: `  wapipedia info -z ./data/wikipedia.zim
+  wapipedia info -z ./data/wikipedia.zim --full`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runInfo()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(infoCmd)
+
+	defaultZim := os.Getenv("WAPIPEDIA_ZIM")
+	if defaultZim == "" {
+		defaultZim = "./data/wikipedia.zim"
+	}
+
+	infoCmd.Flags().StringVarP(&infoZimPath, "zim", "z", defaultZim, "Path to Wikipedia ZIM file")
+	infoCmd.Flags().BoolVar(&infoFull, "full", false, "Count the compression of every cluster instead of a sample")
+	infoCmd.Flags().IntVar(&infoSampleSize, "sample", wikipedia.DefaultInspectSampleSize, "Number of clusters to count without --full")
+}
+
+func runInfo() {
+	// Check if ZIM file exists
+	if _, err := os.Stat(infoZimPath); os.IsNotExist(err) {
+		log.Fatalf("ZIM file not found: %s", infoZimPath)
+	}
+
+	if infoSampleSize < 1 {
+		log.Fatalf("Invalid --sample %d: must be at least 1", infoSampleSize)
+	}
+
+	report, err := wikipedia.InspectZIM(infoZimPath, wikipedia.InspectOptions{
+		Full:       infoFull,
+		SampleSize: infoSampleSize,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open ZIM file: %v", err)
+	}
+
+	mainPage := report.MainPage
+	if mainPage == "" {
+		mainPage = "(none)"
+	}
+
+	fmt.Printf("\n%s\n", infoZimPath)
+	fmt.Printf("  Version:   %d.%d\n", report.MajorVersion, report.MinorVersion)
+	fmt.Printf("  UUID:      %s\n", report.UUID)
+	fmt.Printf("  Entries:   %d\n", report.ArticleCount)
+	fmt.Printf("  Clusters:  %d\n", report.ClusterCount)
+	fmt.Printf("  Main page: %s\n", mainPage)
+
+	fmt.Printf("\nMIME types:\n")
+	for i, mimeType := range report.MIMETypes {
+		fmt.Printf("  %3d  %s\n", i, mimeType)
+	}
+
+	fmt.Printf("\nCompression (%d of %d clusters):\n", report.ClustersSampled, report.ClusterCount)
+	for _, c := range report.Compression {
+		fmt.Printf("  %d %-12s %8d  %5.1f%%\n", c.Type, c.Name, c.Clusters, float64(c.Clusters)*100/float64(report.ClustersSampled))
+	}
+	if report.ExtendedClusters > 0 {
+		fmt.Printf("  %d with 8-byte blob offsets\n", report.ExtendedClusters)
+	}
+
+	fmt.Printf("\nMetadata:\n")
+	if len(report.Metadata) == 0 && report.MetadataError == nil {
+		fmt.Println("  (none)")
+	}
+	for _, meta := range report.Metadata {
+		value := strings.Join(strings.Fields(meta.Value), " ")
+		if value == "" {
+			value = fmt.Sprintf("(%s, %d bytes)", meta.MIMEType, meta.Size)
+		} else if runes := []rune(value); len(runes) > maxInfoValueLength {
+			value = string(runes[:maxInfoValueLength]) + "..."
+		}
+		fmt.Printf("  %-16s %s\n", meta.Key, value)
+	}
+	if report.MetadataError != nil {
+		fmt.Printf("  Error: %v\n", report.MetadataError)
+	}
+}
@@ -28,6 +28,7 @@ func runList() {
 	}
 	fmt.Println()
 	fmt.Println("Use 'wapipedia download -lang <name>' to download a dump.")
+	fmt.Println("Any other ZIM file can be downloaded by URL: 'wapipedia download -lang https://.../file.zim'.")
 	fmt.Println()
 	fmt.Println("Note: The 'simple' and 'top100' dumps are small and good for testing.")
 	fmt.Println("Full language dumps (en, nl, fr, etc.) can be very large (10-90 GB).")
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/bevelgacom/wapipedia/pkg/wikipedia"
+	"github.com/spf13/cobra"
+)
+
+var (
+	searchZimPath   string
+	searchIndexPath string
+	searchQuery     string
+	searchLimit     int
+	searchAnd       bool
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Query the search index",
+	Long: `Run a query against the Bluge search index of a ZIM file and print the
+ranked results with their index, title, URL and score.
+Uses the same search as the server, so ranking issues can be reproduced
+from the terminal.
+
+Words in double quotes must appear together in that order, in the title or,
+with a full-text index, in the body. Words outside quotes match as usual and
+rank results higher. Quote the query for the shell, e.g. -q '"new york" pizza'.
+
+A query starting with + (or run with --and) only finds articles with every
+word in their title, unless there are none: then any word matches as usual.`,
+	Example: `  wapipedia search -z ./data/wikipedia.zim -q "amsterdam"
+  wapipedia search -z ./data/wikipedia.zim -q "eiffel tower" -n 50
+  wapipedia search -z ./data/wikipedia.zim -q '"new york"'         # phrase
+  wapipedia search -z ./data/wikipedia.zim -q "new york" --and     # all words in the title`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runSearch()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+
+	defaultZim := os.Getenv("WAPIPEDIA_ZIM")
+	if defaultZim == "" {
+		defaultZim = "./data/wikipedia.zim"
+	}
+
+	searchCmd.Flags().StringVarP(&searchZimPath, "zim", "z", defaultZim, "Path to Wikipedia ZIM file the index belongs to")
+	searchCmd.Flags().StringVarP(&searchIndexPath, "index", "i", "", "Path to search index (default: ZIM path with .bluge extension)")
+	searchCmd.Flags().StringVarP(&searchQuery, "query", "q", "", "Search query")
+	searchCmd.Flags().IntVarP(&searchLimit, "limit", "n", 20, "Maximum number of results")
+	searchCmd.Flags().BoolVar(&searchAnd, "and", false, "Only find articles with every word of the query in their title, like a query starting with +")
+	searchCmd.MarkFlagRequired("query")
+}
+
+func runSearch() {
+	if searchLimit < 1 {
+		log.Fatalf("Invalid --limit %d: must be at least 1", searchLimit)
+	}
+
+	indexPath := searchIndexPath
+	if indexPath == "" {
+		indexPath = wikipedia.DefaultIndexPath(searchZimPath)
+	}
+
+	index, err := wikipedia.LoadBlugeIndex(indexPath)
+	if err != nil {
+		log.Fatalf("Failed to load search index %s: %v", indexPath, err)
+	}
+	defer index.Close()
+
+	query := searchQuery
+	if searchAnd {
+		query = wikipedia.AndQueryPrefix + query
+	}
+
+	results, total, err := index.SearchWithOffset(context.Background(), query, 0, searchLimit)
+	if err != nil {
+		log.Fatalf("Search failed: %v", err)
+	}
+
+	fmt.Printf("%d results for %q, showing %d:\n", total, searchQuery, len(results))
+	fmt.Println()
+	for i, result := range results {
+		fmt.Printf("%3d. %-40s %8.3f  id=%d  %s\n", i+1, result.Title, result.Score, result.Index, result.URL)
+		if result.Snippet != "" {
+			fmt.Printf("     %s\n", result.Snippet)
+		}
+	}
+}
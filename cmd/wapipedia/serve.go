@@ -1,23 +1,54 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/debug"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/bevelgacom/wapipedia/internal/server"
+	"github.com/bevelgacom/wapipedia/pkg/wikipedia"
 	"github.com/labstack/echo/v4"
 	"github.com/spf13/cobra"
 )
 
 var (
-	zimPath    string
-	port       string
-	lowMemory  bool
-	gcInterval int
+	zimPath         string
+	port            string
+	lowMemory       bool
+	gcInterval      int
+	articleDeadline int
+	requestTimeout  int
+	loadingRetry    int
+	articleMaxAge   int
+	searchMaxAge    int
+	skipCollapsed   bool
+	keepHatnote     bool
+	keepExtLinks    bool
+	softKeys        bool
+	accessKeys      bool
+	articleCache    int
+	articleCacheMB  int
+	maxArticleKB    int
+	clusterCache    int
+	imageNamespaces string
+	maxImagePixels  int64
+	adminToken      string
+	logFormat       string
+	rateLimitMode   string
+	rateLimitRate   float64
+	rateLimitBurst  int
+	refuseStale     bool
+	inMemoryIndexMB int64
+	deviceRules     []string
 )
 
 var serveCmd = &cobra.Command{
@@ -27,7 +58,8 @@ var serveCmd = &cobra.Command{
 to legacy mobile devices.`,
 	Example: `  wapipedia serve
   wapipedia serve -zim ./data/wikipedia.zim -port 8080
-  wapipedia serve --low-memory  # For systems with 512MB RAM or less`,
+  wapipedia serve --low-memory  # For systems with 512MB RAM or less
+  wapipedia serve -zim ./data/  # Serve every ZIM in ./data, IDs prefixed e.g. "en:1234"`,
 	Run: func(cmd *cobra.Command, args []string) {
 		runServe()
 	},
@@ -41,10 +73,34 @@ func init() {
 		defaultZim = "./data/wikipedia.zim"
 	}
 
-	serveCmd.Flags().StringVarP(&zimPath, "zim", "z", defaultZim, "Path to Wikipedia ZIM file")
+	serveCmd.Flags().StringVarP(&zimPath, "zim", "z", defaultZim, "Path to Wikipedia ZIM file, or a directory to serve all ZIM files in it")
 	serveCmd.Flags().StringVarP(&port, "port", "p", "8080", "Server port")
 	serveCmd.Flags().BoolVar(&lowMemory, "low-memory", false, "Enable low-memory optimizations for systems with 512MB RAM or less")
 	serveCmd.Flags().IntVar(&gcInterval, "gc-interval", 60, "Garbage collection interval in seconds (0 to disable)")
+	serveCmd.Flags().IntVar(&articleDeadline, "article-deadline", 0, "Seconds before a slow article is answered with a \"still loading\" page (0 to always wait)")
+	serveCmd.Flags().IntVar(&requestTimeout, "request-timeout", int(server.DefaultConfig().RequestTimeout/time.Second), "Seconds a search or article fetch may run before it is abandoned (0 for no limit)")
+	serveCmd.Flags().IntVar(&loadingRetry, "loading-retry", 3, "Seconds before the \"still loading\" page retries automatically (0 for a manual retry link only)")
+	serveCmd.Flags().IntVar(&articleMaxAge, "article-max-age", 3600, "Seconds devices may cache article pages (0 to disable caching)")
+	serveCmd.Flags().IntVar(&searchMaxAge, "search-max-age", 0, "Seconds devices may cache search results (0 to disable caching)")
+	serveCmd.Flags().IntVar(&articleCache, "article-cache-size", wikipedia.DefaultArticleCacheEntries, "Number of rendered articles kept in memory (0 to disable)")
+	serveCmd.Flags().IntVar(&articleCacheMB, "article-cache-mb", wikipedia.DefaultArticleCacheBytes/1024/1024, "Megabytes of rendered articles kept in memory")
+	serveCmd.Flags().IntVar(&maxArticleKB, "max-article-kb", wikipedia.DefaultMaxArticleBytes/1024, "Kilobytes of article HTML above which an article is truncated with a notice (0 to never truncate)")
+	serveCmd.Flags().BoolVar(&refuseStale, "refuse-stale-index", false, "Disable search instead of warning when a search index was built from a different ZIM file than the one served")
+	serveCmd.Flags().Int64Var(&inMemoryIndexMB, "in-memory-index-mb", wikipedia.DefaultInMemoryIndexBytes/1024/1024, "Build a search index in memory at startup for ZIM files up to this many megabytes that have no index built (0 to disable)")
+	serveCmd.Flags().IntVar(&clusterCache, "cluster-cache-size", 0, fmt.Sprintf("Number of decompressed ZIM clusters kept in memory per ZIM file (0 for %d, or %d with --low-memory)", wikipedia.DefaultClusterCacheSize, wikipedia.LowMemoryClusterCacheSize))
+	serveCmd.Flags().StringVar(&imageNamespaces, "image-namespaces", wikipedia.DefaultImageNamespaces, "ZIM namespaces searched for images, in order, one character each")
+	serveCmd.Flags().Int64Var(&maxImagePixels, "max-image-pixels", server.DefaultConfig().MaxImagePixels, "Largest source image in pixels converted for devices, larger ones are refused (0 for no limit)")
+	serveCmd.Flags().StringVar(&adminToken, "admin-token", os.Getenv("WAPIPEDIA_ADMIN_TOKEN"), "Bearer token for the admin endpoints POST /admin/reload and GET /raw (default $WAPIPEDIA_ADMIN_TOKEN, empty disables them)")
+	serveCmd.Flags().StringVar(&logFormat, "log-format", "text", "Log output format: text, or json for structured logs including one record per request")
+	serveCmd.Flags().StringVar(&rateLimitMode, "ratelimit-mode", string(server.DefaultConfig().RateLimitMode), "Rate limit requests globally, per client ip, or per subscriber header (X-Up-Calling-Line-Id or X-MSISDN, falling back to ip): global, ip or header")
+	serveCmd.Flags().Float64Var(&rateLimitRate, "ratelimit-rate", server.DefaultConfig().RateLimitRate, "Requests per second allowed for each rate limit bucket (0 to disable rate limiting)")
+	serveCmd.Flags().IntVar(&rateLimitBurst, "ratelimit-burst", server.DefaultConfig().RateLimitBurst, "Requests a rate limit bucket may make at once above its rate")
+	serveCmd.Flags().BoolVar(&skipCollapsed, "skip-collapsed", false, "Show only the heading of sections that are collapsed by default on Wikipedia")
+	serveCmd.Flags().BoolVar(&keepHatnote, "keep-hatnote", false, "Show the first \"For other uses, see ...\" note of an article as a See also line instead of removing it")
+	serveCmd.Flags().BoolVar(&keepExtLinks, "keep-external-links", false, "List the URLs of external links as numbered footnotes at the end of articles instead of dropping them")
+	serveCmd.Flags().BoolVar(&softKeys, "soft-keys", server.DefaultConfig().SoftKeys, "Bind article paging, search and home to the phone's soft keys (--soft-keys=false shows links instead, for browsers that fail on WML <do>)")
+	serveCmd.Flags().StringArrayVar(&deviceRules, "device-profile", nil, "What devices whose User-Agent contains a string can show, as ua:key=value,... with keys tables, fieldsets, images, cards (true or false), deck (bytes) and format (wbmp or jpeg), e.g. \"nokia7110:images=false,deck=1397\" (repeatable, tried before the built-in profiles)")
+	serveCmd.Flags().BoolVar(&accessKeys, "access-keys", server.DefaultConfig().AccessKeys, "Number search results and let the digits 1-9 follow them and the first article links of each page (--access-keys=false for browsers that reject the accesskey attribute)")
 
 	// Also add flags to root command for default behavior
 	rootCmd.Flags().StringVarP(&zimPath, "zim", "z", defaultZim, "Path to Wikipedia ZIM file")
@@ -52,6 +108,33 @@ func init() {
 }
 
 func runServe() {
+	switch logFormat {
+	case "text":
+	case "json":
+		// The log package writes through the default slog logger once it is set
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	default:
+		log.Fatalf("Invalid --log-format %q: must be text or json", logFormat)
+	}
+	if clusterCache < 0 {
+		log.Fatalf("Invalid --cluster-cache-size %d: must be at least 1, or 0 for the default", clusterCache)
+	}
+	if imageNamespaces == "" {
+		log.Fatalf("Invalid --image-namespaces: must list at least one namespace")
+	}
+	mode, ok := server.ParseRateLimitMode(rateLimitMode)
+	if !ok {
+		log.Fatalf("Invalid --ratelimit-mode %q: must be global, ip or header", rateLimitMode)
+	}
+	var rules []server.DeviceRule
+	for _, s := range deviceRules {
+		rule, err := server.ParseDeviceRule(s)
+		if err != nil {
+			log.Fatalf("Invalid --device-profile: %v", err)
+		}
+		rules = append(rules, rule)
+	}
+
 	// Memory optimization settings for low-memory systems
 	if lowMemory {
 		log.Println("Low-memory mode enabled")
@@ -68,16 +151,34 @@ func runServe() {
 		log.Println("Memory limit set to 350MB")
 	}
 
+	// Stop on interrupt or termination, see the shutdown below
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Start periodic GC if enabled
 	if gcInterval > 0 {
 		log.Printf("Starting periodic GC every %d seconds", gcInterval)
-		go periodicGC(time.Duration(gcInterval) * time.Second)
+		go periodicGC(ctx, time.Duration(gcInterval)*time.Second)
 	}
 
-	// Initialize Wikipedia if ZIM file exists
-	if _, err := os.Stat(zimPath); err == nil {
-		log.Printf("Loading Wikipedia from %s...", zimPath)
-		if err := server.InitWikipedia(zimPath); err != nil {
+	// Rendered article cache, applies to the wikis loaded below
+	wikipedia.SetArticleCacheLimits(articleCache, articleCacheMB*1024*1024)
+	wikipedia.SetImageNamespaces(imageNamespaces)
+	wikipedia.SetMaxArticleBytes(maxArticleKB * 1024)
+	wikipedia.SetRefuseStaleIndex(refuseStale)
+	wikipedia.SetInMemoryIndexLimit(inMemoryIndexMB * 1024 * 1024)
+
+	// Initialize Wikipedia if ZIM file exists. A directory loads every ZIM file in it.
+	if info, err := os.Stat(zimPath); err == nil {
+		zimPaths := []string{zimPath}
+		if info.IsDir() {
+			if zimPaths, err = wikipedia.FindZIMFiles(zimPath); err != nil || len(zimPaths) == 0 {
+				log.Fatalf("No ZIM files found in %s", zimPath)
+			}
+		}
+		log.Printf("Loading Wikipedia from %s...", strings.Join(zimPaths, ", "))
+		readerOpts := wikipedia.ZIMReaderOptions{LowMemory: lowMemory, ClusterCacheSize: clusterCache}
+		if err := server.InitWikipedias(zimPaths, readerOpts); err != nil {
 			log.Printf("Warning: Failed to load Wikipedia: %v", err)
 			log.Println("Wikipedia features will be disabled. Use 'wapipedia download' to get dumps.")
 		} else {
@@ -89,23 +190,74 @@ func runServe() {
 		log.Println("Use 'wapipedia download -lang simple' to download a Wikipedia dump.")
 	}
 
+	cfg := server.DefaultConfig()
+	cfg.ArticleDeadline = time.Duration(articleDeadline) * time.Second
+	cfg.RequestTimeout = time.Duration(requestTimeout) * time.Second
+	cfg.LoadingRetry = time.Duration(loadingRetry) * time.Second
+	cfg.ArticleMaxAge = time.Duration(articleMaxAge) * time.Second
+	cfg.SearchMaxAge = time.Duration(searchMaxAge) * time.Second
+	cfg.SkipCollapsed = skipCollapsed
+	cfg.KeepHatnote = keepHatnote
+	cfg.KeepExternalLinks = keepExtLinks
+	cfg.SoftKeys = softKeys
+	cfg.AccessKeys = accessKeys
+	cfg.DeviceRules = rules
+	cfg.MaxImagePixels = maxImagePixels
+	cfg.AdminToken = adminToken
+	cfg.RequestLogs = logFormat == "json"
+	cfg.RateLimitMode = mode
+	cfg.RateLimitRate = rateLimitRate
+	cfg.RateLimitBurst = rateLimitBurst
+	server.SetConfig(cfg)
+
 	e := echo.New()
+	if logFormat == "json" {
+		e.HideBanner = true
+		e.HidePort = true
+	}
 
 	// Wikipedia routes
 	server.RegisterWikiRoutes(e)
 
-	log.Printf("Starting WAPipedia server on port %s...", port)
-	if err := e.Start(":" + port); err != nil && err != http.ErrServerClosed {
-		log.Fatal(err)
+	go func() {
+		log.Printf("Starting WAPipedia server on port %s...", port)
+		if err := e.Start(":" + port); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down, waiting for requests in progress...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown: %v", err)
 	}
+
+	// Close the ZIM files and release the search index
+	if err := server.CloseWikipedia(); err != nil {
+		log.Printf("Failed to close Wikipedia: %v", err)
+	}
+	log.Println("Server stopped")
 }
 
-// periodicGC runs garbage collection periodically to keep memory usage low
-func periodicGC(interval time.Duration) {
+// shutdownTimeout is how long requests in progress may take to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// periodicGC runs garbage collection periodically to keep memory usage low, until ctx is done
+func periodicGC(ctx context.Context, interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
 		var before runtime.MemStats
 		runtime.ReadMemStats(&before)
 
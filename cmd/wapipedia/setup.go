@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/bevelgacom/wapipedia/pkg/wikipedia"
+	"github.com/spf13/cobra"
+)
+
+var (
+	setupLang      string
+	setupDest      string
+	setupFullText  bool
+	setupRedirects bool
+	setupWorkers   int
+	setupForce     bool
+	setupTimeout   int
+	setupForceDL   bool
+	setupAttempts  int
+)
+
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Download a Wikipedia dump, verify it and build its search index",
+	Long: `Get a dump ready to serve in one step: download it like 'wapipedia download',
+check it like 'wapipedia verify' and build its search index like
+'wapipedia index'.
+
+A dump that was downloaded before is not downloaded again, and an existing
+search index is kept unless --force is given. The index is not built if the
+dump has problems.`,
+	Example: `  wapipedia setup -lang top100
+  wapipedia setup -lang top100-mini -dest ./data --full-text
+  wapipedia setup -lang top100 --force  # rebuild the index`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runSetup()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(setupCmd)
+
+	setupCmd.Flags().StringVarP(&setupLang, "lang", "l", "top100", "Language/dump to download (see 'wapipedia list'), or the URL of a ZIM file")
+	setupCmd.Flags().StringVarP(&setupDest, "dest", "d", "./data", "Destination directory for download")
+	setupCmd.Flags().IntVar(&setupTimeout, "timeout", int(wikipedia.DefaultDownloadTimeout/time.Second), "Seconds to wait for the mirror to connect, answer or send more data (0 to wait forever)")
+	setupCmd.Flags().BoolVar(&setupFullText, "full-text", false, "Also index article body text (much larger index, slower to build)")
+	setupCmd.Flags().BoolVar(&setupRedirects, "index-redirects", false, "Also index redirect titles, pointing at their target article (larger index)")
+	setupCmd.Flags().IntVar(&setupWorkers, "workers", runtime.NumCPU(), "Number of indexing workers")
+	setupCmd.Flags().BoolVar(&setupForce, "force", false, "Rebuild the search index if it already exists")
+	setupCmd.Flags().IntVar(&setupAttempts, "attempts", wikipedia.DefaultDownloadAttempts, "Times in a row the download may fail before giving up, resuming where it stopped in between")
+	setupCmd.Flags().BoolVar(&setupForceDL, "force-download", false, "Download even if the dump looks larger than the free disk space")
+}
+
+func runSetup() {
+	if setupWorkers < 1 || setupWorkers > 256 {
+		log.Fatalf("Invalid --workers %d: must be between 1 and 256", setupWorkers)
+	}
+
+	startTime := time.Now()
+
+	wikipedia.SetDownloadTimeout(time.Duration(setupTimeout) * time.Second)
+	wikipedia.SetCheckDiskSpace(!setupForceDL)
+	wikipedia.SetDownloadAttempts(setupAttempts)
+	fmt.Printf("Downloading Wikipedia dump '%s' to %s...\n", setupLang, setupDest)
+	zimPath, err := wikipedia.DownloadDump(setupLang, setupDest, printDownloadProgress)
+	if errors.Is(err, wikipedia.ErrInsufficientDiskSpace) {
+		log.Fatalf("\nDownload failed: %v\nFree up space, or use --force-download if the free space is misreported.", err)
+	}
+	if err != nil {
+		log.Fatalf("\nDownload failed: %v", err)
+	}
+	fmt.Printf("\nDump: %s\n\n", zimPath)
+
+	report, err := wikipedia.VerifyZIM(zimPath, wikipedia.VerifyOptions{Progress: printVerifyProgress})
+	if err != nil {
+		log.Fatalf("Failed to open ZIM file: %v", err)
+	}
+	if !report.OK() {
+		fmt.Println("\nThe dump has problems, not building the index:")
+		for _, problem := range report.Problems {
+			fmt.Printf("  %s\n", problem)
+		}
+		fmt.Printf("\nDelete %s and run setup again to download it again.\n", zimPath)
+		os.Exit(1)
+	}
+	fmt.Printf("No problems found in %d entries\n\n", report.Entries)
+
+	indexPath := wikipedia.DefaultIndexPath(zimPath)
+	if _, err := os.Stat(indexPath); err == nil && !setupForce {
+		fmt.Printf("Search index %s already exists, skipping (use --force to rebuild it)\n", indexPath)
+	} else {
+		fmt.Printf("Building search index %s...\n", indexPath)
+		if err := wikipedia.BuildBlugeIndex(zimPath, indexPath, wikipedia.IndexOptions{
+			FullText:  setupFullText,
+			Workers:   setupWorkers,
+			Redirects: setupRedirects,
+		}); err != nil {
+			log.Fatalf("Failed to build index: %v", err)
+		}
+	}
+
+	fmt.Printf("\nSetup complete in %s\n", time.Since(startTime).Round(time.Second))
+	fmt.Printf("\nTo serve this dump, run:\n  wapipedia serve -zim %s\n", zimPath)
+}
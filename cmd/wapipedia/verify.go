@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bevelgacom/wapipedia/pkg/wikipedia"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyZimPath    string
+	verifyFull       bool
+	verifySampleSize int
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check a ZIM file for unreadable content",
+	Long: `Check a ZIM file for damage before serving it.
+
+Every directory entry is read and every redirect is followed to its target.
+Then a sample of the clusters, spread over the whole file, is decompressed and
+the blobs entries point at are extracted. With --full every cluster is
+decompressed, which reads the whole file and can take a long time.
+
+Reports unreadable entries, broken redirect targets, clusters using a
+compression the reader does not support and unreadable clusters and blobs.
+Exits with status 1 if any problem is found.`,
+	Example: `  wapipedia verify -z ./data/wikipedia.zim
+  wapipedia verify -z ./data/wikipedia.zim --sample 1000
+  wapipedia verify -z ./data/wikipedia.zim --full`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runVerify()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	defaultZim := os.Getenv("WAPIPEDIA_ZIM")
+	if defaultZim == "" {
+		defaultZim = "./data/wikipedia.zim"
+	}
+
+	verifyCmd.Flags().StringVarP(&verifyZimPath, "zim", "z", defaultZim, "Path to Wikipedia ZIM file")
+	verifyCmd.Flags().BoolVar(&verifyFull, "full", false, "Decompress every cluster instead of a sample")
+	verifyCmd.Flags().IntVar(&verifySampleSize, "sample", wikipedia.DefaultVerifySampleSize, "Number of clusters to decompress without --full")
+}
+
+// printVerifyProgress shows which checks VerifyZIM is making
+func printVerifyProgress(progress wikipedia.VerifyProgress) {
+	switch {
+	case progress.Stage == wikipedia.VerifyEntries && progress.Done == 0:
+		fmt.Printf("Checking %d directory entries\n", progress.Total)
+	case progress.Stage == wikipedia.VerifyEntries:
+		fmt.Printf("Checking entries: %d%% complete\n", uint64(progress.Done)*100/uint64(progress.Total))
+	case progress.Stage == wikipedia.VerifyClusters && progress.Done == 0:
+		fmt.Printf("Decompressing %d clusters\n", progress.Total)
+	}
+}
+
+func runVerify() {
+	// Check if ZIM file exists
+	if _, err := os.Stat(verifyZimPath); os.IsNotExist(err) {
+		log.Fatalf("ZIM file not found: %s", verifyZimPath)
+	}
+
+	if verifySampleSize < 1 {
+		log.Fatalf("Invalid --sample %d: must be at least 1", verifySampleSize)
+	}
+
+	startTime := time.Now()
+
+	report, err := wikipedia.VerifyZIM(verifyZimPath, wikipedia.VerifyOptions{
+		Full:       verifyFull,
+		SampleSize: verifySampleSize,
+		Progress:   printVerifyProgress,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open ZIM file: %v", err)
+	}
+
+	fmt.Printf("\nVerified %s in %s\n", verifyZimPath, time.Since(startTime).Round(time.Second))
+	fmt.Printf("  Entries:                 %d (%d redirects)\n", report.Entries, report.Redirects)
+	fmt.Printf("  Clusters checked:        %d of %d\n", report.ClustersChecked, report.Clusters)
+	fmt.Println()
+	fmt.Printf("  Unreadable entries:      %d\n", report.UnreadableEntries)
+	fmt.Printf("  Broken redirects:        %d\n", report.BrokenRedirects)
+	fmt.Printf("  Unsupported compression: %d\n", report.UnsupportedCompression)
+	fmt.Printf("  Unreadable clusters:     %d\n", report.UnreadableClusters)
+	fmt.Printf("  Unreadable blobs:        %d\n", report.UnreadableBlobs)
+
+	if report.OK() {
+		fmt.Println("\nNo problems found")
+		return
+	}
+
+	fmt.Println("\nProblems:")
+	for _, problem := range report.Problems {
+		fmt.Printf("  %s\n", problem)
+	}
+	os.Exit(1)
+}
@@ -8,6 +8,7 @@ require (
 	github.com/labstack/echo/v4 v4.11.4
 	github.com/spf13/cobra v1.10.2
 	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/text v0.23.0
 	golang.org/x/time v0.5.0
 	gopkg.in/gographics/imagick.v3 v3.7.2
 )
@@ -40,5 +41,4 @@ require (
 	golang.org/x/crypto v0.36.0 // indirect
 	golang.org/x/net v0.38.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
-	golang.org/x/text v0.23.0 // indirect
 )
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// requireAdminToken only lets requests through that carry the configured admin token as
+// "Authorization: Bearer <token>". Without a configured token the admin endpoints don't exist.
+func requireAdminToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if config.AdminToken == "" {
+			return c.String(http.StatusNotFound, "Not found.\n")
+		}
+		token, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+			slog.Warn("Rejected admin request", "path", c.Path(), "ip", c.RealIP())
+			return c.String(http.StatusUnauthorized, "Invalid admin token.\n")
+		}
+		return next(c)
+	}
+}
+
+// serveAdminReload reopens the search index of every loaded wiki, or only of the one
+// named by the wiki parameter, from its default path next to the ZIM file
+func serveAdminReload(c echo.Context) error {
+	if wiki == nil {
+		return c.String(http.StatusServiceUnavailable, "Wikipedia data is not loaded.\n")
+	}
+
+	names := wikis.Names()
+	if name := c.QueryParam("wiki"); name != "" {
+		if _, ok := wikis.Get(name); !ok {
+			return c.String(http.StatusNotFound, "No such wiki.\n")
+		}
+		names = []string{name}
+	}
+
+	var b strings.Builder
+	failed := false
+	for _, name := range names {
+		w, _ := wikis.Get(name)
+		if err := w.ReloadIndex(""); err != nil {
+			slog.Error("Failed to reload index", "wiki", name, "error", err)
+			fmt.Fprintf(&b, "%s: %v\n", wikiLabel(name), err)
+			failed = true
+			continue
+		}
+		slog.Info("Reloaded index", "wiki", name)
+		fmt.Fprintf(&b, "%s: reloaded\n", wikiLabel(name))
+	}
+
+	if failed {
+		return c.String(http.StatusInternalServerError, b.String())
+	}
+	return c.String(http.StatusOK, b.String())
+}
+
+// serveAdminRaw serves the content of the entry named by the id parameter exactly as the
+// ZIM file stores it, with its MIME type, for reproducing conversion bugs
+func serveAdminRaw(c echo.Context) error {
+	if wiki == nil {
+		return c.String(http.StatusServiceUnavailable, "Wikipedia data is not loaded.\n")
+	}
+
+	id := c.QueryParam("id")
+	if id == "" {
+		return c.String(http.StatusBadRequest, "No article ID specified.\n")
+	}
+	w, idx, err := wikis.ResolveArticleID(id)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid article ID.\n")
+	}
+
+	content, mimeType, err := w.GetRawContent(idx)
+	if err != nil {
+		slog.Warn("Failed to get raw content", "article_id", id, "error", err)
+		return c.String(http.StatusNotFound, "Article not found.\n")
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	slog.Info("Serving raw content", "article_id", id, "mime_type", mimeType, "bytes", len(content))
+	return c.Blob(http.StatusOK, mimeType, content)
+}
+
+// wikiLabel names a wiki in plain text output, the default single wiki has no name
+func wikiLabel(name string) string {
+	if name == "" {
+		return "default"
+	}
+	return name
+}
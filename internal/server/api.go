@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bevelgacom/wapipedia/pkg/wikipedia"
+	"github.com/labstack/echo/v4"
+)
+
+// Number of search results the JSON API under /api/ returns unless asked, and at most
+const (
+	apiSearchResults    = 10
+	apiMaxSearchResults = 50
+)
+
+// APIArticle is an article as served by /api/article and /api/random
+type APIArticle struct {
+	ID      string                   `json:"id"`
+	Title   string                   `json:"title"`
+	URL     string                   `json:"url"`
+	Format  string                   `json:"format"`  // "wml" or "text", as asked with the format parameter
+	Content string                   `json:"content"` // the whole article, not split into pages
+	Images  []wikipedia.ArticleImage `json:"images"`
+}
+
+// APISearch is a page of search results as served by /api/search
+type APISearch struct {
+	Query      string            `json:"query"`
+	Total      int               `json:"total"`
+	Offset     int               `json:"offset"`
+	Results    []APISearchResult `json:"results"`
+	Suggestion string            `json:"suggestion,omitempty"` // spelling suggestion when nothing was found
+}
+
+// APISearchResult is a search result as served by /api/search
+type APISearchResult struct {
+	ID      string  `json:"id"`
+	Title   string  `json:"title"`
+	URL     string  `json:"url"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet,omitempty"` // HTML, with the matches in <b>
+}
+
+// serveAPISearch serves search results for the q parameter, from the o parameter on and
+// at most n of them
+func serveAPISearch(c echo.Context) error {
+	if wiki == nil {
+		return serveJSONError(c, http.StatusServiceUnavailable, "Wikipedia data is not loaded.")
+	}
+
+	query := c.QueryParam("q")
+	if query == "" {
+		return serveJSONError(c, http.StatusBadRequest, "No search query specified.")
+	}
+	offset, err := apiIntParam(c, "o", 0)
+	if err != nil || offset < 0 {
+		return serveJSONError(c, http.StatusBadRequest, "Offset must be a number of at least 0.")
+	}
+	limit, err := apiIntParam(c, "n", apiSearchResults)
+	if err != nil || limit < 1 || limit > apiMaxSearchResults {
+		return serveJSONError(c, http.StatusBadRequest, "Number of results must be from 1 to "+strconv.Itoa(apiMaxSearchResults)+".")
+	}
+
+	searchStart := time.Now()
+	results, total, err := wikis.SearchWithOffset(c.Request().Context(), query, offset, limit)
+	searchDuration.observe("", time.Since(searchStart))
+	if errors.Is(err, context.DeadlineExceeded) {
+		return serveJSONError(c, http.StatusServiceUnavailable, "The search took too long, please try again.")
+	}
+	if err != nil {
+		slog.Error("Search failed", "query", query, "error", err)
+		return serveJSONError(c, http.StatusInternalServerError, "An error occurred while searching.")
+	}
+
+	data := APISearch{Query: query, Total: total, Offset: offset, Results: []APISearchResult{}}
+	for _, r := range results {
+		data.Results = append(data.Results, APISearchResult{ID: r.ID, Title: r.Title, URL: r.URL, Score: r.Score, Snippet: r.Snippet})
+	}
+	if total == 0 {
+		if data.Suggestion, err = wikis.Suggest(query); err != nil {
+			slog.Warn("Suggest failed", "query", query, "error", err)
+		}
+	}
+	return c.JSON(http.StatusOK, data)
+}
+
+// serveAPIArticle serves the article named by the id parameter
+func serveAPIArticle(c echo.Context) error {
+	if wiki == nil {
+		return serveJSONError(c, http.StatusServiceUnavailable, "Wikipedia data is not loaded.")
+	}
+
+	idStr := c.QueryParam("id")
+	if idStr == "" {
+		return serveJSONError(c, http.StatusBadRequest, "No article ID specified.")
+	}
+	w, id, err := wikis.ResolveArticleID(idStr)
+	if err != nil {
+		return serveJSONError(c, http.StatusBadRequest, "Invalid article ID.")
+	}
+	if entry, mimeType, err := w.GetEntry(id); err == nil && !isArticleEntry(entry, mimeType) {
+		return serveJSONError(c, http.StatusNotFound, "The entry is not an article.")
+	}
+	return serveAPIArticleData(c, w, id)
+}
+
+// serveAPIRandom serves a random article of the default wiki
+func serveAPIRandom(c echo.Context) error {
+	if wiki == nil {
+		return serveJSONError(c, http.StatusServiceUnavailable, "Wikipedia data is not loaded.")
+	}
+
+	article, err := wiki.GetRandomArticle()
+	if err != nil {
+		slog.Error("Failed to get random article", "error", err)
+		return serveJSONError(c, http.StatusInternalServerError, "Could not get a random article.")
+	}
+	return serveAPIArticleData(c, wiki, article.Index)
+}
+
+// serveAPIArticleData serves an article of w in the format asked with the format
+// parameter, WML unless it is "text"
+func serveAPIArticleData(c echo.Context, w *wikipedia.Wikipedia, id uint32) error {
+	format := c.QueryParam("format")
+	switch format {
+	case "":
+		format = "wml"
+	case "wml", "text":
+	default:
+		return serveJSONError(c, http.StatusBadRequest, "Format must be wml or text.")
+	}
+
+	// Images are listed whatever the device profile, the client decides what to show
+	opts := getRenderOptions(c)
+	if format == "text" {
+		opts = wikipedia.RenderOptions{Mode: wikipedia.RenderPlainText, FollowRedirects: true}
+	}
+	opts.SupportsImages = true
+	article, err := fetchArticle(c.Request().Context(), w, id, opts)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return serveJSONError(c, http.StatusServiceUnavailable, "The article took too long to load, please try again.")
+	}
+	if err != nil {
+		slog.Warn("Failed to get article", "article_id", id, "error", err)
+		return serveJSONError(c, http.StatusNotFound, "The requested article could not be found.")
+	}
+
+	data := APIArticle{
+		ID:      w.ArticleID(article.Index),
+		Title:   article.Title,
+		URL:     article.URL,
+		Format:  format,
+		Content: article.Content,
+		Images:  article.Images,
+	}
+	if data.Images == nil {
+		data.Images = []wikipedia.ArticleImage{}
+	}
+	return c.JSON(http.StatusOK, data)
+}
+
+// serveAPIImage serves an image from the ZIM file as it is stored, with its MIME type.
+// /image/ converts images for WAP devices instead.
+func serveAPIImage(c echo.Context) error {
+	if wiki == nil {
+		return serveJSONError(c, http.StatusServiceUnavailable, "Wikipedia data is not loaded.")
+	}
+
+	imagePath := c.Param("*")
+	if imagePath == "" {
+		return serveJSONError(c, http.StatusBadRequest, "No image ID specified.")
+	}
+	content, mimeType, err := wikis.GetImage(imagePath)
+	if err != nil {
+		slog.Warn("Failed to get image", "image", imagePath, "error", err)
+		return serveJSONError(c, http.StatusNotFound, "The requested image could not be found.")
+	}
+	return c.Blob(http.StatusOK, mimeType, content)
+}
+
+// apiIntParam returns the integer query parameter name, or def if it is absent
+func apiIntParam(c echo.Context, name string, def int) (int, error) {
+	s := c.QueryParam(name)
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// serveJSONError serves an error as a JSON object with an "error" message
+func serveJSONError(c echo.Context, status int, message string) error {
+	return c.JSON(status, map[string]string{"error": message})
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"time"
+
+	image "github.com/bevelgacom/wapipedia/pkg/wbmp"
+)
+
+// Config holds server settings chosen on the serve command line
+type Config struct {
+	// ArticleDeadline is how long an article request may take before a "still loading"
+	// deck is served instead. The article keeps loading into the cluster cache so a retry
+	// is fast. Zero waits for the article however long it takes.
+	ArticleDeadline time.Duration
+	// RequestTimeout bounds how long a search or article fetch may run for a request,
+	// including an article still loading in the background after ArticleDeadline. Zero
+	// lets them run however long they take.
+	RequestTimeout time.Duration
+	// LoadingRetry is the delay after which the "still loading" deck retries on its own
+	// using a WML timer. Zero shows only a manual retry link.
+	LoadingRetry time.Duration
+	// ArticleMaxAge is how long devices may cache article, contents and infobox decks.
+	// Zero marks them as not cacheable.
+	ArticleMaxAge time.Duration
+	// SearchMaxAge is how long devices may cache search result decks. Zero marks them
+	// as not cacheable, results then always reflect the current index.
+	SearchMaxAge time.Duration
+	// SkipCollapsed renders collapsed-by-default sections as just their heading,
+	// for more compact articles
+	SkipCollapsed bool
+	// KeepHatnote shows the first hatnote of an article ("For other uses, see ...") as a
+	// compact "See also" line instead of removing all of them
+	KeepHatnote bool
+	// KeepExternalLinks lists the URLs of external links as numbered footnotes at the end
+	// of articles, for devices whose browser can follow them. Otherwise only their text
+	// is kept.
+	KeepExternalLinks bool
+	// SoftKeys binds article page navigation, search and home to the device's soft keys
+	// with WML <do> elements. Without it they are links below the article, for early
+	// browsers that fail on <do>.
+	SoftKeys bool
+	// AccessKeys gives search results and the first nine article links of each deck the
+	// keypad digits 1-9 as WML access keys, so they can be followed with one key press
+	AccessKeys bool
+	// DeviceRules give devices what they can show, by User-Agent, before the built-in
+	// rules are tried. Devices no rule matches get tables, fieldsets and images.
+	DeviceRules []DeviceRule
+	// MaxImagePixels is the largest source image, in pixels, that is converted for
+	// devices. Larger images are refused instead of decoded. Zero disables the limit.
+	MaxImagePixels int64
+	// AdminToken is the bearer token required by the /admin endpoints and /raw. Empty
+	// disables them.
+	AdminToken string
+	// RequestLogs emits a structured log record for every request, with its path,
+	// article ID, User-Agent, status, latency and article cache result
+	RequestLogs bool
+	// RateLimitMode selects whether the rate limit applies to all requests together,
+	// per client IP address or per subscriber header forwarded by the WAP gateway
+	RateLimitMode RateLimitMode
+	// RateLimitRate is the number of requests per second allowed for each rate limit
+	// bucket. Zero disables rate limiting.
+	RateLimitRate float64
+	// RateLimitBurst is the number of requests a bucket may make at once above its rate
+	RateLimitBurst int
+}
+
+// DefaultConfig returns the server configuration used unless SetConfig is called
+func DefaultConfig() Config {
+	return Config{
+		RequestTimeout: 30 * time.Second,
+		LoadingRetry:   3 * time.Second,
+		ArticleMaxAge:  time.Hour,
+		SoftKeys:       true,
+		AccessKeys:     true,
+		MaxImagePixels: image.DefaultMaxPixels,
+		// Most requests come through Kannel, so one bucket for everyone by default
+		RateLimitMode:  RateLimitGlobal,
+		RateLimitRate:  5,
+		RateLimitBurst: 10,
+	}
+}
+
+// Active server configuration
+var config = DefaultConfig()
+
+// SetConfig sets the server configuration, it must be called before serving requests
+func SetConfig(c Config) {
+	config = c
+}
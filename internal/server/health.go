@@ -0,0 +1,28 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// serveHealthz answers liveness checks, it only tells the process is up
+func serveHealthz(c echo.Context) error {
+	return c.String(http.StatusOK, "ok\n")
+}
+
+// serveReadyz answers readiness checks: ready once Wikipedia is loaded and every wiki
+// that has a search index next to its ZIM file has loaded it
+func serveReadyz(c echo.Context) error {
+	if wiki == nil {
+		return c.String(http.StatusServiceUnavailable, "Wikipedia data is not loaded.\n")
+	}
+	for _, name := range wikis.Names() {
+		w, _ := wikis.Get(name)
+		if !w.SearchIndexReady() {
+			return c.String(http.StatusServiceUnavailable, fmt.Sprintf("%s: search index is not loaded.\n", wikiLabel(name)))
+		}
+	}
+	return c.String(http.StatusOK, "ready\n")
+}
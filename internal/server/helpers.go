@@ -1,30 +1,265 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bevelgacom/wapipedia/pkg/wikipedia"
 	"github.com/labstack/echo/v4"
 )
 
-// isNokia7110 checks if the User-Agent indicates a Nokia 7110
-// The Nokia 7110 has limited WML support (no tables in early firmware)
-func isNokia7110(userAgent string) bool {
+// acceptsXHTMLMP reports whether an Accept header lists XHTML Mobile Profile with a
+// quality above 0, in any of its ranges naming it. Only WAP 2.0 browsers do, and they
+// render it better than WML. Ranges with an unreadable quality don't count.
+func acceptsXHTMLMP(accept string) bool {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		if strings.TrimSpace(strings.ToLower(params[0])) != "application/vnd.wap.xhtml+xml" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(strings.ToLower(name)) != "q" {
+				continue
+			}
+			var err error
+			if q, err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+				q = 0
+			}
+		}
+		if q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// DeviceProfile is what a class of devices can show, matched by User-Agent
+type DeviceProfile struct {
+	SupportsTables    bool   // Whether the browser shows WML tables
+	SupportsFieldsets bool   // Whether to group list sections in WML fieldsets
+	SupportsImages    bool   // Whether to show images at all, text-only browsers get none
+	SupportsMultiCard bool   // Whether the browser shows more than the first card of a deck
+	MaxDeckSize       int    // Largest deck in bytes the device accepts
+	ImageFormat       string // "wbmp" or "jpeg", empty to choose by the Accept header
+}
+
+// DeviceRule gives the devices whose lowercase User-Agent contains UA a profile
+type DeviceRule struct {
+	UA      string
+	Profile DeviceProfile
+}
+
+// defaultMaxDeckSize is used for devices missing from deviceRules. It is the
+// Nokia 7110 limit, which is about the smallest in common use.
+const defaultMaxDeckSize = 1397
+
+// defaultDeviceProfile is the profile of devices no rule matches. Most WAP browsers
+// support tables, fieldsets and WBMP images.
+var defaultDeviceProfile = DeviceProfile{
+	SupportsTables:    true,
+	SupportsFieldsets: true,
+	SupportsImages:    true,
+	MaxDeckSize:       defaultMaxDeckSize,
+}
+
+// deviceProfileFor returns defaultDeviceProfile with a different deck size limit
+func deviceProfileFor(maxDeckSize int) DeviceProfile {
+	profile := defaultDeviceProfile
+	profile.MaxDeckSize = maxDeckSize
+	return profile
+}
+
+// deviceRules are the built-in device profiles. Rules from Config.DeviceRules are tried
+// first, then these. The first match wins, so more specific entries come first.
+var deviceRules = []DeviceRule{
+	// Early Nokia 7110 firmware has no WML tables or fieldsets
+	{"nokia7110/1.0", DeviceProfile{SupportsImages: true, MaxDeckSize: 1397}},
+	{"nokia7110", deviceProfileFor(1397)},
+	{"nokia6210", deviceProfileFor(2800)},
+	{"nokia6250", deviceProfileFor(2800)},
+	{"nokia3330", deviceProfileFor(2800)},
+	{"nokia", deviceProfileFor(2800)},
+	{"ericssonr380", deviceProfileFor(3500)},
+	{"ericsson", deviceProfileFor(3000)},
+	{"sie-", deviceProfileFor(2000)},
+	{"mot-", deviceProfileFor(1400)},
+	{"up.browser", deviceProfileFor(1492)},
+	{"winwap", multiCardProfileFor(32000)},
+	{"opera", multiCardProfileFor(32000)},
+}
+
+// multiCardProfileFor returns deviceProfileFor(maxDeckSize) for a browser known to show
+// every card of a deck
+func multiCardProfileFor(maxDeckSize int) DeviceProfile {
+	profile := deviceProfileFor(maxDeckSize)
+	profile.SupportsMultiCard = true
+	return profile
+}
+
+// resolveDeviceProfile returns the profile of the device sending userAgent and accept
+func resolveDeviceProfile(userAgent, accept string) DeviceProfile {
 	ua := strings.ToLower(userAgent)
-	return strings.Contains(ua, "nokia7110/1.0")
+	profile := defaultDeviceProfile
+	for _, rule := range slices.Concat(config.DeviceRules, deviceRules) {
+		if strings.Contains(ua, rule.UA) {
+			profile = rule.Profile
+			break
+		}
+	}
+	if profile.ImageFormat == "" {
+		profile.ImageFormat = "wbmp"
+		if strings.Contains(accept, "image/jpeg") {
+			profile.ImageFormat = "jpeg"
+		}
+	}
+	return profile
+}
+
+// deviceProfileKey is the echo context key getDeviceProfile keeps the profile under
+const deviceProfileKey = "deviceProfile"
+
+// getDeviceProfile returns the profile of the device making the request, resolved once
+// per request
+func getDeviceProfile(c echo.Context) DeviceProfile {
+	if profile, ok := c.Get(deviceProfileKey).(DeviceProfile); ok {
+		return profile
+	}
+	profile := resolveDeviceProfile(c.Request().Header.Get("User-Agent"), c.Request().Header.Get("Accept"))
+	c.Set(deviceProfileKey, profile)
+	return profile
+}
+
+// ParseDeviceRule parses a device rule of the form "ua:key=value,...", for the serve
+// command. Keys are tables, fieldsets, images and cards (true or false), deck (bytes) and
+// format (wbmp or jpeg). Keys left out keep the values of devices no rule matches.
+func ParseDeviceRule(s string) (DeviceRule, error) {
+	ua, settings, _ := strings.Cut(s, ":")
+	ua = strings.ToLower(strings.TrimSpace(ua))
+	if ua == "" {
+		return DeviceRule{}, fmt.Errorf("device rule %q has no User-Agent", s)
+	}
+
+	rule := DeviceRule{UA: ua, Profile: defaultDeviceProfile}
+	for _, setting := range strings.Split(settings, ",") {
+		if strings.TrimSpace(setting) == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(setting, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "tables":
+			rule.Profile.SupportsTables, err = strconv.ParseBool(value)
+		case "fieldsets":
+			rule.Profile.SupportsFieldsets, err = strconv.ParseBool(value)
+		case "images":
+			rule.Profile.SupportsImages, err = strconv.ParseBool(value)
+		case "cards":
+			rule.Profile.SupportsMultiCard, err = strconv.ParseBool(value)
+		case "deck":
+			rule.Profile.MaxDeckSize, err = strconv.Atoi(value)
+			if err == nil && rule.Profile.MaxDeckSize <= 0 {
+				err = errors.New("must be positive")
+			}
+		case "format":
+			if value != "wbmp" && value != "jpeg" {
+				err = errors.New("must be wbmp or jpeg")
+			}
+			rule.Profile.ImageFormat = value
+		default:
+			return DeviceRule{}, fmt.Errorf("device rule %q: unknown key %q", s, key)
+		}
+		if err != nil {
+			return DeviceRule{}, fmt.Errorf("device rule %q: invalid %s %q: %v", s, key, value, err)
+		}
+	}
+	return rule, nil
 }
 
 // getRenderOptions returns rendering options based on the device
 func getRenderOptions(c echo.Context) wikipedia.RenderOptions {
-	userAgent := c.Request().Header.Get("User-Agent")
+	profile := getDeviceProfile(c)
 
-	// Nokia 7110 doesn't support WML tables
-	if isNokia7110(userAgent) {
-		return wikipedia.RenderOptions{SupportsTables: false}
+	// WAP 2.0 browsers get XHTML-MP, which replaces WML tables and fieldsets
+	if acceptsXHTMLMP(c.Request().Header.Get("Accept")) {
+		return wikipedia.RenderOptions{
+			Mode:              wikipedia.RenderXHTMLMP,
+			SupportsImages:    profile.SupportsImages,
+			MaxDeckSize:       profile.MaxDeckSize,
+			SkipCollapsed:     config.SkipCollapsed,
+			KeepHatnote:       config.KeepHatnote,
+			KeepExternalLinks: config.KeepExternalLinks,
+			FollowRedirects:   true,
+		}
 	}
 
-	// Most other WAP browsers support tables
-	return wikipedia.RenderOptions{SupportsTables: true}
+	return wikipedia.RenderOptions{
+		SupportsTables:    profile.SupportsTables,
+		SupportsFieldsets: profile.SupportsFieldsets,
+		SupportsImages:    profile.SupportsImages,
+		MaxDeckSize:       profile.MaxDeckSize,
+		SkipCollapsed:     config.SkipCollapsed,
+		KeepHatnote:       config.KeepHatnote,
+		KeepExternalLinks: config.KeepExternalLinks,
+		UseSoftKeys:       config.SoftKeys,
+		FollowRedirects:   true,
+	}
+}
+
+// pageContentSize returns the content budget per article page for the device
+func pageContentSize(opts wikipedia.RenderOptions) int {
+	maxDeckSize := opts.MaxDeckSize
+	if maxDeckSize <= 0 {
+		maxDeckSize = defaultMaxDeckSize
+	}
+	overhead := deckOverheadBytes
+	if useAccessKeys(opts) {
+		overhead += maxAccessKeys * len(` accesskey="9"`)
+	}
+	return max(maxDeckSize-overhead, minPageContentBytes)
+}
+
+// maxAccessKeys is the number of links per deck given the digits 1-9 as access keys
+const maxAccessKeys = 9
+
+// reArticleLink matches the opening tag of the article links convertHTMLLinksToWML writes
+var reArticleLink = regexp.MustCompile(`<a href="/article\?id=[^"]*">`)
+
+// useAccessKeys reports whether article links rendered with opts get access keys. The
+// XHTML-MP template binds digits to its own page navigation.
+func useAccessKeys(opts wikipedia.RenderOptions) bool {
+	return config.AccessKeys && opts.Mode == wikipedia.RenderWML
+}
+
+// addAccessKeys gives the first nine article links in a page of content the access keys
+// 1 to 9, in order
+func addAccessKeys(content string) string {
+	n := 0
+	return reArticleLink.ReplaceAllStringFunc(content, func(link string) string {
+		if n == maxAccessKeys {
+			return link
+		}
+		n++
+		return fmt.Sprintf(`%s accesskey="%d">`, strings.TrimSuffix(link, ">"), n)
+	})
+}
+
+// isArticleEntry reports whether a ZIM entry can be rendered as an article.
+// Images, stylesheets and other resources share the index space with articles.
+func isArticleEntry(entry *wikipedia.DirectoryEntry, mimeType string) bool {
+	if entry.IsRedirect {
+		return true
+	}
+	return wikipedia.IsContentArticle(entry) && strings.Contains(mimeType, "html")
 }
 
 // escapeWMLAttr escapes a string for use in WML attributes
@@ -37,3 +272,58 @@ func escapeWMLAttr(s string) string {
 	s = strings.ReplaceAll(s, "$", "$$")
 	return s
 }
+
+// maxAgeSeconds converts a cache lifetime to the seconds used in WML cache directives
+func maxAgeSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(d / time.Second)
+}
+
+// contentETag returns an ETag for a response rendered from the loaded ZIM files and
+// the given parts, so it changes when any part or any ZIM file does
+func contentETag(parts ...interface{}) string {
+	h := fnv.New64a()
+	fmt.Fprint(h, contentVersion)
+	for _, part := range parts {
+		fmt.Fprintf(h, "|%v", part)
+	}
+	return fmt.Sprintf("\"%016x\"", h.Sum64())
+}
+
+// checkNotModified sets the ETag header and reports whether the client's
+// If-None-Match already holds it
+func checkNotModified(c echo.Context, etag string) bool {
+	c.Response().Header().Set("ETag", etag)
+	ifNoneMatch := c.Request().Header.Get("If-None-Match")
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// limitRequestTime gives every request context config.RequestTimeout, so searches and article
+// fetches abandoned by a slow device or an overloaded server don't run on
+func limitRequestTime(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx, cancel := withRequestTimeout(c.Request().Context())
+		defer cancel()
+		c.SetRequest(c.Request().WithContext(ctx))
+		return next(c)
+	}
+}
+
+// withRequestTimeout returns parent with config.RequestTimeout, if one is set
+func withRequestTimeout(parent context.Context) (context.Context, context.CancelFunc) {
+	if config.RequestTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, config.RequestTimeout)
+}
@@ -0,0 +1,34 @@
+package server
+
+import "testing"
+
+func TestAcceptsXHTMLMP(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   bool
+	}{
+		{"empty", "", false},
+		{"WML only", "text/vnd.wap.wml, image/vnd.wap.wbmp", false},
+		{"wildcard", "*/*", false},
+		{"listed", "text/vnd.wap.wml, application/vnd.wap.xhtml+xml", true},
+		{"upper case", "Application/VND.WAP.XHTML+XML", true},
+		{"quality", "application/vnd.wap.xhtml+xml;q=0.8", true},
+		{"level", "application/vnd.wap.xhtml+xml; level=1", true},
+		{"refused", "application/vnd.wap.xhtml+xml;q=0", false},
+		{"refused with decimals", "application/vnd.wap.xhtml+xml; q=0.000", false},
+		{"refused after level", "application/vnd.wap.xhtml+xml;level=1;q=0", false},
+		{"refused before level", "application/vnd.wap.xhtml+xml;q=0;level=1", false},
+		{"refused with spaces", "application/vnd.wap.xhtml+xml ; Q = 0 ; level=1", false},
+		{"unreadable quality", "application/vnd.wap.xhtml+xml;q=high", false},
+		{"refused then accepted", "application/vnd.wap.xhtml+xml;q=0, text/vnd.wap.wml, application/vnd.wap.xhtml+xml;level=1;q=0.5", true},
+		{"refused twice", "application/vnd.wap.xhtml+xml;q=0, application/vnd.wap.xhtml+xml;level=1;q=0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acceptsXHTMLMP(tt.accept); got != tt.want {
+				t.Errorf("acceptsXHTMLMP(%q) = %v, want %v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// articleCacheLogKey is the echo context key handlers set to "hit" or "miss" for the
+// rendered article cache, picked up by logRequests
+const articleCacheLogKey = "article_cache"
+
+// logRequests emits a structured record per request when config.RequestLogs is set
+func logRequests(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !config.RequestLogs {
+			return next(c)
+		}
+
+		start := time.Now()
+		if err := next(c); err != nil {
+			// Let echo write the error response now so its status gets logged
+			c.Error(err)
+		}
+
+		req := c.Request()
+		attrs := []slog.Attr{
+			slog.String("method", req.Method),
+			slog.String("path", req.URL.Path),
+			slog.Int("status", c.Response().Status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("user_agent", req.UserAgent()),
+		}
+		if id := c.QueryParam("id"); id != "" {
+			attrs = append(attrs, slog.String("article_id", id))
+		}
+		if cache, ok := c.Get(articleCacheLogKey).(string); ok {
+			attrs = append(attrs, slog.String("article_cache", cache))
+		}
+		slog.LogAttrs(req.Context(), slog.LevelInfo, "request", attrs...)
+		return nil
+	}
+}
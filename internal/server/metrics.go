@@ -0,0 +1,220 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bevelgacom/wapipedia/pkg/wikipedia"
+	"github.com/labstack/echo/v4"
+)
+
+// latencyBuckets are the histogram bucket bounds in seconds, from cache hits up to
+// articles decompressed from a cold cluster on slow storage
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics served at /metrics in the Prometheus text format
+var (
+	requestsTotal = newCounterVec("wapipedia_http_requests_total",
+		"HTTP requests by route and status code.", "route", "code")
+	requestDuration = newHistogramVec("wapipedia_http_request_duration_seconds",
+		"Time to answer HTTP requests by route.", "route")
+	articleFetchDuration = newHistogramVec("wapipedia_article_fetch_duration_seconds",
+		"Time to read and render an article, by rendered article cache result.", "cache")
+	imageConversionDuration = newHistogramVec("wapipedia_image_conversion_duration_seconds",
+		"Time to convert an image for devices, by output format.", "format")
+	searchDuration = newHistogramVec("wapipedia_search_duration_seconds",
+		"Time to run a search query.", "")
+)
+
+// counterVec is a counter with one series per combination of label values
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]uint64 // keyed by the formatted label set
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, series: make(map[string]uint64)}
+}
+
+func (v *counterVec) inc(values ...string) {
+	key := formatLabels(v.labels, values)
+	v.mu.Lock()
+	v.series[key]++
+	v.mu.Unlock()
+}
+
+func (v *counterVec) write(b *strings.Builder) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", v.name, v.help, v.name)
+	for _, key := range sortedKeys(v.series) {
+		fmt.Fprintf(b, "%s%s %d\n", v.name, key, v.series[key])
+	}
+}
+
+// histogram holds the observations of one series, counts are per bucket and not cumulative
+type histogram struct {
+	counts []uint64 // one per latencyBuckets bound, plus +Inf
+	sum    float64
+	count  uint64
+}
+
+// histogramVec is a latency histogram with one series per value of its label, or a
+// single series if the label name is empty
+type histogramVec struct {
+	name, help, label string
+
+	mu     sync.Mutex
+	series map[string]*histogram // keyed by label value
+}
+
+func newHistogramVec(name, help, label string) *histogramVec {
+	return &histogramVec{name: name, help: help, label: label, series: make(map[string]*histogram)}
+}
+
+func (v *histogramVec) observe(value string, d time.Duration) {
+	seconds := d.Seconds()
+	bucket := sort.SearchFloat64s(latencyBuckets, seconds)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h, ok := v.series[value]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets)+1)}
+		v.series[value] = h
+	}
+	h.counts[bucket]++
+	h.sum += seconds
+	h.count++
+}
+
+func (v *histogramVec) write(b *strings.Builder) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", v.name, v.help, v.name)
+	for _, value := range sortedKeys(v.series) {
+		h := v.series[value]
+		names, values := []string{"le"}, []string{""}
+		if v.label != "" {
+			names, values = []string{v.label, "le"}, []string{value, ""}
+		}
+
+		var cumulative uint64
+		for i, count := range h.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(latencyBuckets) {
+				le = strconv.FormatFloat(latencyBuckets[i], 'g', -1, 64)
+			}
+			values[len(values)-1] = le
+			fmt.Fprintf(b, "%s_bucket%s %d\n", v.name, formatLabels(names, values), cumulative)
+		}
+		labels := formatLabels(names[:len(names)-1], values[:len(values)-1])
+		fmt.Fprintf(b, "%s_sum%s %g\n", v.name, labels, h.sum)
+		fmt.Fprintf(b, "%s_count%s %d\n", v.name, labels, h.count)
+	}
+}
+
+// formatLabels formats label pairs as {name="value",...}, or "" without labels
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escape.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// measureRequests counts requests and their latency per route
+func measureRequests(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		if err := next(c); err != nil {
+			// Let echo write the error response now so its status gets counted
+			c.Error(err)
+		}
+
+		route := c.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+		requestsTotal.inc(route, strconv.Itoa(c.Response().Status))
+		requestDuration.observe(route, time.Since(start))
+		return nil
+	}
+}
+
+// serveMetrics serves request, latency and cache metrics in the Prometheus text format
+func serveMetrics(c echo.Context) error {
+	var b strings.Builder
+	requestsTotal.write(&b)
+	requestDuration.write(&b)
+	articleFetchDuration.write(&b)
+	imageConversionDuration.write(&b)
+	searchDuration.write(&b)
+
+	if wikis != nil {
+		writeWikiMetrics(&b)
+	}
+
+	return c.Blob(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+// wikiMetrics are the cache metrics of one loaded wiki at scrape time
+type wikiMetrics struct {
+	name         string
+	stats        wikipedia.ZIMReaderStats
+	articles     int
+	articleBytes int
+}
+
+// writeWikiMetrics writes the cluster and article cache metrics of every loaded wiki
+func writeWikiMetrics(b *strings.Builder) {
+	var all []wikiMetrics
+	for _, name := range wikis.Names() {
+		w, _ := wikis.Get(name)
+		articles, articleBytes := w.ArticleCacheSize()
+		all = append(all, wikiMetrics{name: name, stats: w.Stats(), articles: articles, articleBytes: articleBytes})
+	}
+
+	write := func(name, help, kind string, value func(m wikiMetrics) float64) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, m := range all {
+			fmt.Fprintf(b, "%s%s %g\n", name, formatLabels([]string{"wiki"}, []string{wikiLabel(m.name)}), value(m))
+		}
+	}
+	write("wapipedia_cluster_cache_hits_total", "Cluster reads answered from the cluster cache.", "counter",
+		func(m wikiMetrics) float64 { return float64(m.stats.CacheHits) })
+	write("wapipedia_cluster_cache_misses_total", "Cluster reads that had to decompress the cluster.", "counter",
+		func(m wikiMetrics) float64 { return float64(m.stats.CacheMisses) })
+	write("wapipedia_cluster_cache_clusters", "Decompressed clusters in the cluster cache.", "gauge",
+		func(m wikiMetrics) float64 { return float64(m.stats.CachedClusters) })
+	write("wapipedia_cluster_cache_bytes", "Size of the decompressed clusters in the cluster cache.", "gauge",
+		func(m wikiMetrics) float64 { return float64(m.stats.CachedBytes) })
+	write("wapipedia_article_cache_articles", "Rendered articles in the article cache.", "gauge",
+		func(m wikiMetrics) float64 { return float64(m.articles) })
+	write("wapipedia_article_cache_bytes", "Size of the rendered articles in the article cache.", "gauge",
+		func(m wikiMetrics) float64 { return float64(m.articleBytes) })
+}
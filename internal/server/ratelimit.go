@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitMode selects which requests share a rate limit bucket
+type RateLimitMode string
+
+const (
+	// RateLimitGlobal puts every request in one bucket, for deployments behind a
+	// WAP gateway such as Kannel where all requests come from the same address
+	RateLimitGlobal RateLimitMode = "global"
+	// RateLimitIP gives every client IP address its own bucket
+	RateLimitIP RateLimitMode = "ip"
+	// RateLimitHeader gives every subscriber forwarded by the gateway its own bucket,
+	// falling back to the client IP address for requests without a subscriber header
+	RateLimitHeader RateLimitMode = "header"
+)
+
+// subscriberHeaders are the headers WAP gateways use to forward the subscriber's
+// phone number, in order of preference
+var subscriberHeaders = []string{"X-Up-Calling-Line-Id", "X-MSISDN"}
+
+// ParseRateLimitMode returns the rate limit mode named s
+func ParseRateLimitMode(s string) (RateLimitMode, bool) {
+	switch mode := RateLimitMode(s); mode {
+	case RateLimitGlobal, RateLimitIP, RateLimitHeader:
+		return mode, true
+	}
+	return "", false
+}
+
+// rateLimitIdentifier returns the bucket a request is counted in
+func rateLimitIdentifier(c echo.Context) (string, error) {
+	switch config.RateLimitMode {
+	case RateLimitIP:
+		return "ip:" + c.RealIP(), nil
+	case RateLimitHeader:
+		for _, header := range subscriberHeaders {
+			if subscriber := c.Request().Header.Get(header); subscriber != "" {
+				return "subscriber:" + subscriber, nil
+			}
+		}
+		return "ip:" + c.RealIP(), nil
+	}
+	return "global", nil
+}
+
+// rateLimiter returns the rate limiting middleware for the configured mode, rate and burst
+func rateLimiter() echo.MiddlewareFunc {
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		// Monitoring scrapes shouldn't use up the request budget of devices
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/metrics" || config.RateLimitRate <= 0
+		},
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(
+			middleware.RateLimiterMemoryStoreConfig{
+				Rate:      rate.Limit(config.RateLimitRate),
+				Burst:     config.RateLimitBurst,
+				ExpiresIn: 3 * time.Minute,
+			},
+		),
+		IdentifierExtractor: rateLimitIdentifier,
+		ErrorHandler: func(context echo.Context, err error) error {
+			return serveRouteError(context, http.StatusForbidden, "Error", "Your request could not be identified.")
+		},
+		DenyHandler: func(context echo.Context, identifier string, err error) error {
+			return serveRouteError(context, http.StatusTooManyRequests, "Too Busy", "Whelp we are a bit overloaded. Please try again later.")
+		},
+	})
+}
@@ -1,10 +1,18 @@
 package server
 
 import (
-	"log"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	goimage "image"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,12 +22,27 @@ import (
 	image "github.com/bevelgacom/wapipedia/pkg/wbmp"
 	"github.com/bevelgacom/wapipedia/pkg/wikipedia"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	"golang.org/x/time/rate"
 )
 
-// Global Wikipedia instance
-var wiki *wikipedia.Wikipedia
+// Deck size budget: the card around the article content takes part of the device's
+// deck limit, and pages never get smaller than minPageContentBytes. The links and
+// actions cards of a multi-card deck take multiCardOverheadBytes besides their links.
+const (
+	deckOverheadBytes      = 400
+	minPageContentBytes    = 400
+	multiCardOverheadBytes = 400
+)
+
+// Loaded Wikipedia instances, and the default one serving unprefixed IDs, the home
+// page and random articles
+var (
+	wiki     *wikipedia.Wikipedia
+	wikis    *wikipedia.MultiWikipedia
+	wikiInfo *wikipedia.ZIMInfo // metadata of the default wiki, nil if it has none
+
+	// contentVersion identifies the loaded ZIM files in ETags
+	contentVersion string
+)
 
 // Random ID cache
 const randomIDCacheSize = 50
@@ -34,33 +57,157 @@ var (
 type WikiHome struct {
 	ArticleCount uint32
 	RandomID     uint32
+	Title        string // title of the default ZIM, empty if it has none
+	Language     string
 }
 
 // WikiSearch represents search results page data
 type WikiSearch struct {
-	Query        string
-	QueryEncoded string
-	Results      []wikipedia.SearchResult
-	ShowMore     bool
-	NextOffset   int
+	Query         string
+	QueryEncoded  string
+	Results       []WikiSearchResult
+	ShowMore      bool
+	NextOffset    int
+	First         int // 1-based position of the first result shown
+	Last          int
+	Total         int
+	Suggestion    string // "did you mean" title when nothing was found
+	SuggestionURL string
+	CacheMaxAge   int // seconds the deck may be cached on the device, 0 for no caching
+}
+
+// WikiSearchResult is a search result numbered by its place on the page
+type WikiSearchResult struct {
+	wikipedia.SearchResult
+	Number    int // 1 for the first result on the page
+	AccessKey int // digit selecting the result, 0 for none
+}
+
+// WikiSuggest represents the title completions of a prefix
+type WikiSuggest struct {
+	Query       string
+	Titles      []WikiSuggestion
+	CacheMaxAge int // seconds the deck may be cached on the device, 0 for no caching
+}
+
+// WikiSuggestion is a completed title, linking to its search
+type WikiSuggestion struct {
+	Title        string
+	TitleEncoded string
 }
 
 // WikiArticle represents article page data
 type WikiArticle struct {
-	Index          uint32
+	ID             string
 	Title          string
 	Content        string
 	ShowMore       bool
 	NextPage       int
+	ShowPrev       bool
+	PrevPage       int
 	HasInfobox     bool
+	HasSections    bool
+	ShowRelated    bool // link to the related articles, on the first page
 	SupportsTables bool
+	UseSoftKeys    bool
+	CacheMaxAge    int               // seconds the deck may be cached on the device, 0 for no caching
+	MultiCard      bool              // the deck has links and actions cards after the article
+	Links          []WikiArticleLink // related articles for the links card of a multi-card deck
+}
+
+// WikiTOC represents the table of contents page data
+type WikiTOC struct {
+	ID          string
+	Title       string
+	Sections    []WikiSection
+	CacheMaxAge int
+}
+
+// WikiSection represents one entry of the table of contents
+type WikiSection struct {
+	Number int
+	Title  string
+	Indent bool
 }
 
 // WikiInfobox represents infobox page data
 type WikiInfobox struct {
-	Index   uint32
-	Title   string
-	Content string
+	ID          string
+	Title       string
+	Content     string
+	CacheMaxAge int
+}
+
+// WikiSummary represents the article preview page data
+type WikiSummary struct {
+	ID          string
+	Title       string
+	Summary     string
+	CacheMaxAge int
+}
+
+// WikiRelated represents the related articles page data
+type WikiRelated struct {
+	ID          string
+	Title       string
+	Results     []wikipedia.SearchResult
+	CacheMaxAge int
+}
+
+// WikiLoading represents the "still loading" page data
+type WikiLoading struct {
+	RetryURL   string
+	RetryTimer int // WML timer value in tenths of a second, 0 for no automatic retry
+}
+
+// WikiNotArticle represents the page shown when a non-article entry is requested
+type WikiNotArticle struct {
+	ID       string
+	URL      string
+	MimeType string
+	IsImage  bool
+}
+
+// WikiArticleList represents a page of the article listing
+type WikiArticleList struct {
+	Articles   []WikiArticleLink
+	Wiki       string // name of the listed wiki, passed on to the next page
+	ShowMore   bool
+	NextOffset uint32
+	Limit      int
+}
+
+// WikiArticleLink is an article in the article listing
+type WikiArticleLink struct {
+	ID    string
+	Title string
+	URL   string // empty when it only repeats the title
+}
+
+// WikiBrowse represents a page of the alphabetical title listing
+type WikiBrowse struct {
+	Prefix        string // escaped for display
+	PrefixEncoded string
+	Letters       []string // shown instead of articles when no prefix is given
+	Articles      []WikiArticleLink
+	Wiki          string // name of the browsed wiki, passed on to the next page
+	NextEncoded   string // title the next page starts at, empty on the last page
+	Limit         int
+}
+
+// WikiCategory represents a page of the category listing, or of the articles in a category
+type WikiCategory struct {
+	Name       string // escaped for display, empty when listing categories
+	Categories []WikiCategoryLink
+	Articles   []WikiArticleLink
+	Wiki       string // name of the listed wiki, passed on to the next page
+	Query      string // query string of the next page, empty on the last page
+}
+
+// WikiCategoryLink is a category in the category listing
+type WikiCategoryLink struct {
+	Name        string
+	NameEncoded string
 }
 
 // WikiError represents error page data
@@ -70,12 +217,53 @@ type WikiError struct {
 }
 
 // InitWikipedia initializes the Wikipedia reader with optional pre-built search index
-func InitWikipedia(zimPath string) error {
-	var err error
-	// Use NewWikipediaWithIndex to load pre-built Bluge index if available
-	wiki, err = wikipedia.NewWikipediaWithIndex(zimPath, "")
-	if err != nil {
-		return err
+func InitWikipedia(zimPath string, opts wikipedia.ZIMReaderOptions) error {
+	return InitWikipedias([]string{zimPath}, opts)
+}
+
+// InitWikipedias loads several ZIM files side by side. With more than one, article and
+// image IDs are prefixed with a name derived from the file name (e.g. "en:1234").
+// The first ZIM is the default for unprefixed IDs, the home page and random articles.
+func InitWikipedias(zimPaths []string, opts wikipedia.ZIMReaderOptions) error {
+	loaded := wikipedia.NewMultiWikipedia()
+	for _, zimPath := range zimPaths {
+		// Use NewWikipediaWithOptions to load pre-built Bluge index if available
+		w, err := wikipedia.NewWikipediaWithOptions(zimPath, "", opts)
+		if err != nil {
+			loaded.Close()
+			return err
+		}
+
+		name := ""
+		if len(zimPaths) > 1 {
+			name = wikipedia.WikiNameFromPath(zimPath)
+			if _, exists := loaded.Get(name); exists {
+				name = strings.TrimSuffix(filepath.Base(zimPath), filepath.Ext(zimPath))
+			}
+		}
+		if err := loaded.Add(name, w); err != nil {
+			w.Close()
+			loaded.Close()
+			return err
+		}
+		slog.Info("Loaded wiki", "zim", zimPath, "wiki", name)
+	}
+	wikis = loaded
+	wiki = loaded.Default()
+
+	var versions []string
+	for _, name := range loaded.Names() {
+		w, _ := loaded.Get(name)
+		versions = append(versions, name+"="+w.UUID())
+	}
+	contentVersion = strings.Join(versions, ",")
+
+	wikiInfo = nil
+	if info, err := wiki.GetInfo(); err == nil {
+		slog.Info("ZIM metadata", "title", info.Title, "language", info.Language, "date", info.Date)
+		wikiInfo = info
+	} else {
+		slog.Info("No ZIM metadata", "error", err)
 	}
 
 	// Set global wiki reference for image ID lookups during HTML conversion
@@ -87,44 +275,49 @@ func InitWikipedia(zimPath string) error {
 	return nil
 }
 
+// CloseWikipedia closes the loaded ZIM files and search indexes. Handlers must no
+// longer be running, e.g. after the echo server has been shut down.
+func CloseWikipedia() error {
+	if wikis == nil {
+		return nil
+	}
+	return wikis.Close()
+}
+
 // initRandomIDCache initializes the random ID cache and starts the background refill goroutine
 func initRandomIDCache() {
-	log.Printf("Initializing random ID cache with size %d", randomIDCacheSize)
+	slog.Debug("Initializing random ID cache", "size", randomIDCacheSize)
 	randomIDCache = make([]uint32, 0, randomIDCacheSize)
 	randomIDRefill = make(chan struct{}, randomIDCacheSize)
 
 	// Pre-fill the cache
-	log.Println("Starting initial random ID cache fill")
 	go fillRandomIDCache(randomIDCacheSize)
 
 	// Start background refill goroutine
-	log.Println("Starting random ID refill worker")
 	go randomIDRefillWorker()
 }
 
 // fillRandomIDCache fills the cache with random article IDs
 func fillRandomIDCache(count int) {
-	log.Printf("Filling random ID cache with %d entries", count)
+	slog.Debug("Filling random ID cache", "count", count)
 	filled := 0
 	for i := 0; i < count; i++ {
-		if article, err := wiki.GetRandomArticle(); err == nil {
+		if idx, err := wiki.GetRandomArticleIndex(); err == nil {
 			randomIDMutex.Lock()
-			randomIDCache = append(randomIDCache, article.Index)
+			randomIDCache = append(randomIDCache, idx)
 			filled++
-			log.Printf("Added random article ID %d to cache, new size: %d", article.Index, len(randomIDCache))
+			slog.Debug("Added random article ID to cache", "article_id", idx, "size", len(randomIDCache))
 			randomIDMutex.Unlock()
 		} else {
-			log.Printf("Error getting random article for cache: %v", err)
+			slog.Warn("Failed to get random article for cache", "error", err)
 		}
 	}
-	log.Printf("Filled %d random IDs, cache size now: %d", filled, len(randomIDCache))
+	slog.Debug("Filled random ID cache", "filled", filled, "size", len(randomIDCache))
 }
 
 // randomIDRefillWorker is a background goroutine that refills the cache when signaled
 func randomIDRefillWorker() {
-	log.Println("Random ID refill worker started")
 	for range randomIDRefill {
-		log.Printf("Refill signal received, cache size: %d", len(randomIDCache))
 		fillRandomIDCache(1)
 	}
 }
@@ -135,22 +328,20 @@ func getRandomIDFromCache() (uint32, bool) {
 	defer randomIDMutex.Unlock()
 
 	if len(randomIDCache) == 0 {
-		log.Println("Random ID cache is empty")
+		slog.Debug("Random ID cache is empty")
 		return 0, false
 	}
 
 	// Pop the last ID from the cache
 	id := randomIDCache[len(randomIDCache)-1]
 	randomIDCache = randomIDCache[:len(randomIDCache)-1]
-	log.Printf("Got random ID %d from cache, remaining: %d", id, len(randomIDCache))
+	slog.Debug("Got random ID from cache", "article_id", id, "remaining", len(randomIDCache))
 
 	// Signal the refill goroutine (non-blocking)
 	select {
 	case randomIDRefill <- struct{}{}:
-		log.Println("Signaled refill worker")
 	default:
 		// Channel is full, refill already pending
-		log.Println("Refill channel full, skipping signal")
 	}
 
 	return id, true
@@ -158,10 +349,8 @@ func getRandomIDFromCache() (uint32, bool) {
 
 // serveWikiHome serves the Wikipedia home page
 func serveWikiHome(c echo.Context) error {
-	log.Printf("Serving home page, User-Agent: %s", c.Request().UserAgent())
 	if wiki == nil {
-		log.Println("Wiki not initialized, returning error")
-		return serveWikiError(c, "Not Available", "Wikipedia data is not loaded. Please download a Wikipedia dump first.")
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded. Please download a Wikipedia dump first.")
 	}
 
 	// Get a random article ID from the cache
@@ -170,30 +359,33 @@ func serveWikiHome(c echo.Context) error {
 		randomID = id
 	} else if article, err := wiki.GetRandomArticle(); err == nil {
 		// Fallback if cache is empty
-		log.Printf("Cache miss, fetched random article %d directly", article.Index)
+		slog.Debug("Random ID cache miss, fetched random article directly", "article_id", article.Index)
 		randomID = article.Index
 	}
 
 	data := WikiHome{
 		RandomID: randomID,
 	}
+	if wikiInfo != nil {
+		data.Title = wikipedia.FormatTitle(wikiInfo.Title)
+		data.Language = wikipedia.FormatTitle(wikiInfo.Language)
+	}
 
+	// The random article link changes on every visit, devices keep the deck otherwise
 	tmpl := template.Must(template.ParseFiles("./static/home.wml"))
 	c.Response().Header().Set("Content-Type", "text/vnd.wap.wml")
+	c.Response().Header().Set("Cache-Control", "no-cache")
 	return tmpl.Execute(c.Response().Writer, data)
 }
 
 // serveWikiSearch serves search results
 func serveWikiSearch(c echo.Context) error {
 	if wiki == nil {
-		log.Println("Search request but wiki not initialized")
-		return serveWikiError(c, "Not Available", "Wikipedia data is not loaded.")
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded.")
 	}
 
 	query := c.QueryParam("q")
-	log.Printf("Search request: q=%q, User-Agent: %s", query, c.Request().UserAgent())
 	if query == "" {
-		log.Println("Empty search query, redirecting to home")
 		return c.Redirect(http.StatusFound, "/")
 	}
 
@@ -206,39 +398,58 @@ func serveWikiSearch(c echo.Context) error {
 		}
 	}
 
+	if offset < 0 {
+		offset = 0
+	}
+
 	maxResults := 10
-	log.Printf("Searching for %q with offset %d", query, offset)
-	results, err := wiki.Search(query, maxResults+offset+1)
+	slog.Debug("Searching", "query", query, "offset", offset)
+	searchStart := time.Now()
+	results, total, err := wikis.SearchWithOffset(c.Request().Context(), query, offset, maxResults)
+	searchDuration.observe("", time.Since(searchStart))
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("Search timed out", "query", query, "timeout", config.RequestTimeout)
+		return serveWikiError(c, http.StatusServiceUnavailable, "Search Timed Out", "The search took too long, please try again.")
+	}
 	if err != nil {
-		log.Printf("Search error for %q: %v", query, err)
-		return serveWikiError(c, "Search Error", "An error occurred while searching.")
+		slog.Error("Search failed", "query", query, "error", err)
+		return serveWikiError(c, http.StatusInternalServerError, "Search Error", "An error occurred while searching.")
 	}
-	log.Printf("Search for %q returned %d results", query, len(results))
-
-	// Apply offset and limit
-	showMore := false
-	if offset < len(results) {
-		if offset+maxResults < len(results) {
-			showMore = true
-			results = results[offset : offset+maxResults]
-		} else {
-			results = results[offset:]
+	slog.Debug("Search done", "query", query, "results", len(results), "total", total)
+	showMore := offset+len(results) < total
+
+	// Offer a spelling suggestion instead of a dead end
+	suggestion := ""
+	if total == 0 {
+		if suggestion, err = wikis.Suggest(query); err != nil {
+			slog.Warn("Suggest failed", "query", query, "error", err)
 		}
-	} else {
-		results = []wikipedia.SearchResult{}
 	}
 
-	// Escape titles for WML
+	// Escape titles and snippets for WML
 	for i := range results {
 		results[i].Title = wikipedia.FormatTitle(results[i].Title)
+		results[i].Snippet = strings.ReplaceAll(results[i].Snippet, "$", "$$")
 	}
 
 	data := WikiSearch{
-		Query:        escapeWMLAttr(query),
-		QueryEncoded: url.QueryEscape(query),
-		Results:      results,
-		ShowMore:     showMore,
-		NextOffset:   offset + maxResults,
+		Query:         escapeWMLAttr(query),
+		QueryEncoded:  url.QueryEscape(query),
+		ShowMore:      showMore,
+		NextOffset:    offset + maxResults,
+		First:         offset + 1,
+		Last:          offset + len(results),
+		Total:         total,
+		Suggestion:    wikipedia.FormatTitle(suggestion),
+		SuggestionURL: url.QueryEscape(suggestion),
+		CacheMaxAge:   maxAgeSeconds(config.SearchMaxAge),
+	}
+	for i, result := range results {
+		numbered := WikiSearchResult{SearchResult: result, Number: i + 1}
+		if config.AccessKeys && i < maxAccessKeys {
+			numbered.AccessKey = i + 1
+		}
+		data.Results = append(data.Results, numbered)
 	}
 
 	tmpl := template.Must(template.ParseFiles("./static/search.wml"))
@@ -246,53 +457,224 @@ func serveWikiSearch(c echo.Context) error {
 	return tmpl.Execute(c.Response().Writer, data)
 }
 
+// serveWikiSuggest serves the titles starting with the q parameter as links to their
+// search, a cheap prefix-only lookup for completing a query as it is typed
+func serveWikiSuggest(c echo.Context) error {
+	if wiki == nil {
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded.")
+	}
+
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if query == "" {
+		return c.Redirect(http.StatusFound, "/")
+	}
+	limit := 8
+	if l := c.QueryParam("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > 50 {
+			return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "Limit must be between 1 and 50.")
+		}
+	}
+
+	titles, err := wikis.Autocomplete(query, limit)
+	if err != nil {
+		slog.Error("Autocomplete failed", "query", query, "error", err)
+		return serveWikiError(c, http.StatusInternalServerError, "Search Error", "An error occurred while searching.")
+	}
+
+	data := WikiSuggest{
+		Query:       escapeWMLAttr(query),
+		CacheMaxAge: maxAgeSeconds(config.SearchMaxAge),
+	}
+	for _, title := range titles {
+		data.Titles = append(data.Titles, WikiSuggestion{
+			Title:        wikipedia.FormatTitle(title),
+			TitleEncoded: url.QueryEscape(title),
+		})
+	}
+
+	tmpl := template.Must(template.ParseFiles("./static/suggest.wml"))
+	c.Response().Header().Set("Content-Type", "text/vnd.wap.wml")
+	return tmpl.Execute(c.Response().Writer, data)
+}
+
 // serveWikiArticle serves an article
 func serveWikiArticle(c echo.Context) error {
-	log.Printf("Article request: id=%s, p=%s, User-Agent: %s", c.QueryParam("id"), c.QueryParam("p"), c.Request().UserAgent())
 	if wiki == nil {
-		log.Println("Article request but wiki not initialized")
-		return serveWikiError(c, "Not Available", "Wikipedia data is not loaded.")
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded.")
 	}
 
 	idStr := c.QueryParam("id")
 	if idStr == "" {
-		log.Println("Article request with no ID")
-		return serveWikiError(c, "Invalid Request", "No article ID specified.")
+		return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "No article ID specified.")
 	}
 
-	id, err := strconv.ParseUint(idStr, 10, 32)
+	w, id, err := wikis.ResolveArticleID(idStr)
 	if err != nil {
-		return serveWikiError(c, "Invalid Request", "Invalid article ID.")
+		return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "Invalid article ID.")
 	}
 
-	page := 0
-	if p := c.QueryParam("p"); p != "" {
-		page, err = strconv.Atoi(p)
-		if err != nil {
-			page = 0
+	// Images, stylesheets and other resources can't be rendered as articles
+	if entry, mimeType, err := w.GetEntry(id); err == nil && !isArticleEntry(entry, mimeType) {
+		slog.Debug("Entry is not an article", "article_id", idStr, "namespace", string(entry.Namespace), "mime_type", mimeType)
+		return serveWikiNotArticle(c, w, entry, mimeType)
+	}
+
+	section := -1
+	if sec := c.QueryParam("section"); sec != "" {
+		if n, err := strconv.Atoi(sec); err == nil && n >= 0 {
+			section = n
 		}
 	}
 
+	return renderWikiArticle(c, w, id, getPageParam(c), section, config.ArticleMaxAge)
+}
+
+// serveWikiNotArticle explains that an entry is a resource, linking to it when it can be viewed
+func serveWikiNotArticle(c echo.Context, w *wikipedia.Wikipedia, entry *wikipedia.DirectoryEntry, mimeType string) error {
+	data := WikiNotArticle{
+		ID:       w.ArticleID(entry.Index),
+		URL:      escapeWMLAttr(entry.URL),
+		MimeType: escapeWMLAttr(mimeType),
+		IsImage:  strings.HasPrefix(mimeType, "image/"),
+	}
+
+	tmpl := template.Must(template.ParseFiles("./static/notarticle.wml"))
+	c.Response().Header().Set("Content-Type", "text/vnd.wap.wml")
+	return tmpl.Execute(c.Response().Writer, data)
+}
+
+// serveWikiMain serves the ZIM main page, or a random article if the ZIM has no main page
+func serveWikiMain(c echo.Context) error {
+	if wiki == nil {
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded.")
+	}
+
+	id, ok := wiki.GetMainPageIndex()
+	if !ok {
+		slog.Debug("ZIM has no main page, serving random article")
+		return serveWikiRandom(c)
+	}
+
+	return renderWikiArticle(c, wiki, id, getPageParam(c), -1, config.ArticleMaxAge)
+}
+
+// Widths the image endpoint converts to, chosen with the "w" query parameter
+const (
+	defaultImageWidth = 80
+	minImageWidth     = 16
+	maxImageWidth     = 240
+)
+
+// getImageWidthParam returns the image width from the "w" query parameter, clamped to
+// the supported range
+func getImageWidthParam(c echo.Context) int64 {
+	width, err := strconv.ParseInt(c.QueryParam("w"), 10, 64)
+	if err != nil {
+		return defaultImageWidth
+	}
+	return max(minImageWidth, min(width, maxImageWidth))
+}
+
+// passthroughImageTypes are the source image formats served unconverted to devices that
+// accept them
+var passthroughImageTypes = []string{"image/png", "image/gif", "image/jpeg"}
+
+// acceptedPassthroughTypes returns the passthrough image types named in an Accept header.
+// Wildcards don't count, WAP 1 browsers send */* but only show WBMP.
+func acceptedPassthroughTypes(accept string) []string {
+	var types []string
+	for _, mimeType := range passthroughImageTypes {
+		if strings.Contains(accept, mimeType) {
+			types = append(types, mimeType)
+		}
+	}
+	return types
+}
+
+// canPassThrough reports whether an image can be sent as it is: its format is accepted,
+// the ZIM file's MIME type matches its data, and it is no wider than width
+func canPassThrough(content []byte, mimeType string, accepted []string, width int64) bool {
+	if !slices.Contains(accepted, mimeType) {
+		return false
+	}
+	cfg, format, err := goimage.DecodeConfig(bytes.NewReader(content))
+	return err == nil && "image/"+format == mimeType && int64(cfg.Width) <= width
+}
+
+// getPageParam returns the article page number from the "p" query parameter
+func getPageParam(c echo.Context) int {
+	page, err := strconv.Atoi(c.QueryParam("p"))
+	if err != nil || page < 0 {
+		return 0
+	}
+	return page
+}
+
+// renderWikiArticle renders one page of an article, or the page holding a section if
+// section >= 0. Devices may cache the deck for maxAge, zero marks it uncacheable.
+func renderWikiArticle(c echo.Context, w *wikipedia.Wikipedia, id uint32, page int, section int, maxAge time.Duration) error {
 	// Get render options based on device capabilities
 	opts := getRenderOptions(c)
-	log.Printf("Fetching article %d with options: SupportsTables=%v", id, opts.SupportsTables)
-	article, err := wiki.GetArticleWithOptions(uint32(id), opts)
+
+	// The page only depends on the article, the page asked for and the render options
+	multiCard := opts.Mode == wikipedia.RenderWML && getDeviceProfile(c).SupportsMultiCard
+	if checkNotModified(c, contentETag("article", w.ArticleID(id), page, section, opts, useAccessKeys(opts), multiCard, maxAge)) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	slog.Debug("Fetching article", "article_id", w.ArticleID(id), "mode", opts.Mode, "tables", opts.SupportsTables, "max_deck_size", opts.MaxDeckSize)
+	if w.IsArticleCached(id, opts) {
+		c.Set(articleCacheLogKey, "hit")
+	} else {
+		c.Set(articleCacheLogKey, "miss")
+	}
+	article, ok, err := getArticleWithDeadline(c.Request().Context(), w, id, opts)
+	if !ok || err != nil {
+		// Only the article itself may be revalidated against the ETag
+		c.Response().Header().Del("ETag")
+	}
+	if !ok {
+		slog.Info("Article not ready, serving loading page", "article_id", w.ArticleID(id), "deadline", config.ArticleDeadline)
+		return serveWikiLoading(c)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("Article timed out", "article_id", w.ArticleID(id), "timeout", config.RequestTimeout)
+		return serveWikiError(c, http.StatusServiceUnavailable, "Timed Out", "The article took too long to load, please try again.")
+	}
 	if err != nil {
-		log.Printf("Error getting article %d: %v", id, err)
-		return serveWikiError(c, "Article Not Found", "The requested article could not be found.")
+		slog.Warn("Failed to get article", "article_id", w.ArticleID(id), "error", err)
+		return serveWikiError(c, http.StatusNotFound, "Article Not Found", "The requested article could not be found.")
+	}
+	if article.IsEmpty() {
+		slog.Debug("Article has no readable content", "article_id", w.ArticleID(id))
+		return serveWikiError(c, http.StatusOK, "No Content", "This entry has no readable content.")
+	}
+	return serveArticlePage(c, w, id, article, opts, page, section, maxAge, multiCard)
+}
+
+// serveArticlePage serves one page of article, rendered with opts for entry id, or the
+// page holding a section if section >= 0. multiCard adds the links and actions cards to
+// articles that fit on one page.
+func serveArticlePage(c echo.Context, w *wikipedia.Wikipedia, id uint32, article *wikipedia.Article, opts wikipedia.RenderOptions, page, section int, maxAge time.Duration, multiCard bool) error {
+	// Split content into pages that fit the deck size limit
+	chunks := wikipedia.SplitContentByDeckSize(article.Content, pageContentSize(opts))
+
+	// Jump to the page holding the requested section
+	var sections []wikipedia.Section
+	if section >= 0 || page == 0 {
+		sections, _ = w.GetSections(article.Index)
+	}
+	if section >= 0 {
+		page = wikipedia.FindSectionPage(chunks, sections, section)
 	}
-	log.Printf("Serving article %d: %q, page %d", id, article.Title, page)
+	slog.Debug("Serving article", "article_id", w.ArticleID(id), "title", article.Title, "page", page)
 
 	// Check if article has an infobox (only show link on first page for non-Nokia 7110)
 	hasInfobox := false
 	if page == 0 && opts.SupportsTables {
-		hasInfobox = wiki.HasInfobox(uint32(id))
+		hasInfobox = w.HasInfobox(id)
 	}
 
-	// Split content for pagination
-	maxContentLength := 800 // Characters per page
-	chunks := wikipedia.SplitContent(article.Content, maxContentLength)
-
 	showMore := false
 	content := ""
 	if page < len(chunks) {
@@ -300,16 +682,44 @@ func serveWikiArticle(c echo.Context) error {
 		showMore = page+1 < len(chunks)
 	} else if len(chunks) > 0 {
 		content = chunks[len(chunks)-1]
+		page = len(chunks) - 1
+	}
+	if useAccessKeys(opts) {
+		content = addAccessKeys(content)
+	}
+
+	// Articles on a single page get their related links and actions as further cards of the
+	// same deck, so following them costs no request
+	var links []WikiArticleLink
+	if multiCard = multiCard && len(chunks) == 1; multiCard {
+		links = relatedCardLinks(w, article.Index, pageContentSize(opts)-len(content)-multiCardOverheadBytes)
 	}
 
 	data := WikiArticle{
-		Index:          uint32(id),
+		ID:             w.ArticleID(id),
 		Title:          wikipedia.FormatTitle(article.Title),
 		Content:        content,
 		ShowMore:       showMore,
 		NextPage:       page + 1,
+		ShowPrev:       page > 0,
+		PrevPage:       page - 1,
 		HasInfobox:     hasInfobox,
+		HasSections:    page == 0 && len(sections) > 1,
+		ShowRelated:    page == 0,
 		SupportsTables: opts.SupportsTables,
+		UseSoftKeys:    opts.UseSoftKeys,
+		CacheMaxAge:    maxAgeSeconds(maxAge),
+		MultiCard:      multiCard,
+		Links:          links,
+	}
+
+	c.Response().Header().Set("Vary", "Accept, User-Agent")
+	if opts.Mode == wikipedia.RenderXHTMLMP {
+		// Titles are escaped for WML, where "$" starts a variable
+		data.Title = strings.ReplaceAll(data.Title, "$$", "$")
+		tmpl := template.Must(template.ParseFiles("./static/article.xhtml"))
+		c.Response().Header().Set("Content-Type", "application/vnd.wap.xhtml+xml")
+		return tmpl.Execute(c.Response().Writer, data)
 	}
 
 	tmpl := template.Must(template.ParseFiles("./static/article.wml"))
@@ -317,39 +727,169 @@ func serveWikiArticle(c echo.Context) error {
 	return tmpl.Execute(c.Response().Writer, data)
 }
 
+// relatedCardLinks returns the first related articles of article idx whose links fit in
+// budget bytes of a deck
+func relatedCardLinks(w *wikipedia.Wikipedia, idx uint32, budget int) []WikiArticleLink {
+	results, err := w.GetRelatedArticles(idx)
+	if err != nil {
+		slog.Warn("Failed to get related articles", "article_id", w.ArticleID(idx), "error", err)
+		return nil
+	}
+
+	var links []WikiArticleLink
+	for _, r := range results {
+		title := wikipedia.FormatTitle(r.Title)
+		budget -= len(`<a href="/article?id="></a><br/>`) + len(r.ID) + len(title)
+		if budget < 0 {
+			break
+		}
+		links = append(links, WikiArticleLink{ID: r.ID, Title: title})
+	}
+	return links
+}
+
+// serveWikiTOC serves an article's table of contents as links to its sections
+func serveWikiTOC(c echo.Context) error {
+	if wiki == nil {
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded.")
+	}
+
+	idStr := c.QueryParam("id")
+	if idStr == "" {
+		return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "No article ID specified.")
+	}
+
+	w, id, err := wikis.ResolveArticleID(idStr)
+	if err != nil {
+		return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "Invalid article ID.")
+	}
+
+	entry, err := w.GetArticle(id)
+	if err != nil {
+		slog.Warn("Failed to get article for TOC", "article_id", idStr, "error", err)
+		return serveWikiError(c, http.StatusNotFound, "Article Not Found", "The requested article could not be found.")
+	}
+
+	sections, err := w.GetSections(entry.Index)
+	if err != nil || len(sections) == 0 {
+		return serveWikiError(c, http.StatusNotFound, "No Contents", "This article has no sections.")
+	}
+
+	tocSections := make([]WikiSection, len(sections))
+	for i, section := range sections {
+		tocSections[i] = WikiSection{
+			Number: i,
+			Title:  wikipedia.FormatTitle(section.Title),
+			Indent: section.Level > 2,
+		}
+	}
+
+	data := WikiTOC{
+		ID:          w.ArticleID(id),
+		Title:       wikipedia.FormatTitle(entry.Title),
+		Sections:    tocSections,
+		CacheMaxAge: maxAgeSeconds(config.ArticleMaxAge),
+	}
+
+	tmpl := template.Must(template.ParseFiles("./static/toc.wml"))
+	c.Response().Header().Set("Content-Type", "text/vnd.wap.wml")
+	return tmpl.Execute(c.Response().Writer, data)
+}
+
+// articleResult is the outcome of an article fetch running in the background
+type articleResult struct {
+	article *wikipedia.Article
+	err     error
+}
+
+// getArticleWithDeadline fetches an article, giving up after the configured deadline.
+// ok is false if the deadline passed; the fetch then completes in the background and
+// leaves its clusters in the cache for the retry. The background fetch outlives the
+// request, but not config.RequestTimeout.
+func getArticleWithDeadline(ctx context.Context, w *wikipedia.Wikipedia, id uint32, opts wikipedia.RenderOptions) (article *wikipedia.Article, ok bool, err error) {
+	if config.ArticleDeadline <= 0 {
+		article, err = fetchArticle(ctx, w, id, opts)
+		return article, true, err
+	}
+
+	fetchCtx, cancel := withRequestTimeout(context.WithoutCancel(ctx))
+	done := make(chan articleResult, 1)
+	go func() {
+		defer cancel()
+		article, err := fetchArticle(fetchCtx, w, id, opts)
+		done <- articleResult{article: article, err: err}
+	}()
+
+	timer := time.NewTimer(config.ArticleDeadline)
+	defer timer.Stop()
+
+	select {
+	case result := <-done:
+		return result.article, true, result.err
+	case <-timer.C:
+		return nil, false, nil
+	}
+}
+
+// fetchArticle gets a rendered article, recording how long it took
+func fetchArticle(ctx context.Context, w *wikipedia.Wikipedia, id uint32, opts wikipedia.RenderOptions) (*wikipedia.Article, error) {
+	cache := "miss"
+	if w.IsArticleCached(id, opts) {
+		cache = "hit"
+	}
+	start := time.Now()
+	article, err := w.GetArticleWithOptions(ctx, id, opts)
+	articleFetchDuration.observe(cache, time.Since(start))
+	return article, err
+}
+
+// serveWikiLoading serves a lightweight page asking the user to retry the current request
+func serveWikiLoading(c echo.Context) error {
+	data := WikiLoading{
+		RetryURL:   escapeWMLAttr(c.Request().URL.RequestURI()),
+		RetryTimer: int(config.LoadingRetry / (100 * time.Millisecond)),
+	}
+
+	tmpl := template.Must(template.ParseFiles("./static/loading.wml"))
+	c.Response().Header().Set("Content-Type", "text/vnd.wap.wml")
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	return tmpl.Execute(c.Response().Writer, data)
+}
+
 // serveWikiInfobox serves an article's infobox as a WML table
 func serveWikiInfobox(c echo.Context) error {
 	if wiki == nil {
-		return serveWikiError(c, "Not Available", "Wikipedia data is not loaded.")
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded.")
 	}
 
 	// Check if device supports tables
 	opts := getRenderOptions(c)
 	if !opts.SupportsTables {
-		return serveWikiError(c, "Not Supported", "Your device does not support tables.")
+		return serveWikiError(c, http.StatusNotAcceptable, "Not Supported", "Your device does not support tables.")
 	}
 
 	idStr := c.QueryParam("id")
 	if idStr == "" {
-		return serveWikiError(c, "Invalid Request", "No article ID specified.")
+		return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "No article ID specified.")
 	}
 
-	id, err := strconv.ParseUint(idStr, 10, 32)
+	w, id, err := wikis.ResolveArticleID(idStr)
 	if err != nil {
-		return serveWikiError(c, "Invalid Request", "Invalid article ID.")
+		return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "Invalid article ID.")
 	}
 
 	// Get the infobox content
-	infobox, title, err := wiki.GetInfobox(uint32(id))
+	infobox, title, err := w.GetInfobox(id)
 	if err != nil {
-		log.Printf("Error getting infobox for article %d: %v", id, err)
-		return serveWikiError(c, "No Infobox", "This article does not have an infobox.")
+		slog.Debug("No infobox", "article_id", idStr, "error", err)
+		return serveWikiError(c, http.StatusNotFound, "No Infobox", "This article does not have an infobox.")
 	}
 
 	data := WikiInfobox{
-		Index:   uint32(id),
-		Title:   wikipedia.FormatTitle(title),
-		Content: infobox,
+		ID:          w.ArticleID(id),
+		Title:       wikipedia.FormatTitle(title),
+		Content:     infobox,
+		CacheMaxAge: maxAgeSeconds(config.ArticleMaxAge),
 	}
 
 	tmpl := template.Must(template.ParseFiles("./static/infobox.wml"))
@@ -357,152 +897,552 @@ func serveWikiInfobox(c echo.Context) error {
 	return tmpl.Execute(c.Response().Writer, data)
 }
 
-// serveWikiRandom serves a random article
-func serveWikiRandom(c echo.Context) error {
+// summaryMaxChars is the length of article previews, enough for the gist on a few screens
+const summaryMaxChars = 300
+
+// serveWikiSummary serves a short preview of an article, its first paragraph
+func serveWikiSummary(c echo.Context) error {
 	if wiki == nil {
-		return serveWikiError(c, "Not Available", "Wikipedia data is not loaded.")
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded.")
+	}
+
+	idStr := c.QueryParam("id")
+	if idStr == "" {
+		return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "No article ID specified.")
 	}
 
-	article, err := wiki.GetRandomArticle()
+	w, id, err := wikis.ResolveArticleID(idStr)
 	if err != nil {
-		log.Printf("Error getting random article: %v", err)
-		return serveWikiError(c, "Error", "Could not get a random article.")
+		return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "Invalid article ID.")
 	}
 
-	// Serve the article directly (WAP gateways don't handle redirects well)
-	opts := getRenderOptions(c)
-	articleWithOpts, err := wiki.GetArticleWithOptions(article.Index, opts)
+	// Redirects preview their target, under its title
+	meta, err := w.GetArticleMetadata(id)
+	if err == nil && meta.IsRedirect {
+		id = meta.RedirectTarget
+		meta, err = w.GetArticleMetadata(id)
+	}
 	if err != nil {
-		return serveWikiError(c, "Error", "Could not load article.")
+		slog.Warn("Failed to get article", "article_id", idStr, "error", err)
+		return serveWikiError(c, http.StatusNotFound, "Not Found", "Article not found.")
 	}
 
-	// Check for infobox
-	hasInfobox := false
-	if opts.SupportsTables {
-		hasInfobox = wiki.HasInfobox(article.Index)
+	summary, err := w.GetArticleSummary(id, summaryMaxChars)
+	if err != nil {
+		slog.Debug("No summary", "article_id", idStr, "error", err)
+		return serveWikiError(c, http.StatusNotFound, "No Summary", "This article has no summary.")
 	}
 
-	// Split content for pagination
-	maxContentLength := 800
-	chunks := wikipedia.SplitContent(articleWithOpts.Content, maxContentLength)
+	data := WikiSummary{
+		ID:          w.ArticleID(id),
+		Title:       wikipedia.FormatTitle(meta.Title),
+		Summary:     summary,
+		CacheMaxAge: maxAgeSeconds(config.ArticleMaxAge),
+	}
 
-	content := ""
-	showMore := false
-	if len(chunks) > 0 {
-		content = chunks[0]
-		showMore = len(chunks) > 1
+	tmpl := template.Must(template.ParseFiles("./static/summary.wml"))
+	c.Response().Header().Set("Content-Type", "text/vnd.wap.wml")
+	return tmpl.Execute(c.Response().Writer, data)
+}
+
+// serveWikiRelated serves the articles an article links to from its "See also" section
+// and its lead
+func serveWikiRelated(c echo.Context) error {
+	if wiki == nil {
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded.")
 	}
 
-	data := WikiArticle{
-		Index:          article.Index,
-		Title:          wikipedia.FormatTitle(articleWithOpts.Title),
-		Content:        content,
-		ShowMore:       showMore,
-		NextPage:       1,
-		HasInfobox:     hasInfobox,
-		SupportsTables: opts.SupportsTables,
+	idStr := c.QueryParam("id")
+	if idStr == "" {
+		return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "No article ID specified.")
 	}
 
-	tmpl := template.Must(template.ParseFiles("./static/article.wml"))
+	w, id, err := wikis.ResolveArticleID(idStr)
+	if err != nil {
+		return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "Invalid article ID.")
+	}
+
+	// Redirects list the links of their target, under its title
+	meta, err := w.GetArticleMetadata(id)
+	if err == nil && meta.IsRedirect {
+		id = meta.RedirectTarget
+		meta, err = w.GetArticleMetadata(id)
+	}
+	if err != nil {
+		slog.Warn("Failed to get article", "article_id", idStr, "error", err)
+		return serveWikiError(c, http.StatusNotFound, "Not Found", "Article not found.")
+	}
+
+	results, err := w.GetRelatedArticles(id)
+	if err != nil || len(results) == 0 {
+		if err != nil {
+			slog.Warn("Failed to get related articles", "article_id", idStr, "error", err)
+		}
+		return serveWikiError(c, http.StatusNotFound, "No Related Articles", "This article links to no other articles.")
+	}
+	for i := range results {
+		results[i].Title = wikipedia.FormatTitle(results[i].Title)
+	}
+
+	data := WikiRelated{
+		ID:          w.ArticleID(id),
+		Title:       wikipedia.FormatTitle(meta.Title),
+		Results:     results,
+		CacheMaxAge: maxAgeSeconds(config.ArticleMaxAge),
+	}
+
+	tmpl := template.Must(template.ParseFiles("./static/related.wml"))
 	c.Response().Header().Set("Content-Type", "text/vnd.wap.wml")
 	return tmpl.Execute(c.Response().Writer, data)
 }
 
-// serveWikiError serves an error page
-func serveWikiError(c echo.Context, title, message string) error {
+// serveWikiRandom serves the first page of a random article, like any other article but
+// not cacheable, the next visit is another article
+func serveWikiRandom(c echo.Context) error {
+	if wiki == nil {
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded.")
+	}
+
+	// Candidates are rendered with the options the article is served with, the one found
+	// is served as it is
+	opts := getRenderOptions(c)
+	article, err := wiki.GetRandomArticleWithOptions(c.Request().Context(), opts)
+	if err != nil {
+		slog.Error("Failed to get random article", "error", err)
+		return serveWikiError(c, http.StatusInternalServerError, "Error", "Could not get a random article.")
+	}
+
+	// Serve the article directly (WAP gateways don't handle redirects well)
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	multiCard := opts.Mode == wikipedia.RenderWML && getDeviceProfile(c).SupportsMultiCard
+	return serveArticlePage(c, wiki, article.Index, article, opts, 0, -1, 0, multiCard)
+}
+
+// serveWikiError serves an error page with the given HTTP status
+func serveWikiError(c echo.Context, status int, title, message string) error {
 	data := WikiError{
 		Title:   escapeWMLAttr(title),
 		Message: escapeWMLAttr(message),
 	}
 
 	tmpl := template.Must(template.ParseFiles("./static/error.wml"))
+	// Errors may clear up on the next visit, don't let them be cached or revalidated
+	c.Response().Header().Del("ETag")
 	c.Response().Header().Set("Content-Type", "text/vnd.wap.wml")
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	c.Response().WriteHeader(status)
 	return tmpl.Execute(c.Response().Writer, data)
 }
 
+// serveHTTPError serves errors returned by handlers and middleware, such as unknown routes,
+// as error pages instead of Echo's JSON, or as JSON errors for the JSON API
+func serveHTTPError(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	status := http.StatusInternalServerError
+	message := "An internal error occurred."
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		status = he.Code
+		if msg, ok := he.Message.(string); ok {
+			message = msg
+		}
+	}
+	if status >= http.StatusInternalServerError {
+		slog.Error("Failed to serve request", "path", c.Request().URL.Path, "error", err)
+	}
+	if err = serveRouteError(c, status, http.StatusText(status), message); err != nil {
+		slog.Error("Failed to serve error page", "path", c.Request().URL.Path, "error", err)
+	}
+}
+
+// serveRouteError serves an error the way the route it happened on answers, a JSON error
+// for the JSON API and an error page otherwise
+func serveRouteError(c echo.Context, status int, title, message string) error {
+	if strings.HasPrefix(c.Request().URL.Path, "/api/") {
+		return serveJSONError(c, status, message)
+	}
+	return serveWikiError(c, status, title, message)
+}
+
 // serveWikiImage serves images from the ZIM file in JPEG or WBMP format
 func serveWikiImage(c echo.Context) error {
-	log.Printf("Image request: %s, Accept: %s", c.Param("*"), c.Request().Header.Get("Accept"))
 	if wiki == nil {
-		log.Println("Image request but wiki not initialized")
-		return c.String(http.StatusServiceUnavailable, "Wikipedia data is not loaded.")
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded.")
 	}
 
 	// Get image path from the URL parameter
 	imagePath := c.Param("*")
 	if imagePath == "" {
-		log.Println("Image request with no path")
-		return c.String(http.StatusBadRequest, "No image path specified.")
+		return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "No image path specified.")
 	}
 
-	var content []byte
-	var err error
+	// The device profile gives the output format, the Accept header which sources pass
+	// through as is
+	format := getDeviceProfile(c).ImageFormat
+	passthrough := acceptedPassthroughTypes(c.Request().Header.Get("Accept"))
 
-	// Check if imagePath is a numeric ID
-	if id, parseErr := strconv.ParseUint(imagePath, 10, 32); parseErr == nil {
-		// Lookup by ID
-		content, _, err = wiki.GetImageByID(uint32(id))
-	} else {
-		// Lookup by path (fallback for compatibility)
-		content, _, err = wiki.GetImage(imagePath)
+	width := getImageWidthParam(c)
+
+	// The "dither" query parameter overrides the dither chosen for the image
+	dither, err := image.ParseDither(c.QueryParam("dither"))
+	if err != nil {
+		return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "Dither must be auto, diffusion, ordered or threshold.")
+	}
+
+	c.Response().Header().Set("Vary", "Accept, User-Agent")
+	if checkNotModified(c, contentETag("image", imagePath, format, passthrough, width, dither)) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
+	// Look up by numeric ID, or by path for compatibility, in the wiki named by the prefix
+	content, mimeType, err := wikis.GetImage(imagePath)
+
 	if err != nil {
-		log.Printf("Error getting image %s: %v", imagePath, err)
-		return c.String(http.StatusNotFound, "Image not found.")
+		slog.Warn("Failed to get image", "image", imagePath, "error", err)
+		return serveWikiError(c, http.StatusNotFound, "Image Not Found", "The requested image could not be found.")
 	}
 
-	// Check Accept header to determine output format
-	accept := c.Request().Header.Get("Accept")
+	if canPassThrough(content, mimeType, passthrough, width) {
+		slog.Debug("Serving image unconverted", "image", imagePath, "mime_type", mimeType)
+		return c.Blob(http.StatusOK, mimeType, content)
+	}
 
-	if strings.Contains(accept, "image/jpeg") {
-		log.Printf("Serving image %s as JPEG", imagePath)
-		return c.Blob(http.StatusOK, "image/jpeg", image.ImageToJPEG(content, 80))
+	if err := image.CheckImageSize(content, config.MaxImagePixels); err != nil {
+		slog.Info("Not converting image", "image", imagePath, "error", err)
+		return serveWikiError(c, http.StatusRequestEntityTooLarge, "Image Too Large", "This image is too large to show.")
+	}
+
+	start := time.Now()
+	if format == "jpeg" {
+		slog.Debug("Serving image", "image", imagePath, "format", format)
+		jpeg := image.ImageToJPEG(content, width)
+		imageConversionDuration.observe(format, time.Since(start))
+		return c.Blob(http.StatusOK, "image/jpeg", jpeg)
 	}
 
 	// Default to WBMP for WAP devices
-	log.Printf("Serving image %s as WBMP", imagePath)
-	return c.Blob(http.StatusOK, "image/vnd.wap.wbmp", image.ImageToWBMP(content, 80))
+	slog.Debug("Serving image", "image", imagePath, "format", "wbmp")
+	wbmp := image.ImageToWBMPWithDither(content, width, dither)
+	imageConversionDuration.observe(format, time.Since(start))
+	return c.Blob(http.StatusOK, "image/vnd.wap.wbmp", wbmp)
 }
 
 // RegisterWikiRoutes registers all Wikipedia-related routes
 func RegisterWikiRoutes(e *echo.Echo) {
-	// Add rate limiting middleware to prevent server overload
-	// Allows 5 requests per second with a burst of 10 globally
-	config := middleware.RateLimiterConfig{
-		Skipper: middleware.DefaultSkipper,
-		Store: middleware.NewRateLimiterMemoryStoreWithConfig(
-			middleware.RateLimiterMemoryStoreConfig{
-				Rate:      rate.Limit(5), // 5 requests per second
-				Burst:     10,            // Allow bursts up to 10 requests
-				ExpiresIn: 3 * time.Minute,
-			},
-		),
-		IdentifierExtractor: func(ctx echo.Context) (string, error) {
-			return "1", nil // no IP-based limiting, most of it comes from Kannel anyway
-		},
-		ErrorHandler: func(context echo.Context, err error) error {
-			return context.String(http.StatusForbidden, "Rate limit error")
-		},
-		DenyHandler: func(context echo.Context, identifier string, err error) error {
-			return context.String(http.StatusTooManyRequests, "Whelp we are a bit overloaded. Please try again later.")
-		},
-	}
-	e.Use(middleware.RateLimiterWithConfig(config))
-
-	e.GET("/", serveWikiHome)
-	e.GET("/search", serveWikiSearch)
-	e.GET("/article", serveWikiArticle)
-	e.GET("/infobox", serveWikiInfobox)
-	e.GET("/random", serveWikiRandom)
-	e.GET("/image/*", serveWikiImage)
-	e.GET("/wapipedia.wbmp", serveWAPipediaLogo)
+	e.HTTPErrorHandler = serveHTTPError
+	if logo, err := loadWAPipediaLogo(); err != nil {
+		slog.Error("Failed to load logo", "error", err)
+	} else {
+		wapipediaLogo = logo
+	}
+
+	// Probes stay apart from the content middleware, so a rate limited or overloaded
+	// instance still passes its liveness check
+	e.GET("/healthz", serveHealthz)
+	e.GET("/readyz", serveReadyz)
+
+	// Content routes are measured, logged, rate limited to prevent server overload (see
+	// Config.RateLimitMode) and given the request timeout
+	content := e.Group("", measureRequests, logRequests, rateLimiter(), limitRequestTime)
+	content.GET("/", serveWikiHome)
+	content.GET("/search", serveWikiSearch)
+	content.GET("/suggest", serveWikiSuggest)
+	content.GET("/article", serveWikiArticle)
+	content.GET("/article.json", serveAPIArticle)
+	content.GET("/main", serveWikiMain)
+	content.GET("/infobox", serveWikiInfobox)
+	content.GET("/summary", serveWikiSummary)
+	content.GET("/toc", serveWikiTOC)
+	content.GET("/related", serveWikiRelated)
+	content.GET("/random", serveWikiRandom)
+	content.GET("/image/*", serveWikiImage)
+	content.GET("/wapipedia.wbmp", serveWAPipediaLogo)
+	content.GET("/stats", serveStats)
+	content.GET("/metrics", serveMetrics)
+	content.GET("/articles", serveWikiArticleList)
+	content.GET("/browse", serveWikiBrowse)
+	content.GET("/category", serveWikiCategory)
+
+	admin := content.Group("/admin", requireAdminToken)
+	admin.POST("/reload", serveAdminReload)
+	content.GET("/raw", serveAdminRaw, requireAdminToken)
+
+	// JSON API, for clients that build their own pages
+	content.GET("/api/search", serveAPISearch)
+	content.GET("/api/article", serveAPIArticle)
+	content.GET("/api/random", serveAPIRandom)
+	content.GET("/api/image/*", serveAPIImage)
+}
+
+// serveWikiArticleList serves a page of all articles in directory order, for browsing
+// and for tools that want to visit every article
+func serveWikiArticleList(c echo.Context) error {
+	if wiki == nil {
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded.")
+	}
+
+	w := wiki
+	name := c.QueryParam("wiki")
+	if name != "" {
+		var ok bool
+		if w, ok = wikis.Get(name); !ok {
+			return serveWikiError(c, http.StatusNotFound, "Not Found", "No such wiki.")
+		}
+	}
+
+	offset := uint64(0)
+	if o := c.QueryParam("offset"); o != "" {
+		var err error
+		if offset, err = strconv.ParseUint(o, 10, 32); err != nil {
+			return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "Invalid offset.")
+		}
+	}
+
+	limit := 10
+	if l := c.QueryParam("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > 500 {
+			return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "Limit must be between 1 and 500.")
+		}
+	}
+
+	entries, next, err := w.ListArticles(uint32(offset), limit)
+	if err != nil {
+		slog.Error("Failed to list articles", "offset", offset, "error", err)
+		return serveWikiError(c, http.StatusInternalServerError, "Error", "Could not list articles.")
+	}
+	slog.Debug("Listing articles", "offset", offset, "count", len(entries), "next", next)
+
+	data := WikiArticleList{
+		Wiki:       url.QueryEscape(name),
+		ShowMore:   next < w.GetArticleCount(),
+		NextOffset: next,
+		Limit:      limit,
+	}
+	for _, entry := range entries {
+		link := WikiArticleLink{
+			ID:    w.ArticleID(entry.Index),
+			Title: wikipedia.FormatTitle(entry.Title),
+		}
+		if entry.URL != strings.ReplaceAll(entry.Title, " ", "_") && entry.URL != entry.Title {
+			link.URL = escapeWMLAttr(entry.URL)
+		}
+		data.Articles = append(data.Articles, link)
+	}
+
+	tmpl := template.Must(template.ParseFiles("./static/articles.wml"))
+	c.Response().Header().Set("Content-Type", "text/vnd.wap.wml")
+	return tmpl.Execute(c.Response().Writer, data)
+}
+
+// serveWikiBrowse serves articles whose title starts with the letters in p, for
+// navigating without typing a search. Without p it shows the letters to pick from.
+func serveWikiBrowse(c echo.Context) error {
+	if wiki == nil {
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded.")
+	}
+
+	w := wiki
+	name := c.QueryParam("wiki")
+	if name != "" {
+		var ok bool
+		if w, ok = wikis.Get(name); !ok {
+			return serveWikiError(c, http.StatusNotFound, "Not Found", "No such wiki.")
+		}
+	}
+
+	limit := 10
+	if l := c.QueryParam("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > 500 {
+			return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "Limit must be between 1 and 500.")
+		}
+	}
+
+	data := WikiBrowse{
+		Wiki:  url.QueryEscape(name),
+		Limit: limit,
+	}
+
+	prefix := strings.TrimSpace(c.QueryParam("p"))
+	if prefix == "" {
+		for letter := 'A'; letter <= 'Z'; letter++ {
+			data.Letters = append(data.Letters, string(letter))
+		}
+	} else {
+		entries, next, err := w.BrowseTitles(prefix, c.QueryParam("from"), limit)
+		if err != nil {
+			slog.Error("Failed to browse titles", "prefix", prefix, "error", err)
+			return serveWikiError(c, http.StatusInternalServerError, "Error", "Could not list articles.")
+		}
+		slog.Debug("Browsing titles", "prefix", prefix, "count", len(entries), "next", next)
+
+		data.Prefix = escapeWMLAttr(prefix)
+		data.PrefixEncoded = url.QueryEscape(prefix)
+		if next != "" {
+			data.NextEncoded = url.QueryEscape(next)
+		}
+		for _, entry := range entries {
+			data.Articles = append(data.Articles, WikiArticleLink{
+				ID:    w.ArticleID(entry.Index),
+				Title: wikipedia.FormatTitle(entry.Title),
+			})
+		}
+	}
+
+	tmpl := template.Must(template.ParseFiles("./static/browse.wml"))
+	c.Response().Header().Set("Content-Type", "text/vnd.wap.wml")
+	return tmpl.Execute(c.Response().Writer, data)
+}
+
+// serveWikiCategory serves the articles in the category named by the name parameter as a
+// list of links, or the list of categories without one
+func serveWikiCategory(c echo.Context) error {
+	if wiki == nil {
+		return serveWikiError(c, http.StatusServiceUnavailable, "Not Available", "Wikipedia data is not loaded.")
+	}
+
+	w := wiki
+	wikiName := c.QueryParam("wiki")
+	if wikiName != "" {
+		var ok bool
+		if w, ok = wikis.Get(wikiName); !ok {
+			return serveWikiError(c, http.StatusNotFound, "Not Found", "No such wiki.")
+		}
+	}
+
+	offset := 0
+	if o := c.QueryParam("offset"); o != "" {
+		var err error
+		if offset, err = strconv.Atoi(o); err != nil || offset < 0 {
+			return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "Invalid offset.")
+		}
+	}
+	limit := 10
+	if l := c.QueryParam("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > 500 {
+			return serveWikiError(c, http.StatusBadRequest, "Invalid Request", "Limit must be between 1 and 500.")
+		}
+	}
+
+	data := WikiCategory{Wiki: url.QueryEscape(wikiName)}
+	next := url.Values{}
+	if wikiName != "" {
+		next.Set("wiki", wikiName)
+	}
+
+	name := strings.TrimSpace(c.QueryParam("name"))
+	total := 0
+	if name == "" {
+		categories, err := w.ListCategories()
+		if err != nil {
+			slog.Error("Failed to list categories", "error", err)
+			return serveWikiError(c, http.StatusInternalServerError, "Error", "Could not list categories.")
+		}
+		total = len(categories)
+		for _, category := range categories[min(offset, total):min(offset+limit, total)] {
+			data.Categories = append(data.Categories, WikiCategoryLink{
+				Name:        wikipedia.FormatTitle(category),
+				NameEncoded: url.QueryEscape(category),
+			})
+		}
+	} else {
+		entries, err := w.ListArticlesInCategory(name)
+		if err != nil {
+			slog.Debug("No such category", "category", name, "error", err)
+			return serveWikiError(c, http.StatusNotFound, "Not Found", "No such category.")
+		}
+		slog.Debug("Listing category", "category", name, "articles", len(entries))
+
+		data.Name = escapeWMLAttr(name)
+		next.Set("name", name)
+		total = len(entries)
+		for _, entry := range entries[min(offset, total):min(offset+limit, total)] {
+			data.Articles = append(data.Articles, WikiArticleLink{
+				ID:    w.ArticleID(entry.Index),
+				Title: wikipedia.FormatTitle(entry.Title),
+			})
+		}
+	}
+
+	if offset+limit < total {
+		next.Set("offset", strconv.Itoa(offset+limit))
+		next.Set("limit", strconv.Itoa(limit))
+		data.Query = escapeWMLAttr(next.Encode())
+	}
+
+	tmpl := template.Must(template.ParseFiles("./static/category.wml"))
+	c.Response().Header().Set("Content-Type", "text/vnd.wap.wml")
+	return tmpl.Execute(c.Response().Writer, data)
+}
+
+// serveStats serves reader, cache and memory metrics as plain text for operators
+func serveStats(c echo.Context) error {
+	if wiki == nil {
+		return c.String(http.StatusServiceUnavailable, "Wikipedia data is not loaded.\n")
+	}
+
+	var b strings.Builder
+	for _, name := range wikis.Names() {
+		w, _ := wikis.Get(name)
+		stats := w.Stats()
+		if name == "" {
+			fmt.Fprintln(&b, "ZIM:")
+		} else {
+			fmt.Fprintf(&b, "ZIM %s:\n", name)
+		}
+		fmt.Fprintf(&b, "  entries:          %d\n", stats.ArticleCount)
+		fmt.Fprintf(&b, "  clusters:         %d\n", stats.ClusterCount)
+		fmt.Fprintf(&b, "  cluster cache:    %d/%d clusters, %.1f MB\n", stats.CachedClusters, stats.CacheCapacity, float64(stats.CachedBytes)/1024/1024)
+		fmt.Fprintf(&b, "  cache hits:       %d\n", stats.CacheHits)
+		fmt.Fprintf(&b, "  cache misses:     %d\n", stats.CacheMisses)
+		fmt.Fprintf(&b, "  cache hit ratio:  %.1f%%\n", stats.HitRatio()*100)
+		articles, articleBytes := w.ArticleCacheSize()
+		fmt.Fprintf(&b, "  article cache:    %d articles, %.1f MB\n", articles, float64(articleBytes)/1024/1024)
+	}
+
+	randomIDMutex.Lock()
+	randomFill := len(randomIDCache)
+	randomIDMutex.Unlock()
+	fmt.Fprintf(&b, "random ID cache:    %d/%d\n", randomFill, randomIDCacheSize)
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	fmt.Fprintf(&b, "memory alloc:       %.1f MB\n", float64(mem.Alloc)/1024/1024)
+	fmt.Fprintf(&b, "memory sys:         %.1f MB\n", float64(mem.Sys)/1024/1024)
+	fmt.Fprintf(&b, "GC cycles:          %d\n", mem.NumGC)
+	fmt.Fprintf(&b, "goroutines:         %d\n", runtime.NumGoroutine())
+
+	return c.String(http.StatusOK, b.String())
+}
+
+// wapipediaLogo is the WAPipedia logo as WBMP, read once by RegisterWikiRoutes, nil if it
+// could not be
+var wapipediaLogo []byte
+
+// loadWAPipediaLogo reads the logo WBMP file, decoding and encoding it again so a broken
+// file shows at startup rather than on devices
+func loadWAPipediaLogo() ([]byte, error) {
+	data, err := os.ReadFile("./static/wapipedia.wbmp")
+	if err != nil {
+		return nil, err
+	}
+	logo, err := image.DecodeWBMP(data)
+	if err != nil {
+		return nil, err
+	}
+	return image.EncodeWBMP(logo)
 }
 
 // serveWAPipediaLogo serves the WAPipedia logo WBMP file
 func serveWAPipediaLogo(c echo.Context) error {
-	c.Response().Header().Set(echo.HeaderContentType, "image/vnd.wap.wbmp")
-	return c.File("./static/wapipedia.wbmp")
+	if wapipediaLogo == nil {
+		return serveWikiError(c, http.StatusNotFound, "Image Not Found", "The logo could not be found.")
+	}
+	return c.Blob(http.StatusOK, "image/vnd.wap.wbmp", wapipediaLogo)
 }
 
 // GetZIMPath returns the path to the ZIM file from environment or default
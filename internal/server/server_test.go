@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// newTestServer returns the routes with cfg, without a loaded wiki
+func newTestServer(t *testing.T, cfg Config) *echo.Echo {
+	SetConfig(cfg)
+	t.Cleanup(func() { SetConfig(DefaultConfig()) })
+	e := echo.New()
+	RegisterWikiRoutes(e)
+	return e
+}
+
+// serveTestRequest serves a GET of target and returns the response
+func serveTestRequest(e *echo.Echo, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestProbesSkipRateLimit(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RateLimitRate = 0.001
+	cfg.RateLimitBurst = 1
+	e := newTestServer(t, cfg)
+
+	if rec := serveTestRequest(e, "/api/search?q=x"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("first request status = %d, want %d as no wiki is loaded", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	// Rate limited API requests get the JSON API's errors
+	rec := serveTestRequest(e, "/api/search?q=x")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") || !strings.Contains(rec.Body.String(), `"error"`) {
+		t.Errorf("rate limited API response is %s: %q, want a JSON error", contentType, rec.Body.String())
+	}
+
+	for range 3 {
+		if rec := serveTestRequest(e, "/healthz"); rec.Code != http.StatusOK {
+			t.Errorf("/healthz status = %d when rate limited, want %d", rec.Code, http.StatusOK)
+		}
+		if rec := serveTestRequest(e, "/readyz"); rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("/readyz status = %d when rate limited, want %d as no wiki is loaded", rec.Code, http.StatusServiceUnavailable)
+		}
+	}
+}
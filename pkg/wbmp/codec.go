@@ -0,0 +1,128 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	goimage "image"
+	"image/color"
+)
+
+// maxWBMPDimension is the largest width or height DecodeWBMP accepts and EncodeWBMP writes.
+// Four bytes of multi-byte integer hold 28 bits, far more than any WAP screen.
+const maxWBMPDimension = 1<<28 - 1
+
+// wbmpPalette is the palette of decoded WBMP images, a 0 bit is black and a 1 bit white
+var wbmpPalette = color.Palette{color.Black, color.White}
+
+// EncodeWBMP encodes img as a type 0 WBMP. Pixels lighter than mid grey become white,
+// the others black. Transparent pixels are taken to be on a white background.
+func EncodeWBMP(img goimage.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("wbmp: empty image")
+	}
+	if width > maxWBMPDimension || height > maxWBMPDimension {
+		return nil, fmt.Errorf("wbmp: image of %dx%d pixels is too large", width, height)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(0) // type 0: black and white, no compression
+	buf.WriteByte(0) // fixed header field
+	writeMultiByteInt(&buf, width)
+	writeMultiByteInt(&buf, height)
+
+	row := make([]byte, (width+7)/8)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		clear(row)
+		for x := 0; x < width; x++ {
+			if isLight(img.At(bounds.Min.X+x, y)) {
+				row[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		buf.Write(row)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeWBMP decodes a type 0 WBMP into a two colour paletted image
+func DecodeWBMP(data []byte) (goimage.Image, error) {
+	r := bytes.NewReader(data)
+	typ, err := readMultiByteInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if typ != 0 {
+		return nil, fmt.Errorf("wbmp: unsupported type %d", typ)
+	}
+	if _, err := r.ReadByte(); err != nil {
+		return nil, errors.New("wbmp: truncated header")
+	}
+	width, err := readMultiByteInt(r)
+	if err != nil {
+		return nil, err
+	}
+	height, err := readMultiByteInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if width == 0 || height == 0 {
+		return nil, errors.New("wbmp: empty image")
+	}
+
+	// Check the size before allocating, so a bad header can't ask for a huge image
+	stride := (width + 7) / 8
+	if need := int64(stride) * int64(height); int64(r.Len()) < need {
+		return nil, fmt.Errorf("wbmp: %dx%d image needs %d bytes of pixel data, have %d", width, height, need, r.Len())
+	}
+
+	pixels := data[len(data)-r.Len():]
+	img := goimage.NewPaletted(goimage.Rect(0, 0, width, height), wbmpPalette)
+	for y := 0; y < height; y++ {
+		row := pixels[y*stride : (y+1)*stride]
+		for x := 0; x < width; x++ {
+			if row[x/8]&(0x80>>(x%8)) != 0 {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return img, nil
+}
+
+// isLight reports whether c, over a white background, is lighter than mid grey
+func isLight(c color.Color) bool {
+	r, g, b := overWhite(c)
+	// ITU-R 601 luma, as in color.GrayModel
+	y := (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+	return y >= 0x8000
+}
+
+// writeMultiByteInt writes n as a WBMP multi-byte integer: 7 bits per byte, most
+// significant first, the high bit set on all bytes but the last
+func writeMultiByteInt(buf *bytes.Buffer, n int) {
+	var tmp [5]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(n & 0x7f)
+	for n >>= 7; n > 0; n >>= 7 {
+		i--
+		tmp[i] = byte(n&0x7f) | 0x80
+	}
+	buf.Write(tmp[i:])
+}
+
+// readMultiByteInt reads a WBMP multi-byte integer of up to maxWBMPDimension
+func readMultiByteInt(r *bytes.Reader) (int, error) {
+	n := 0
+	for range 4 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, errors.New("wbmp: truncated header")
+		}
+		n = n<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			return n, nil
+		}
+	}
+	return 0, errors.New("wbmp: header value too large")
+}
@@ -0,0 +1,96 @@
+package image
+
+import (
+	"bytes"
+	goimage "image"
+	"image/color"
+	"testing"
+)
+
+// testPattern returns a black and white image of width by height pixels whose rows
+// differ, so rows and bits out of place show
+func testPattern(width, height int) *goimage.Gray {
+	img := goimage.NewGray(goimage.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			if (x*x+y)%3 == 0 {
+				img.SetGray(x, y, color.Gray{Y: 0xff})
+			}
+		}
+	}
+	return img
+}
+
+func TestWBMPRoundTrip(t *testing.T) {
+	for _, size := range []struct{ width, height int }{
+		{1, 1}, {7, 3}, {8, 2}, {9, 4}, {13, 5}, {17, 1}, {130, 3},
+	} {
+		img := testPattern(size.width, size.height)
+		data, err := EncodeWBMP(img)
+		if err != nil {
+			t.Fatalf("EncodeWBMP(%dx%d) error = %v", size.width, size.height, err)
+		}
+		decoded, err := DecodeWBMP(data)
+		if err != nil {
+			t.Fatalf("DecodeWBMP() of a %dx%d image error = %v", size.width, size.height, err)
+		}
+		if got := decoded.Bounds(); got != img.Bounds() {
+			t.Fatalf("DecodeWBMP() bounds = %v, want %v", got, img.Bounds())
+		}
+		for y := range size.height {
+			for x := range size.width {
+				if got, want := isLight(decoded.At(x, y)), isLight(img.At(x, y)); got != want {
+					t.Errorf("%dx%d pixel (%d, %d) light = %v, want %v", size.width, size.height, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeWBMP(t *testing.T) {
+	// The last bits of each row past the width are padding, left black
+	img := goimage.NewGray(goimage.Rect(0, 0, 9, 2))
+	img.SetGray(0, 0, color.Gray{Y: 0xff})
+	img.SetGray(8, 0, color.Gray{Y: 0xff})
+	img.SetGray(1, 1, color.Gray{Y: 0xff})
+	want := []byte{0, 0, 9, 2, 0x80, 0x80, 0x40, 0x00}
+	if got, err := EncodeWBMP(img); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("EncodeWBMP() = %x, %v, want %x", got, err, want)
+	}
+
+	// Widths past 127 take more than one byte
+	got, err := EncodeWBMP(goimage.NewGray(goimage.Rect(0, 0, 200, 1)))
+	if err != nil || !bytes.HasPrefix(got, []byte{0, 0, 0x81, 0x48, 1}) || len(got) != 5+25 {
+		t.Errorf("EncodeWBMP() of 200x1 pixels = %x, %v, want a header of 00 00 81 48 01 and 25 bytes", got, err)
+	}
+
+	if _, err := EncodeWBMP(goimage.NewGray(goimage.Rect(0, 0, 0, 5))); err == nil {
+		t.Error("EncodeWBMP() of an empty image error = nil")
+	}
+}
+
+func TestDecodeWBMPRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"type only", []byte{0}},
+		{"no width", []byte{0, 0}},
+		{"truncated width", []byte{0, 0, 0x81}},
+		{"no height", []byte{0, 0, 9}},
+		{"unsupported type", []byte{1, 0, 1, 1, 0}},
+		{"width too large", []byte{0, 0, 0xff, 0xff, 0xff, 0xff, 0x7f, 1, 0}},
+		{"zero width", []byte{0, 0, 0, 1}},
+		{"zero height", []byte{0, 0, 1, 0}},
+		{"truncated pixels", []byte{0, 0, 9, 2, 0x80, 0x80, 0x40}},
+		{"huge image", []byte{0, 0, 0xbf, 0xff, 0xff, 0x7f, 0xbf, 0xff, 0xff, 0x7f, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if img, err := DecodeWBMP(tt.data); err == nil {
+				t.Errorf("DecodeWBMP(%x) = %v image, want an error", tt.data, img.Bounds())
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	goimage "image"
+	"image/color"
+	"math"
+	"slices"
+)
+
+// Dither is how ImageToWBMPWithDither reduces an image to black and white
+type Dither string
+
+const (
+	// DitherAuto uses DitherDiffusion for photos, and DitherThreshold or DitherOrdered for
+	// line art such as diagrams, maps and charts
+	DitherAuto Dither = "auto"
+	// DitherDiffusion spreads the error of each pixel to its neighbours (Floyd-Steinberg),
+	// which gives photos their best shading but turns thin lines and flat fills into noise
+	DitherDiffusion Dither = "diffusion"
+	// DitherOrdered shades with a regular pattern, keeping flat colour fills apart
+	DitherOrdered Dither = "ordered"
+	// DitherThreshold makes pixels lighter than mid grey white and the others black,
+	// the sharpest for black and white drawings and text
+	DitherThreshold Dither = "threshold"
+)
+
+// ParseDither returns the Dither named s, DitherAuto for an empty s
+func ParseDither(s string) (Dither, error) {
+	switch d := Dither(s); d {
+	case "":
+		return DitherAuto, nil
+	case DitherAuto, DitherDiffusion, DitherOrdered, DitherThreshold:
+		return d, nil
+	}
+	return "", fmt.Errorf("unknown dither %q, use auto, diffusion, ordered or threshold", s)
+}
+
+// imageKind is what an image looks like, for choosing how to convert it
+type imageKind int
+
+const (
+	kindPhoto      imageKind = iota // Many colours and smooth shading
+	kindLineArt                     // A few flat colours, such as a map or chart
+	kindMonochrome                  // Nearly all pixels close to black or white, such as a drawing
+)
+
+// Classification thresholds, over at most classifySamples pixels
+const (
+	classifySamples = 256 * 256
+	// Line art has at most lineArtColors distinct colours, or lineArtTopColors of them
+	// cover lineArtCoverage of the image, leaving room for antialiased edges
+	lineArtColors    = 64
+	lineArtTopColors = 16
+	lineArtCoverage  = 0.9
+	// Monochrome line art has at most monochromeGrey of its pixels in mid grey
+	monochromeGrey = 0.05
+)
+
+// classifyImage guesses whether input is a photo or line art from its colours. Images Go
+// can't decode count as photos, except SVGs, which are drawings.
+func classifyImage(input []byte) imageKind {
+	img, _, err := goimage.Decode(bytes.NewReader(input))
+	if err != nil {
+		if bytes.Contains(input[:min(len(input), 1024)], []byte("<svg")) {
+			return kindLineArt
+		}
+		return kindPhoto
+	}
+
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return kindPhoto
+	}
+	step := max(1, int(math.Sqrt(float64(bounds.Dx()*bounds.Dy())/classifySamples)))
+
+	// Colours are counted at 5 bits per channel, so JPEG noise doesn't make every pixel unique
+	histogram := make(map[uint16]int)
+	samples, grey := 0, 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b := overWhite(img.At(x, y))
+			histogram[uint16(r>>11)<<10|uint16(g>>11)<<5|uint16(b>>11)]++
+			if luma := (19595*r + 38470*g + 7471*b + 1<<15) >> 16; luma > 0x4000 && luma < 0xc000 {
+				grey++
+			}
+			samples++
+		}
+	}
+
+	if len(histogram) > lineArtColors {
+		counts := make([]int, 0, len(histogram))
+		for _, n := range histogram {
+			counts = append(counts, n)
+		}
+		slices.SortFunc(counts, func(a, b int) int { return b - a })
+		top := 0
+		for _, n := range counts[:lineArtTopColors] {
+			top += n
+		}
+		if float64(top) < lineArtCoverage*float64(samples) {
+			return kindPhoto
+		}
+	}
+	if float64(grey) <= monochromeGrey*float64(samples) {
+		return kindMonochrome
+	}
+	return kindLineArt
+}
+
+// overWhite returns the 16-bit RGB of c over a white background
+func overWhite(c color.Color) (r, g, b uint32) {
+	r, g, b, a := c.RGBA()
+	// Colors are alpha-premultiplied, the background shows through by 0xffff-a
+	return r + 0xffff - a, g + 0xffff - a, b + 0xffff - a
+}
+
+// autoDither returns the dither for an image of kind
+func autoDither(kind imageKind) Dither {
+	switch kind {
+	case kindMonochrome:
+		return DitherThreshold
+	case kindLineArt:
+		return DitherOrdered
+	}
+	return DitherDiffusion
+}
+
+// ditherArgs returns the ImageMagick options reducing an image to black and white with d
+func ditherArgs(d Dither) []string {
+	switch d {
+	case DitherOrdered:
+		return []string{"-colorspace", "Gray", "-ordered-dither", "o4x4"}
+	case DitherThreshold:
+		return []string{"-colorspace", "Gray", "-threshold", "50%"}
+	}
+	return []string{"-dither", "FloydSteinberg", "-remap", "pattern:gray50"}
+}
+
+// jpegQuality returns the JPEG quality for an image of kind. Photos hide compression well,
+// the edges of lines and lettering smear at low quality.
+func jpegQuality(kind imageKind) string {
+	if kind == kindPhoto {
+		return "15%"
+	}
+	return "40%"
+}
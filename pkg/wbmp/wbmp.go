@@ -1,13 +1,52 @@
 package image
 
 import (
+	"bytes"
 	"fmt"
+	goimage "image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"os"
 
 	"gopkg.in/gographics/imagick.v3/imagick"
 )
 
+// DefaultMaxPixels is the largest source image CheckImageSize accepts by default. Decoding
+// takes several bytes per pixel in ImageMagick, so this keeps a conversion well within
+// the memory of a 512MB machine.
+const DefaultMaxPixels = 4000000
+
+// CheckImageSize reads the dimensions from a PNG, JPEG or GIF header without decoding the
+// image, and returns an error if it has more than maxPixels pixels. Other formats, such as
+// SVG, are not checked. A maxPixels of zero disables the check.
+func CheckImageSize(input []byte, maxPixels int64) error {
+	if maxPixels <= 0 {
+		return nil
+	}
+	cfg, format, err := goimage.DecodeConfig(bytes.NewReader(input))
+	if err != nil {
+		return nil
+	}
+	if pixels := int64(cfg.Width) * int64(cfg.Height); pixels > maxPixels {
+		return fmt.Errorf("%s image of %dx%d pixels exceeds the limit of %d pixels", format, cfg.Width, cfg.Height, maxPixels)
+	}
+	return nil
+}
+
+// ImageToWBMP converts an image to a WBMP size pixels wide, dithered to suit a photo or
+// line art as DitherAuto does
 func ImageToWBMP(input []byte, size int64) []byte {
+	return ImageToWBMPWithDither(input, size, DitherAuto)
+}
+
+// ImageToWBMPWithDither converts an image to a WBMP size pixels wide, using dither to
+// reduce it to black and white
+func ImageToWBMPWithDither(input []byte, size int64, dither Dither) []byte {
+	if dither == DitherAuto || dither == "" {
+		dither = autoDither(classifyImage(input))
+	}
+
 	imagick.Initialize()
 	defer imagick.Terminate()
 
@@ -20,7 +59,9 @@ func ImageToWBMP(input []byte, size int64) []byte {
 		panic(err)
 	}
 
-	_, err = imagick.ConvertImageCommand([]string{"convert", tmpdir + "/image.png", "-resize", fmt.Sprintf("%d", size), "-dither", "FloydSteinberg", "-remap", "pattern:gray50", tmpdir + "/output.bmp"})
+	args := []string{"convert", tmpdir + "/image.png", "-resize", fmt.Sprintf("%d", size)}
+	args = append(args, ditherArgs(dither)...)
+	_, err = imagick.ConvertImageCommand(append(args, tmpdir+"/output.bmp"))
 	if err != nil {
 		panic(err)
 	}
@@ -35,6 +76,8 @@ func ImageToWBMP(input []byte, size int64) []byte {
 	return output
 }
 
+// ImageToJPEG converts an image to a JPEG size pixels wide, at a higher quality for line
+// art than for photos
 func ImageToJPEG(input []byte, size int64) []byte {
 	imagick.Initialize()
 	defer imagick.Terminate()
@@ -48,7 +91,7 @@ func ImageToJPEG(input []byte, size int64) []byte {
 		panic(err)
 	}
 
-	_, err = imagick.ConvertImageCommand([]string{"convert", tmpdir + "/image.png", "-resize", fmt.Sprintf("%d", size), "-quality", "15%", tmpdir + "/output.jpeg"})
+	_, err = imagick.ConvertImageCommand([]string{"convert", tmpdir + "/image.png", "-resize", fmt.Sprintf("%d", size), "-quality", jpegQuality(classifyImage(input)), tmpdir + "/output.jpeg"})
 	if err != nil {
 		panic(err)
 	}
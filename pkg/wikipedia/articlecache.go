@@ -0,0 +1,126 @@
+package wikipedia
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Rendered article cache limits used by new Wikipedia instances unless changed with
+// SetArticleCacheLimits
+const (
+	DefaultArticleCacheEntries = 200
+	DefaultArticleCacheBytes   = 8 * 1024 * 1024
+)
+
+var (
+	articleCacheEntries = DefaultArticleCacheEntries
+	articleCacheBytes   = DefaultArticleCacheBytes
+)
+
+// SetArticleCacheLimits sets the number of rendered articles and their total size in bytes
+// cached by Wikipedia instances created afterwards. Zero for either disables the cache.
+func SetArticleCacheLimits(maxEntries, maxBytes int) {
+	articleCacheEntries = maxEntries
+	articleCacheBytes = maxBytes
+}
+
+// articleCacheKey identifies a rendering of an article
+type articleCacheKey struct {
+	idx  uint32
+	opts RenderOptions
+}
+
+// articleCacheItem is a cached rendering and its accounted size
+type articleCacheItem struct {
+	key     articleCacheKey
+	article Article
+	size    int
+}
+
+// articleCache is an LRU cache of rendered articles bounded by entry count and bytes
+type articleCache struct {
+	mu         sync.Mutex
+	items      map[articleCacheKey]*list.Element
+	order      *list.List // most recently used at front
+	bytes      int
+	maxEntries int
+	maxBytes   int
+}
+
+func newArticleCache(maxEntries, maxBytes int) *articleCache {
+	return &articleCache{
+		items:      make(map[articleCacheKey]*list.Element),
+		order:      list.New(),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+func (c *articleCache) get(key articleCacheKey) (*Article, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	article := elem.Value.(*articleCacheItem).article
+	return &article, true
+}
+
+// contains reports whether a rendering is cached, without marking it as recently used
+func (c *articleCache) contains(key articleCacheKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.items[key]
+	return ok
+}
+
+func (c *articleCache) put(key articleCacheKey, article *Article) {
+	size := len(article.Content) + len(article.Title) + len(article.URL) + len(article.RedirectTarget)
+	for _, image := range article.Images {
+		size += len(image.ID) + len(image.Alt) + len(image.Caption)
+	}
+	if c.maxEntries <= 0 || size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+
+	// Evict least recently used until the new article fits
+	for c.order.Len() > 0 && (c.order.Len() >= c.maxEntries || c.bytes+size > c.maxBytes) {
+		c.removeElement(c.order.Back())
+	}
+
+	c.items[key] = c.order.PushFront(&articleCacheItem{key: key, article: *article, size: size})
+	c.bytes += size
+}
+
+func (c *articleCache) removeElement(elem *list.Element) {
+	item := c.order.Remove(elem).(*articleCacheItem)
+	delete(c.items, item.key)
+	c.bytes -= item.size
+}
+
+// clear drops every cached article
+func (c *articleCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[articleCacheKey]*list.Element)
+	c.order.Init()
+	c.bytes = 0
+}
+
+// size returns the number of cached articles and their total size in bytes
+func (c *articleCache) size() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len(), c.bytes
+}
@@ -0,0 +1,125 @@
+package wikipedia
+
+import (
+	"encoding/binary"
+	"errors"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ZIM files keep categories in one of two ways. Old ones have a category namespace U,
+// with the list of each category's articles in namespace V as little-endian 32-bit
+// directory entry numbers. Newer dumps that include the wiki's category pages keep them
+// as articles titled "Category:Name" that link to the category's articles.
+const (
+	categoryNamespace     = 'U'
+	categoryListNamespace = 'V'
+	categoryTitlePrefix   = "Category:"
+)
+
+// ListCategories returns the names of the categories in the ZIM file, without the
+// "Category:" prefix, in name order. ZIM files without category data have none.
+func (z *ZIMReader) ListCategories() ([]string, error) {
+	var names []string
+	err := z.scanTitles(categoryNamespace, "", "", func(entry *DirectoryEntry) bool {
+		names = append(names, entry.Title)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, namespace := range []byte{'A', 'C'} {
+		err := z.scanTitles(namespace, categoryTitlePrefix, "", func(entry *DirectoryEntry) bool {
+			if !entry.IsRedirect {
+				names = append(names, strings.TrimPrefix(entry.Title, categoryTitlePrefix))
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
+
+// ListArticlesInCategory returns the articles in a category, named without the
+// "Category:" prefix, in the order the ZIM file lists them. Redirects are followed,
+// and subcategories and other non-article pages are left out.
+func (z *ZIMReader) ListArticlesInCategory(cat string) ([]*DirectoryEntry, error) {
+	cat = strings.TrimPrefix(cat, categoryTitlePrefix)
+	if cat == "" {
+		return nil, errors.New("category not found")
+	}
+
+	if idx, err := z.FindArticleByURL(categoryListNamespace, cat); err == nil {
+		return z.categoryListArticles(idx)
+	}
+	for _, namespace := range []byte{'A', 'C'} {
+		if idx, err := z.FindArticleByURL(namespace, categoryTitlePrefix+cat); err == nil {
+			return z.categoryPageArticles(idx)
+		}
+	}
+	return nil, errors.New("category not found")
+}
+
+// categoryListArticles returns the articles of a V namespace category list
+func (z *ZIMReader) categoryListArticles(idx uint32) ([]*DirectoryEntry, error) {
+	content, _, err := z.GetArticleContent(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	var articles []*DirectoryEntry
+	seen := make(map[uint32]bool)
+	for i := 0; i+4 <= len(content); i += 4 {
+		entry, err := z.GetDirectoryEntry(binary.LittleEndian.Uint32(content[i:]))
+		if err != nil {
+			continue
+		}
+		articles = z.appendCategoryArticle(articles, seen, entry)
+	}
+	return articles, nil
+}
+
+// categoryPageArticles returns the articles a category page links to
+func (z *ZIMReader) categoryPageArticles(idx uint32) ([]*DirectoryEntry, error) {
+	content, _, err := z.GetArticleContent(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	reHref := regexp.MustCompile(`(?i)<a\s[^>]*href=["']([^"']+)["']`)
+	var articles []*DirectoryEntry
+	seen := make(map[uint32]bool)
+	for _, m := range reHref.FindAllStringSubmatch(string(content), -1) {
+		href, ok := internalLinkTarget(html.UnescapeString(m[1]))
+		if !ok {
+			continue
+		}
+		for _, namespace := range []byte{'A', 'C'} {
+			if target, err := z.FindArticleByURL(namespace, href); err == nil {
+				if entry, err := z.GetDirectoryEntry(target); err == nil {
+					articles = z.appendCategoryArticle(articles, seen, entry)
+				}
+				break
+			}
+		}
+	}
+	return articles, nil
+}
+
+// appendCategoryArticle appends the article an entry is or redirects to, unless it is not
+// a content article or already seen
+func (z *ZIMReader) appendCategoryArticle(articles []*DirectoryEntry, seen map[uint32]bool, entry *DirectoryEntry) []*DirectoryEntry {
+	entry, err := z.resolveRedirect(entry)
+	if err != nil || seen[entry.Index] || !IsContentArticle(entry) || strings.HasPrefix(entry.Title, categoryTitlePrefix) {
+		return articles
+	}
+	seen[entry.Index] = true
+	return append(articles, entry)
+}
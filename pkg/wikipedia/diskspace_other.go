@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd)
+
+package wikipedia
+
+// availableDiskSpace is unknown on this platform, so the disk space check is skipped
+func availableDiskSpace(dir string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package wikipedia
+
+import "syscall"
+
+// availableDiskSpace returns the bytes free for unprivileged users on the filesystem
+// holding dir
+func availableDiskSpace(dir string) (uint64, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, false
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), true
+}
@@ -1,12 +1,19 @@
 package wikipedia
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // AvailableDumps lists available Wikipedia dump sources
@@ -21,31 +28,193 @@ var AvailableDumps = map[string]string{
 	"en_maxi": "https://download.kiwix.org/zim/wikipedia/wikipedia_en_all_maxi_2025-08.zim",
 }
 
+// Version is the wapipedia version sent in the User-Agent of downloads. Release builds
+// set it with -ldflags "-X github.com/bevelgacom/wapipedia/pkg/wikipedia.Version=1.0".
+var Version = "dev"
+
+// DefaultDownloadTimeout is how long downloads wait for a mirror to connect, to send its
+// response headers and, while downloading, for the next data, unless changed with
+// SetDownloadTimeout
+const DefaultDownloadTimeout = 30 * time.Second
+
+// maxDownloadRedirects is the number of redirects followed, Kiwix redirects to a mirror
+const maxDownloadRedirects = 10
+
+var downloadTimeout = DefaultDownloadTimeout
+
+// SetDownloadTimeout sets how long downloads wait for a connection, response headers or
+// more data before failing. Zero waits forever.
+func SetDownloadTimeout(timeout time.Duration) {
+	downloadTimeout = timeout
+}
+
+// DefaultDownloadAttempts is how many times in a row a download may fail to connect or
+// be interrupted before DownloadDump gives up, unless changed with SetDownloadAttempts
+const DefaultDownloadAttempts = 8
+
+// Delay before the first retry of a download, doubling after each failure up to
+// maxDownloadRetryDelay
+const (
+	firstDownloadRetryDelay = time.Second
+	maxDownloadRetryDelay   = time.Minute
+)
+
+var downloadAttempts = DefaultDownloadAttempts
+
+// SetDownloadAttempts sets how many times in a row a download may fail before giving up,
+// resuming where it stopped in between. 1 gives up on the first failure.
+func SetDownloadAttempts(attempts int) {
+	downloadAttempts = max(1, attempts)
+}
+
+// downloadRetryDelay returns how long to wait after the given number of failures in a row
+func downloadRetryDelay(failures int) time.Duration {
+	delay := firstDownloadRetryDelay
+	for i := 1; i < failures; i++ {
+		if delay *= 2; delay >= maxDownloadRetryDelay {
+			return maxDownloadRetryDelay
+		}
+	}
+	return delay
+}
+
+// diskSpaceMargin is the space left free after a download, for the search index to start
+// in and so the system doesn't run out entirely
+const diskSpaceMargin = 512 * 1024 * 1024
+
+// ErrInsufficientDiskSpace is returned by DownloadDump when the dump doesn't fit on the
+// destination filesystem
+var ErrInsufficientDiskSpace = errors.New("not enough disk space")
+
+var checkDiskSpace = true
+
+// SetCheckDiskSpace sets whether DownloadDump refuses dumps larger than the free space
+// of the destination directory. Free space may be misreported on network filesystems.
+func SetCheckDiskSpace(check bool) {
+	checkDiskSpace = check
+}
+
+// ensureDiskSpace returns ErrInsufficientDiskSpace if size bytes and diskSpaceMargin don't
+// fit in dir. Unknown sizes and free space pass.
+func ensureDiskSpace(dir string, size int64) error {
+	if !checkDiskSpace || size <= 0 {
+		return nil
+	}
+	free, ok := availableDiskSpace(dir)
+	if !ok {
+		return nil
+	}
+	if uint64(size)+diskSpaceMargin > free {
+		return fmt.Errorf("%w in %s: the dump is %d MB and %d MB should stay free, but only %d MB are available",
+			ErrInsufficientDiskSpace, dir, size/(1024*1024), diskSpaceMargin/(1024*1024), free/(1024*1024))
+	}
+	return nil
+}
+
+// downloadUserAgent identifies wapipedia to mirrors, some reject Go's default
+func downloadUserAgent() string {
+	return "wapipedia/" + Version + " (+https://github.com/bevelgacom/wapipedia)"
+}
+
+// newDownloadClient returns an HTTP client with the download timeout applied to connecting
+// and to response headers, following redirects to mirrors with the same User-Agent. The
+// body isn't covered, downloading a dump takes hours.
+func newDownloadClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: downloadTimeout, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   downloadTimeout,
+			ResponseHeaderTimeout: downloadTimeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxDownloadRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxDownloadRedirects)
+			}
+			req.Header.Set("User-Agent", downloadUserAgent())
+			return nil
+		},
+	}
+}
+
+// newDownloadRequest creates a GET request for a dump URL with the wapipedia User-Agent
+func newDownloadRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dump URL: %w", err)
+	}
+	req.Header.Set("User-Agent", downloadUserAgent())
+	return req, nil
+}
+
 // DownloadProgress represents download progress
 type DownloadProgress struct {
 	TotalBytes      int64
 	DownloadedBytes int64
 	Percentage      float64
+	BytesPerSecond  float64       // Recent download rate
+	ETA             time.Duration // Estimated time remaining, 0 if unknown
+}
+
+// rateWindowDuration is how far back progress rates are averaged
+const rateWindowDuration = 10 * time.Second
+
+// rateSample is a progress counter value at a point in time
+type rateSample struct {
+	at    time.Time
+	value int64
+}
+
+// rateWindow estimates a rolling progress rate from recent samples
+type rateWindow struct {
+	samples []rateSample
+}
+
+// add records the counter value at now and returns the rate per second over the window
+func (r *rateWindow) add(now time.Time, value int64) float64 {
+	// Skip samples closer together than needed to keep the window small
+	if n := len(r.samples); n == 0 || now.Sub(r.samples[n-1].at) >= 100*time.Millisecond {
+		r.samples = append(r.samples, rateSample{at: now, value: value})
+	}
+
+	// Drop samples that fell out of the window, keeping at least one
+	cutoff := now.Add(-rateWindowDuration)
+	i := 0
+	for i < len(r.samples)-1 && r.samples[i].at.Before(cutoff) {
+		i++
+	}
+	r.samples = r.samples[i:]
+
+	elapsed := now.Sub(r.samples[0].at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(value-r.samples[0].value) / elapsed
+}
+
+// estimateRemaining returns the time left at rate for the remaining amount, 0 if unknown
+func estimateRemaining(remaining int64, rate float64) time.Duration {
+	if remaining <= 0 || rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(remaining) / rate * float64(time.Second))
 }
 
 // ProgressCallback is called during download with progress updates
 type ProgressCallback func(progress DownloadProgress)
 
-// DownloadDump downloads a Wikipedia ZIM dump
+// DownloadDump downloads a Wikipedia ZIM dump. language is one of AvailableDumps or the
+// full http(s) URL of any ZIM file, e.g. from https://download.kiwix.org/zim/.
 func DownloadDump(language, destDir string, callback ProgressCallback) (string, error) {
-	url, ok := AvailableDumps[language]
-	if !ok {
-		return "", fmt.Errorf("unknown language/dump: %s. Available: %v", language, getAvailableLanguages())
+	url, filename, err := resolveDumpURL(language)
+	if err != nil {
+		return "", err
 	}
 
 	// Create destination directory
 	if err := os.MkdirAll(destDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create directory: %w", err)
 	}
-
-	// Extract filename from URL
-	parts := strings.Split(url, "/")
-	filename := parts[len(parts)-1]
 	destPath := filepath.Join(destDir, filename)
 
 	// Check if file already exists
@@ -54,15 +223,12 @@ func DownloadDump(language, destDir string, callback ProgressCallback) (string,
 		return destPath, nil
 	}
 
-	// Create HTTP request
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", fmt.Errorf("failed to start download: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP error: %s", resp.Status)
+	// Make sure an arbitrary URL really serves a ZIM file before downloading all of it
+	client := newDownloadClient()
+	if isDumpURL(language) {
+		if err := checkZIMMagic(client, url); err != nil {
+			return "", err
+		}
 	}
 
 	// Create destination file
@@ -73,50 +239,268 @@ func DownloadDump(language, destDir string, callback ProgressCallback) (string,
 	}
 	defer out.Close()
 
-	// Get total size
-	totalSize := resp.ContentLength
+	// Connection failures and interrupted transfers are retried, continuing where the
+	// last attempt stopped. Attempts that receive data start the count again.
+	d := &dumpDownload{client: client, url: url, destDir: destDir, out: out, total: -1, callback: callback}
+	for failures := 0; ; {
+		before := d.downloaded
+		err := d.fetch()
+		if err == nil {
+			break
+		}
+		var transient *transientDownloadError
+		if !errors.As(err, &transient) {
+			os.Remove(tempPath)
+			return "", err
+		}
+		if d.downloaded > before {
+			failures = 0
+		}
+		failures++
+		if failures >= downloadAttempts {
+			os.Remove(tempPath)
+			return "", fmt.Errorf("%w (gave up after %d attempts)", err, failures)
+		}
+		delay := downloadRetryDelay(failures)
+		fmt.Printf("\n%v, retrying in %s\n", err, delay)
+		time.Sleep(delay)
+	}
 
-	// Download with progress
-	var downloaded int64
-	buffer := make([]byte, 32*1024) // 32KB buffer
+	// Rename temp file to final destination
+	if err := os.Rename(tempPath, destPath); err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("failed to rename file: %w", err)
+	}
+
+	return destPath, nil
+}
 
+// dumpDownload is a download in progress, written to out
+type dumpDownload struct {
+	client     *http.Client
+	url        string
+	destDir    string
+	out        *os.File
+	total      int64 // Size of the dump, -1 until a response tells
+	downloaded int64 // Bytes written to out
+	rate       rateWindow
+	callback   ProgressCallback
+}
+
+// transientDownloadError is a download failure worth retrying, such as a dropped
+// connection, a stall or a server error
+type transientDownloadError struct {
+	err error
+}
+
+func (e *transientDownloadError) Error() string { return e.err.Error() }
+func (e *transientDownloadError) Unwrap() error { return e.err }
+
+// transientf returns a transientDownloadError with a formatted message
+func transientf(format string, args ...any) error {
+	return &transientDownloadError{err: fmt.Errorf(format, args...)}
+}
+
+// fetch makes one request for the rest of the dump and writes what arrives to the file.
+// A server that won't send a range makes the download start over.
+func (d *dumpDownload) fetch() error {
+	// A download that receives nothing for the timeout is cancelled instead of hanging
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var stalled *time.Timer
+	if downloadTimeout > 0 {
+		stalled = time.AfterFunc(downloadTimeout, cancel)
+		defer stalled.Stop()
+	}
+
+	req, err := newDownloadRequest(ctx, d.url)
+	if err != nil {
+		return err
+	}
+	if d.downloaded > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", d.downloaded))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return transientf("failed to start download: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		if d.downloaded > 0 {
+			fmt.Printf("\nServer can't resume the download, starting over\n")
+			if err := d.restart(); err != nil {
+				return err
+			}
+		}
+		if d.total < 0 {
+			d.total = resp.ContentLength
+		}
+	case resp.StatusCode == http.StatusPartialContent && d.downloaded > 0:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != d.downloaded {
+			// Not the part asked for, the next attempt fetches the whole dump
+			if err := d.restart(); err != nil {
+				return err
+			}
+			return transientf("server sent the wrong part of the dump")
+		}
+		if d.total < 0 {
+			d.total = size
+		}
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return transientf("HTTP error: %s", resp.Status)
+	default:
+		return fmt.Errorf("HTTP error: %s", resp.Status)
+	}
+
+	// Fail now rather than hours into the download
+	if d.downloaded == 0 {
+		if err := ensureDiskSpace(d.destDir, d.total); err != nil {
+			return err
+		}
+	}
+
+	buffer := make([]byte, 32*1024) // 32KB buffer
 	for {
 		n, err := resp.Body.Read(buffer)
 		if n > 0 {
-			_, writeErr := out.Write(buffer[:n])
-			if writeErr != nil {
-				os.Remove(tempPath)
-				return "", fmt.Errorf("failed to write: %w", writeErr)
+			if _, writeErr := d.out.Write(buffer[:n]); writeErr != nil {
+				return fmt.Errorf("failed to write: %w", writeErr)
 			}
-			downloaded += int64(n)
-
-			if callback != nil {
-				progress := DownloadProgress{
-					TotalBytes:      totalSize,
-					DownloadedBytes: downloaded,
-				}
-				if totalSize > 0 {
-					progress.Percentage = float64(downloaded) / float64(totalSize) * 100
-				}
-				callback(progress)
+			d.downloaded += int64(n)
+			if stalled != nil {
+				stalled.Reset(downloadTimeout)
 			}
+			d.reportProgress()
 		}
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			os.Remove(tempPath)
-			return "", fmt.Errorf("download error: %w", err)
+			if ctx.Err() != nil {
+				return transientf("download stalled: no data for %s", downloadTimeout)
+			}
+			return transientf("download error: %w", err)
 		}
 	}
 
-	// Rename temp file to final destination
-	if err := os.Rename(tempPath, destPath); err != nil {
-		os.Remove(tempPath)
-		return "", fmt.Errorf("failed to rename file: %w", err)
+	// A connection closed early can look like the end of the body
+	if d.total > 0 && d.downloaded < d.total {
+		return transientf("download ended after %d of %d bytes", d.downloaded, d.total)
 	}
+	return nil
+}
 
-	return destPath, nil
+// restart empties the file to download the dump from the start
+func (d *dumpDownload) restart() error {
+	if err := d.out.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write: %w", err)
+	}
+	if _, err := d.out.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to write: %w", err)
+	}
+	d.downloaded = 0
+	d.rate = rateWindow{}
+	return nil
+}
+
+// reportProgress passes the download progress to the callback
+func (d *dumpDownload) reportProgress() {
+	if d.callback == nil {
+		return
+	}
+	progress := DownloadProgress{
+		TotalBytes:      d.total,
+		DownloadedBytes: d.downloaded,
+		BytesPerSecond:  d.rate.add(time.Now(), d.downloaded),
+	}
+	if d.total > 0 {
+		progress.Percentage = float64(d.downloaded) / float64(d.total) * 100
+		progress.ETA = estimateRemaining(d.total-d.downloaded, progress.BytesPerSecond)
+	}
+	d.callback(progress)
+}
+
+// parseContentRange returns the first byte and the full size from a Content-Range
+// header such as "bytes 100-199/1000". The size is -1 when the server sends "*".
+func parseContentRange(header string) (start, size int64, ok bool) {
+	var end int64
+	var total string
+	if _, err := fmt.Sscanf(header, "bytes %d-%d/%s", &start, &end, &total); err != nil {
+		return 0, 0, false
+	}
+	size = -1
+	if total != "*" {
+		if _, err := fmt.Sscan(total, &size); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, size, true
+}
+
+// isDumpURL reports whether a dump name is a URL rather than one of AvailableDumps
+func isDumpURL(language string) bool {
+	return strings.HasPrefix(language, "http://") || strings.HasPrefix(language, "https://")
+}
+
+// resolveDumpURL returns the download URL and file name of a dump name or URL
+func resolveDumpURL(language string) (string, string, error) {
+	if !isDumpURL(language) {
+		dumpURL, ok := AvailableDumps[language]
+		if !ok {
+			return "", "", fmt.Errorf("unknown language/dump: %s. Available: %v, or a full ZIM URL", language, getAvailableLanguages())
+		}
+		return dumpURL, path.Base(dumpURL), nil
+	}
+
+	u, err := neturl.Parse(language)
+	if err != nil || u.Host == "" {
+		return "", "", fmt.Errorf("invalid dump URL %q", language)
+	}
+	filename := path.Base(u.Path)
+	if !strings.HasSuffix(strings.ToLower(filename), ".zim") {
+		return "", "", fmt.Errorf("dump URL %q does not point to a .zim file", language)
+	}
+	return u.String(), filename, nil
+}
+
+// checkZIMMagic fetches the first bytes of a URL and checks they are a ZIM header
+func checkZIMMagic(client *http.Client, url string) error {
+	req, err := newDownloadRequest(context.Background(), url)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", "bytes=0-3")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to check dump: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Servers ignoring the range answer 200 with the whole file, of which only 4 bytes are read
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("HTTP error: %s", resp.Status)
+	}
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(resp.Body, magic); err != nil {
+		return fmt.Errorf("failed to check dump: %w", err)
+	}
+	if binary.LittleEndian.Uint32(magic) != ZimMagicNumber {
+		return fmt.Errorf("%s is not a ZIM file", url)
+	}
+	return nil
+}
+
+// formatETA formats an estimated time remaining for progress output
+func formatETA(eta time.Duration) string {
+	if eta <= 0 {
+		return "unknown"
+	}
+	return eta.Round(time.Second).String()
 }
 
 // ListAvailableDumps returns a list of available dumps
@@ -134,16 +518,15 @@ func getAvailableLanguages() []string {
 
 // GetDumpPath returns the expected path for a dump file
 func GetDumpPath(language, dataDir string) string {
-	url, ok := AvailableDumps[language]
-	if !ok {
+	_, filename, err := resolveDumpURL(language)
+	if err != nil {
 		return ""
 	}
-	parts := strings.Split(url, "/")
-	filename := parts[len(parts)-1]
 	return filepath.Join(dataDir, filename)
 }
 
-// FindZIMFiles finds all ZIM files in a directory
+// FindZIMFiles finds all ZIM files in a directory. Split ZIM files are found by their
+// first part (file.zimaa).
 func FindZIMFiles(dir string) ([]string, error) {
 	var files []string
 
@@ -153,8 +536,12 @@ func FindZIMFiles(dir string) ([]string, error) {
 	}
 
 	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), ".zim") {
-			files = append(files, filepath.Join(dir, entry.Name()))
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		if strings.HasSuffix(strings.ToLower(name), ".zim") || IsSplitZIMPath(name) {
+			files = append(files, filepath.Join(dir, name))
 		}
 	}
 
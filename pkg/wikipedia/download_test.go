@@ -0,0 +1,235 @@
+package wikipedia
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// testDump returns the bytes of a dump for the download tests, starting with the ZIM
+// magic number
+func testDump() []byte {
+	dump := binary.LittleEndian.AppendUint32(nil, ZimMagicNumber)
+	for i := 0; len(dump) < 300*1024; i++ {
+		dump = fmt.Appendf(dump, "block %d of the test dump\n", i)
+	}
+	return dump
+}
+
+// flakyDumpServer serves a dump, dropping the connection after dropAfter bytes of the
+// body in the first drops responses that are longer. It honours ranges unless ignoreRange
+// is set.
+type flakyDumpServer struct {
+	dump        []byte
+	dropAfter   int
+	drops       int
+	ignoreRange bool
+
+	mu       sync.Mutex
+	requests []string // Range header of each request, "" for none
+}
+
+func (s *flakyDumpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start, end := 0, len(s.dump)-1
+	status := http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && !s.ignoreRange {
+		var err error
+		if _, err = fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end); err != nil {
+			_, err = fmt.Sscanf(rangeHeader, "bytes=%d-", &start)
+		}
+		if err != nil || start > end || end >= len(s.dump) {
+			http.Error(w, "bad range", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(s.dump)))
+		status = http.StatusPartialContent
+	}
+	body := s.dump[start : end+1]
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Header.Get("Range"))
+	drop := s.drops > 0 && len(body) > s.dropAfter
+	if drop {
+		s.drops--
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if !drop {
+		w.Write(body)
+		return
+	}
+
+	// Send part of the body and close the connection, as a dropped transfer does
+	w.Write(body[:s.dropAfter])
+	w.(http.Flusher).Flush()
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		panic(err)
+	}
+	conn.Close()
+}
+
+// startFlakyDumpServer starts s and returns the URL of its dump
+func startFlakyDumpServer(t *testing.T, s *flakyDumpServer) string {
+	// The test dump is small, but the temporary directory may lack the diskSpaceMargin
+	SetCheckDiskSpace(false)
+	t.Cleanup(func() { SetCheckDiskSpace(true) })
+
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return server.URL + "/wikipedia_test.zim"
+}
+
+// newTestDumpDownload returns a download of url into a file in a temporary directory
+func newTestDumpDownload(t *testing.T, url string) *dumpDownload {
+	dir := t.TempDir()
+	out, err := os.Create(filepath.Join(dir, "test.zim.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { out.Close() })
+	return &dumpDownload{client: newDownloadClient(), url: url, destDir: dir, out: out, total: -1}
+}
+
+// downloadedBytes returns what a download wrote to its file
+func downloadedBytes(t *testing.T, d *dumpDownload) []byte {
+	data, err := os.ReadFile(d.out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDumpDownloadResumes(t *testing.T) {
+	s := &flakyDumpServer{dump: testDump(), dropAfter: 100 * 1024, drops: 2}
+	d := newTestDumpDownload(t, startFlakyDumpServer(t, s))
+
+	// Both dropped transfers are transient, each continuing where the last stopped
+	for attempt := 1; attempt <= 2; attempt++ {
+		err := d.fetch()
+		var transient *transientDownloadError
+		if !errors.As(err, &transient) {
+			t.Fatalf("fetch() attempt %d error = %v, want a transient one", attempt, err)
+		}
+		if want := int64(attempt * s.dropAfter); d.downloaded != want {
+			t.Fatalf("fetch() attempt %d downloaded %d bytes, want %d", attempt, d.downloaded, want)
+		}
+	}
+	if err := d.fetch(); err != nil {
+		t.Fatalf("fetch() attempt 3 error = %v", err)
+	}
+
+	if got := downloadedBytes(t, d); !bytes.Equal(got, s.dump) {
+		t.Errorf("downloaded %d bytes, want the %d of the dump", len(got), len(s.dump))
+	}
+	if d.total != int64(len(s.dump)) {
+		t.Errorf("download total = %d, want %d", d.total, len(s.dump))
+	}
+	wantRanges := []string{"", "bytes=102400-", "bytes=204800-"}
+	if fmt.Sprint(s.requests) != fmt.Sprint(wantRanges) {
+		t.Errorf("requested ranges %q, want %q", s.requests, wantRanges)
+	}
+}
+
+func TestDumpDownloadRestartsWithoutRanges(t *testing.T) {
+	s := &flakyDumpServer{dump: testDump(), dropAfter: 100 * 1024, drops: 1, ignoreRange: true}
+	d := newTestDumpDownload(t, startFlakyDumpServer(t, s))
+
+	var transient *transientDownloadError
+	if err := d.fetch(); !errors.As(err, &transient) {
+		t.Fatalf("fetch() error = %v, want a transient one", err)
+	}
+	// The server answers the range with the whole dump, which replaces what was downloaded
+	if err := d.fetch(); err != nil {
+		t.Fatalf("fetch() after the drop error = %v", err)
+	}
+
+	if got := downloadedBytes(t, d); !bytes.Equal(got, s.dump) {
+		t.Errorf("downloaded %d bytes, want the %d of the dump", len(got), len(s.dump))
+	}
+	if d.downloaded != int64(len(s.dump)) {
+		t.Errorf("download counted %d bytes, want %d", d.downloaded, len(s.dump))
+	}
+	if len(s.requests) != 2 || s.requests[1] != "bytes=102400-" {
+		t.Errorf("requested ranges %q, want a resume asked for", s.requests)
+	}
+}
+
+func TestDumpDownloadWrongRange(t *testing.T) {
+	dump := testDump()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Range") == "" {
+			w.Write(dump)
+			return
+		}
+		// A part starting elsewhere than asked for
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(dump)-1, len(dump)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(dump)
+	}))
+	defer server.Close()
+
+	d := newTestDumpDownload(t, server.URL)
+	d.out.Write(dump[:1000])
+	d.downloaded = 1000
+
+	var transient *transientDownloadError
+	if err := d.fetch(); !errors.As(err, &transient) {
+		t.Fatalf("fetch() of the wrong part error = %v, want a transient one", err)
+	}
+	if d.downloaded != 0 {
+		t.Fatalf("fetch() of the wrong part kept %d bytes, want the download restarted", d.downloaded)
+	}
+	if err := d.fetch(); err != nil {
+		t.Fatalf("fetch() after the restart error = %v", err)
+	}
+	if got := downloadedBytes(t, d); !bytes.Equal(got, dump) || requests != 2 {
+		t.Errorf("downloaded %d bytes in %d requests, want the %d of the dump in 2", len(got), requests, len(dump))
+	}
+}
+
+func TestDownloadDumpResumes(t *testing.T) {
+	s := &flakyDumpServer{dump: testDump(), dropAfter: 150 * 1024, drops: 1}
+	url := startFlakyDumpServer(t, s)
+	dir := t.TempDir()
+
+	var last DownloadProgress
+	path, err := DownloadDump(url, dir, func(progress DownloadProgress) { last = progress })
+	if err != nil {
+		t.Fatalf("DownloadDump() error = %v", err)
+	}
+
+	if path != filepath.Join(dir, "wikipedia_test.zim") {
+		t.Errorf("DownloadDump() = %s, want wikipedia_test.zim in %s", path, dir)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, s.dump) {
+		t.Errorf("downloaded %d bytes, want the %d of the dump", len(got), len(s.dump))
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+	if last.DownloadedBytes != int64(len(s.dump)) || last.TotalBytes != int64(len(s.dump)) || last.Percentage != 100 {
+		t.Errorf("last progress = %+v, want the whole dump", last)
+	}
+	// The magic number check, the dropped transfer and its resume
+	wantRanges := []string{"bytes=0-3", "", "bytes=153600-"}
+	if fmt.Sprint(s.requests) != fmt.Sprint(wantRanges) {
+		t.Errorf("requested ranges %q, want %q", s.requests, wantRanges)
+	}
+}
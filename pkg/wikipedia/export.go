@@ -0,0 +1,253 @@
+package wikipedia
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Defaults of ExportOptions
+const (
+	DefaultExportLimit    = 1000 // articles exported with ExportOptions.All
+	DefaultExportDeckSize = 1397 // deck size limit in bytes, that of the Nokia 7110
+)
+
+// An exported deck's prolog, card and navigation links take exportDeckOverhead bytes,
+// pages of content get the rest of the deck size limit but at least minExportPageSize
+const (
+	exportDeckOverhead = 400
+	minExportPageSize  = 400
+)
+
+// exportIndexFile is the first deck of the exported article index
+const exportIndexFile = "index.wml"
+
+// reExportLink matches the article links convertHTMLLinksToWML writes, with their ID and text
+var reExportLink = regexp.MustCompile(`<a href="/article\?id=([^"]*)">(.*?)</a>`)
+
+// ExportOptions selects the articles ExportWML writes and the size of their decks
+type ExportOptions struct {
+	IDs         []uint32 // Articles to export, by directory index
+	All         bool     // Export the first Limit articles in URL order instead of IDs
+	Limit       int      // Articles to export with All, 0 for DefaultExportLimit
+	MaxDeckSize int      // Largest deck in bytes, 0 for DefaultExportDeckSize
+}
+
+// ExportReport counts what ExportWML wrote
+type ExportReport struct {
+	Articles int      // articles written
+	Decks    int      // deck files written, including those of the index
+	Skipped  []string // articles that were not written, with the reason
+}
+
+// ExportWML renders articles as static WML decks in outDir, for any web server to serve.
+// Each article is split into pages written as <index>-<page>.wml, page numbers starting
+// at 1, and index.wml lists them all by title. Links between exported articles point at
+// their decks, links to other articles are reduced to their text and images are left out.
+func (w *Wikipedia) ExportWML(ctx context.Context, outDir string, opts ExportOptions) (*ExportReport, error) {
+	maxDeckSize := opts.MaxDeckSize
+	if maxDeckSize <= 0 {
+		maxDeckSize = DefaultExportDeckSize
+	}
+	pageSize := max(maxDeckSize-exportDeckOverhead, minExportPageSize)
+
+	ids := opts.IDs
+	if opts.All {
+		limit := opts.Limit
+		if limit <= 0 {
+			limit = DefaultExportLimit
+		}
+		var err error
+		if ids, err = w.exportableArticles(limit); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	report := &ExportReport{}
+	renderOpts := RenderOptions{SupportsTables: true, FollowRedirects: true, MaxDeckSize: maxDeckSize}
+	var articles []*Article
+	// Entries exported, both those asked for and the articles their HTML redirects lead to,
+	// with the index the decks of their article are named after
+	exported := make(map[uint32]uint32)
+	for i, idx := range ids {
+		if i > 0 && i%100 == 0 {
+			fmt.Printf("Rendering articles: %d of %d\n", i, len(ids))
+		}
+
+		canonical, err := w.reader.canonicalIndex(idx)
+		if err != nil {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("%d: %v", idx, err))
+			continue
+		}
+		if _, ok := exported[canonical]; ok {
+			continue
+		}
+		entry, err := w.reader.GetDirectoryEntry(canonical)
+		if err != nil || !w.reader.hasHTMLContent(entry) {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("%d: not an article", idx))
+			continue
+		}
+
+		article, err := w.GetArticleWithOptions(ctx, canonical, renderOpts)
+		if err != nil {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("%d: %v", idx, err))
+			continue
+		}
+		if article.IsEmpty() {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("%d (%s): no readable content", idx, article.Title))
+			continue
+		}
+		if _, ok := exported[article.Index]; ok {
+			exported[canonical] = article.Index
+			continue
+		}
+		exported[canonical], exported[article.Index] = article.Index, article.Index
+		articles = append(articles, article)
+	}
+
+	// Links are rewritten once every exported article is known
+	for _, article := range articles {
+		pages := SplitContentByDeckSize(w.exportLinks(article.Content, exported), pageSize)
+		title := FormatTitle(article.Title)
+		for page, content := range pages {
+			prev, next := "", ""
+			if page > 0 {
+				prev = exportDeckName(article.Index, page-1)
+			}
+			if page+1 < len(pages) {
+				next = exportDeckName(article.Index, page+1)
+			}
+			deck := exportDeck(title, "<b>"+title+"</b>", content, prev, next, true)
+			if err := os.WriteFile(filepath.Join(outDir, exportDeckName(article.Index, page)), []byte(deck), 0644); err != nil {
+				return report, fmt.Errorf("failed to write article %d: %w", article.Index, err)
+			}
+			report.Decks++
+		}
+		report.Articles++
+	}
+
+	decks, err := writeExportIndex(outDir, articles, pageSize)
+	report.Decks += decks
+	return report, err
+}
+
+// exportableArticles returns the indices of the first limit HTML articles in URL order
+func (w *Wikipedia) exportableArticles(limit int) ([]uint32, error) {
+	var ids []uint32
+	offset := uint32(0)
+	for len(ids) < limit && offset < w.reader.GetArticleCount() {
+		entries, next, err := w.ListArticles(offset, limit-len(ids))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			ids = append(ids, entry.Index)
+		}
+		offset = next
+	}
+	return ids, nil
+}
+
+// exportLinks points the article links in content at the first deck of their article if
+// it is exported, and replaces the others with their text
+func (w *Wikipedia) exportLinks(content string, exported map[uint32]uint32) string {
+	return reExportLink.ReplaceAllStringFunc(content, func(link string) string {
+		m := reExportLink.FindStringSubmatch(link)
+		id := m[1]
+		if i := strings.LastIndexByte(id, ':'); i >= 0 {
+			id = id[i+1:]
+		}
+		if idx, err := strconv.ParseUint(id, 10, 32); err == nil {
+			if canonical, err := w.reader.canonicalIndex(uint32(idx)); err == nil {
+				if deckIdx, ok := exported[canonical]; ok {
+					return fmt.Sprintf(`<a href="%s">%s</a>`, exportDeckName(deckIdx, 0), m[2])
+				}
+			}
+		}
+		return m[2]
+	})
+}
+
+// writeExportIndex writes the decks listing the exported articles by title, the first as
+// index.wml, and returns how many it wrote
+func writeExportIndex(outDir string, articles []*Article, pageSize int) (int, error) {
+	sorted := slices.Clone(articles)
+	slices.SortFunc(sorted, func(a, b *Article) int {
+		return cmp.Compare(a.Title, b.Title)
+	})
+
+	var b strings.Builder
+	for _, article := range sorted {
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a><br/>\n", exportDeckName(article.Index, 0), FormatTitle(article.Title))
+	}
+	if b.Len() == 0 {
+		b.WriteString("No articles were exported.")
+	}
+
+	pages := SplitContentByDeckSize(strings.TrimSuffix(b.String(), "\n"), pageSize)
+	for page, content := range pages {
+		prev, next := "", ""
+		if page > 0 {
+			prev = exportIndexName(page - 1)
+		}
+		if page+1 < len(pages) {
+			next = exportIndexName(page + 1)
+		}
+		heading := fmt.Sprintf("<b>Articles</b> (%d)", len(articles))
+		if err := os.WriteFile(filepath.Join(outDir, exportIndexName(page)), []byte(exportDeck("Articles", heading, content, prev, next, false)), 0644); err != nil {
+			return page, fmt.Errorf("failed to write index: %w", err)
+		}
+	}
+	return len(pages), nil
+}
+
+// exportDeckName returns the file name of page (from 0) of the exported article idx
+func exportDeckName(idx uint32, page int) string {
+	return fmt.Sprintf("%d-%d.wml", idx, page+1)
+}
+
+// exportIndexName returns the file name of page (from 0) of the exported article index
+func exportIndexName(page int) string {
+	if page == 0 {
+		return exportIndexFile
+	}
+	return fmt.Sprintf("index-%d.wml", page+1)
+}
+
+// exportDeck returns a single-card WML deck with a heading, content and links to the
+// previous and next deck, if any, and with indexLink to the index. title and heading are
+// escaped WML.
+func exportDeck(title, heading, content, prev, next string, indexLink bool) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?>` + "\n")
+	b.WriteString(`<!DOCTYPE wml PUBLIC "-//WAPFORUM//DTD WML 1.1//EN" "http://www.wapforum.org/DTD/wml_1.1.xml">` + "\n\n")
+	b.WriteString("<wml>\n")
+	fmt.Fprintf(&b, "<card id=\"page\" title=\"%s\">\n", title)
+	fmt.Fprintf(&b, "<p>\n%s\n</p>\n\n<p>\n%s\n</p>\n", heading, content)
+
+	var links []string
+	if prev != "" {
+		links = append(links, fmt.Sprintf(`<a href="%s">&lt; Back</a>`, prev))
+	}
+	if next != "" {
+		links = append(links, fmt.Sprintf(`<a href="%s">More &gt;</a>`, next))
+	}
+	if indexLink {
+		links = append(links, fmt.Sprintf(`<a href="%s">Index</a>`, exportIndexFile))
+	}
+	if len(links) > 0 {
+		fmt.Fprintf(&b, "\n<p>\n%s\n</p>\n", strings.Join(links, "\n"))
+	}
+	b.WriteString("</card>\n</wml>\n")
+	return b.String()
+}
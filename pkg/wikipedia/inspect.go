@@ -0,0 +1,150 @@
+package wikipedia
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DefaultInspectSampleSize is the number of clusters InspectZIM reads the compression type
+// of unless InspectOptions sets another sample size or asks for all of them
+const DefaultInspectSampleSize = 1000
+
+// InspectOptions controls how many clusters InspectZIM looks at
+type InspectOptions struct {
+	Full       bool // Read the compression type of every cluster instead of a sample
+	SampleSize int  // Clusters to sample, spread over the file, 0 for DefaultInspectSampleSize
+}
+
+// InspectReport describes the header, MIME types, cluster compression and metadata of a ZIM file
+type InspectReport struct {
+	MajorVersion     uint16
+	MinorVersion     uint16
+	UUID             string
+	ArticleCount     uint32 // directory entries, including redirects and resources
+	ClusterCount     uint32
+	MainPage         string // namespace and URL of the main page, empty when there is none
+	MIMETypes        []string
+	ClustersSampled  uint32
+	Compression      []CompressionCount // sampled clusters per compression type, most used first
+	ExtendedClusters int                // sampled clusters with 8-byte blob offsets
+	Metadata         []MetadataEntry    // M namespace entries, in title order
+	MetadataError    error              // why Metadata stops short, nil when it lists every entry
+}
+
+// CompressionCount is the number of sampled clusters using one compression type
+type CompressionCount struct {
+	Type     byte // compression type from the cluster info byte
+	Name     string
+	Clusters int
+}
+
+// MetadataEntry is an entry of the M namespace. Only text/plain values are read, the
+// others, such as the illustrations, are described by their MIME type and size.
+type MetadataEntry struct {
+	Key      string
+	Value    string
+	MIMEType string
+	Size     int
+}
+
+// compressionName returns the name of a cluster compression type, as readCluster handles it
+func compressionName(compression byte) string {
+	switch compression {
+	case 0, 1:
+		return "none"
+	case 2:
+		return "zlib"
+	case 3:
+		return "bzip2"
+	case 4:
+		return "deflate"
+	case 5:
+		return "xz or zstd"
+	case 6:
+		return "zstd"
+	}
+	return "unknown"
+}
+
+// InspectZIM reads the header, MIME type list and metadata of a ZIM file, and the cluster
+// info byte of a sample of its clusters (or all of them with InspectOptions.Full). Only
+// failing to open the file is an error, unreadable clusters and metadata values are skipped
+// and a failure to list the metadata is in InspectReport.MetadataError.
+func InspectZIM(zimPath string, opts InspectOptions) (*InspectReport, error) {
+	z, err := NewZIMReaderWithOptions(zimPath, ZIMReaderOptions{LowMemory: true})
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	report := &InspectReport{
+		MajorVersion: z.header.MajorVersion,
+		MinorVersion: z.header.MinorVersion,
+		UUID:         z.UUID(),
+		ArticleCount: z.header.ArticleCount,
+		ClusterCount: z.header.ClusterCount,
+		MIMETypes:    slices.Clone(z.mimeTypes),
+	}
+
+	// The main page as Wikipedia.GetMainPageIndex finds it
+	mainPage, err := z.canonicalIndex(z.header.MainPage)
+	if z.header.MainPage == NoMainPage || err != nil {
+		mainPage, err = z.FindWellKnownEntry(wellKnownMainPage)
+	}
+	if err == nil {
+		if entry, err := z.GetDirectoryEntry(mainPage); err == nil {
+			report.MainPage = fmt.Sprintf("%c/%s", entry.Namespace, entry.URL)
+		}
+	}
+
+	sampleSize := opts.SampleSize
+	if sampleSize <= 0 {
+		sampleSize = DefaultInspectSampleSize
+	}
+	step := uint32(1)
+	if !opts.Full && report.ClusterCount > uint32(sampleSize) {
+		step = report.ClusterCount / uint32(sampleSize)
+	}
+
+	counts := make(map[byte]int)
+	var clusterInfo [1]byte
+	for clusterNum := uint32(0); clusterNum < report.ClusterCount; clusterNum += step {
+		if _, err := z.file.ReadAt(clusterInfo[:], int64(z.clusterPtrs[clusterNum])); err != nil {
+			continue
+		}
+		report.ClustersSampled++
+		counts[clusterInfo[0]&0x0F]++
+		if clusterInfo[0]&clusterExtendedFlag != 0 {
+			report.ExtendedClusters++
+		}
+	}
+	for compression, n := range counts {
+		report.Compression = append(report.Compression, CompressionCount{Type: compression, Name: compressionName(compression), Clusters: n})
+	}
+	slices.SortFunc(report.Compression, func(a, b CompressionCount) int {
+		return cmp.Or(b.Clusters-a.Clusters, int(a.Type)-int(b.Type))
+	})
+
+	err = z.scanTitles('M', "", "", func(entry *DirectoryEntry) bool {
+		if entry.IsRedirect {
+			return true
+		}
+		content, err := z.GetBlob(entry.ClusterNum, entry.BlobNum)
+		if err != nil {
+			return true
+		}
+		meta := MetadataEntry{Key: entry.URL, MIMEType: z.GetMIMEType(entry.MimeType), Size: len(content)}
+		if strings.HasPrefix(meta.MIMEType, "text/plain") {
+			meta.Value, _ = z.GetMetadata(entry.URL)
+		}
+		report.Metadata = append(report.Metadata, meta)
+		return true
+	})
+	if err != nil {
+		report.MetadataError = fmt.Errorf("failed to list metadata: %w", err)
+	}
+
+	return report, nil
+}
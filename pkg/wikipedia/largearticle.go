@@ -0,0 +1,108 @@
+package wikipedia
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// DefaultMaxArticleBytes is the HTML size above which articles are truncated unless
+// changed with SetMaxArticleBytes
+const DefaultMaxArticleBytes = 2 * 1024 * 1024
+
+// articleSegmentBytes is the HTML size articles are converted in, see splitHTMLSegments
+const articleSegmentBytes = 256 * 1024
+
+// truncatedArticleNotice ends the HTML of a truncated article
+const truncatedArticleNotice = `<p><i>This article is too long to show in full and has been truncated.</i></p>`
+
+var maxArticleBytes = DefaultMaxArticleBytes
+
+// SetMaxArticleBytes sets the HTML size above which articles are truncated before
+// conversion. Zero disables truncation.
+func SetMaxArticleBytes(n int) {
+	maxArticleBytes = n
+}
+
+var (
+	// Block ends an article can be cut after, and the table tags they must not be inside of
+	reTruncateBoundary = regexp.MustCompile(`(?i)<(/?table|/p|/h[1-6]|/ul|/ol|/dl)\b[^>]*>`)
+
+	// Segments start at a heading, or at a paragraph if a section is very long
+	reSegmentBoundary = regexp.MustCompile(`(?i)<(table|/table|h[2-6]|p)[\s>]`)
+)
+
+// truncateArticleHTML cuts htmlContent to at most maxBytes, after the last paragraph,
+// heading or list that is not inside a table, and appends a notice saying so. Content
+// within the limit is returned unchanged.
+func truncateArticleHTML(htmlContent string, maxBytes int) (string, bool) {
+	if maxBytes <= 0 || len(htmlContent) <= maxBytes {
+		return htmlContent, false
+	}
+
+	head := htmlContent[:maxBytes]
+	cut := -1
+	depth := 0
+	for _, loc := range reTruncateBoundary.FindAllStringSubmatchIndex(head, -1) {
+		switch strings.ToLower(head[loc[2]:loc[3]]) {
+		case "table":
+			depth++
+		case "/table":
+			depth = max(depth-1, 0)
+		default:
+			if depth == 0 {
+				cut = loc[1]
+			}
+		}
+	}
+	// Without a block end, at least don't cut inside a tag or character
+	if cut < 0 {
+		cut = max(strings.LastIndexByte(head, '<'), 0)
+	}
+
+	return head[:cut] + truncatedArticleNotice, true
+}
+
+// splitHTMLSegments splits the HTML of an article into segments of about segmentBytes,
+// so the converter's regular expressions and placeholder replacements work on small
+// strings instead of the whole of a very long article. Segments start at a second level
+// heading, or at a smaller heading or paragraph if a section is four times the segment
+// size, and never inside a table. Short articles are a single segment.
+func splitHTMLSegments(htmlContent string, segmentBytes int) []string {
+	if len(htmlContent) <= segmentBytes {
+		return []string{htmlContent}
+	}
+
+	var segments []string
+	start := 0
+	depth := 0
+	for _, loc := range reSegmentBoundary.FindAllStringSubmatchIndex(htmlContent, -1) {
+		tag := strings.ToLower(htmlContent[loc[2]:loc[3]])
+		switch {
+		case tag == "table":
+			depth++
+			continue
+		case tag == "/table":
+			depth = max(depth-1, 0)
+			continue
+		case depth > 0:
+			continue
+		}
+
+		size := loc[0] - start
+		if size >= 4*segmentBytes || (tag == "h2" && size >= segmentBytes) {
+			segments = append(segments, htmlContent[start:loc[0]])
+			start = loc[0]
+		}
+	}
+	return append(segments, htmlContent[start:])
+}
+
+// capArticleHTML truncates the HTML of an article over the maxArticleBytes limit
+func capArticleHTML(title, htmlContent string) string {
+	capped, truncated := truncateArticleHTML(htmlContent, maxArticleBytes)
+	if truncated {
+		log.Printf("Truncated article %q from %d to %d bytes", title, len(htmlContent), len(capped))
+	}
+	return capped
+}
@@ -0,0 +1,186 @@
+package wikipedia
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// reTableTag matches opening and closing table tags, for tableDepth
+var reTableTag = regexp.MustCompile(`(?i)<(/?)table[\s>]`)
+
+// tableDepth returns how many tables are open at the end of htmlContent
+func tableDepth(htmlContent string) int {
+	depth := 0
+	for _, m := range reTableTag.FindAllStringSubmatch(htmlContent, -1) {
+		if m[1] == "" {
+			depth++
+		} else {
+			depth--
+		}
+	}
+	return depth
+}
+
+// largeArticleHTML returns the HTML of an article of at least size bytes, made of
+// sections of paragraphs, lists and tables, some of them large and nested
+func largeArticleHTML(size int) string {
+	var b strings.Builder
+	b.WriteString(`<html><head><title>Large</title></head><body><h1 id="firstHeading">Large</h1>`)
+	b.WriteString("<p>Lead paragraph of the large article.</p>")
+	for section := 0; b.Len() < size; section++ {
+		fmt.Fprintf(&b, `<h2 id="S%d">Section %d</h2>`, section, section)
+		for p := range 20 {
+			fmt.Fprintf(&b, "<p>Paragraph %d of section %d, with <b>bold</b> &amp; <a href=\"Paris\">a link</a>.</p>", p, section)
+		}
+		fmt.Fprintf(&b, "<h3>Subsection %d</h3><ul><li>First</li><li>Second</li></ul>", section)
+
+		// Tables of tens of kilobytes hold paragraphs and headings, ends of blocks that
+		// are inside of them
+		b.WriteString(`<table class="wikitable"><tr><th>Year</th><th>Notes</th></tr>`)
+		rows := 100
+		if section%3 == 0 {
+			rows = 2000
+		}
+		for row := range rows {
+			fmt.Fprintf(&b, "<tr><td>%d</td><td><p>Row %d of section %d.</p></td></tr>", 1900+row, row, section)
+			if row == rows/2 {
+				b.WriteString(`<tr><td colspan="2"><table><tr><td><h4>Nested</h4><p>Nested table.</p></td></tr></table></td></tr>`)
+			}
+		}
+		b.WriteString("</table>")
+		fmt.Fprintf(&b, "<p>Closing paragraph of section %d.</p>", section)
+	}
+	b.WriteString("</body></html>")
+	return b.String()
+}
+
+func TestTruncateArticleHTML(t *testing.T) {
+	html := largeArticleHTML(2 * DefaultMaxArticleBytes)
+
+	if got, truncated := truncateArticleHTML(html, len(html)); truncated || got != html {
+		t.Errorf("truncateArticleHTML() at the article's size truncated = %v, want the article unchanged", truncated)
+	}
+	if got, truncated := truncateArticleHTML(html, 0); truncated || got != html {
+		t.Errorf("truncateArticleHTML() without a limit truncated = %v, want the article unchanged", truncated)
+	}
+
+	// Limits spread over the article, many of them inside the large tables
+	for maxBytes := 10000; maxBytes < len(html); maxBytes += 333331 {
+		got, truncated := truncateArticleHTML(html, maxBytes)
+		if !truncated {
+			t.Fatalf("truncateArticleHTML(%d) truncated = false, want true", maxBytes)
+		}
+		head, ok := strings.CutSuffix(got, truncatedArticleNotice)
+		if !ok {
+			t.Fatalf("truncateArticleHTML(%d) does not end with the notice: %q", maxBytes, got[max(len(got)-200, 0):])
+		}
+		if len(head) > maxBytes || !strings.HasPrefix(html, head) {
+			t.Fatalf("truncateArticleHTML(%d) = %d bytes, want a start of the article of at most %d", maxBytes, len(head), maxBytes)
+		}
+		if depth := tableDepth(head); depth != 0 {
+			t.Errorf("truncateArticleHTML(%d) cuts inside %d tables, after %q", maxBytes, depth, head[max(len(head)-100, 0):])
+		}
+		if !reTruncateBoundary.MatchString(head[strings.LastIndexByte(head, '<'):]) {
+			t.Errorf("truncateArticleHTML(%d) does not cut after a block, but after %q", maxBytes, head[max(len(head)-100, 0):])
+		}
+
+		// The cut is after the last block outside of a table within the limit
+		depth := 0
+		rest := html[len(head):maxBytes]
+		for _, loc := range reTruncateBoundary.FindAllStringSubmatchIndex(rest, -1) {
+			switch strings.ToLower(rest[loc[2]:loc[3]]) {
+			case "table":
+				depth++
+			case "/table":
+				depth--
+			default:
+				if depth == 0 {
+					t.Errorf("truncateArticleHTML(%d) cuts at %d, before the block ending at %d", maxBytes, len(head), len(head)+loc[1])
+				}
+			}
+		}
+	}
+}
+
+func TestTruncateArticleHTMLWithoutBlocks(t *testing.T) {
+	html := "<div>" + strings.Repeat("<span>word</span> ", 1000) + "</div>"
+	got, truncated := truncateArticleHTML(html, 1000)
+	head, ok := strings.CutSuffix(got, truncatedArticleNotice)
+	if !truncated || !ok {
+		t.Fatalf("truncateArticleHTML() = %q, %v, want it truncated with the notice", got, truncated)
+	}
+	// Without a block end the cut is before a tag
+	if len(head) > 1000 || !strings.HasPrefix(html, head) || !strings.HasPrefix(html[len(head):], "<") {
+		t.Errorf("truncateArticleHTML() cuts at %d, inside a tag: %q", len(head), html[len(head):len(head)+10])
+	}
+}
+
+func TestSplitHTMLSegments(t *testing.T) {
+	html := largeArticleHTML(2 * DefaultMaxArticleBytes)
+
+	if segments := splitHTMLSegments(html, len(html)); len(segments) != 1 || segments[0] != html {
+		t.Errorf("splitHTMLSegments() of a short article = %d segments, want the article", len(segments))
+	}
+
+	for _, segmentBytes := range []int{articleSegmentBytes, 64 * 1024, 4096} {
+		t.Run(fmt.Sprint(segmentBytes), func(t *testing.T) {
+			segments := splitHTMLSegments(html, segmentBytes)
+			if len(segments) < 2 {
+				t.Fatalf("splitHTMLSegments() = %d segments, want several", len(segments))
+			}
+			if joined := strings.Join(segments, ""); joined != html {
+				t.Fatalf("splitHTMLSegments() segments join to %d bytes, want the %d of the article", len(joined), len(html))
+			}
+
+			depth := 0
+			for i, segment := range segments {
+				if segment == "" {
+					t.Fatalf("segment %d is empty", i)
+				}
+				if i > 0 {
+					if !reSegmentBoundary.MatchString(segment[:min(len(segment), 10)]) || strings.HasPrefix(strings.ToLower(segment), "<table") {
+						t.Errorf("segment %d does not start at a heading or paragraph: %q", i, segment[:min(len(segment), 50)])
+					}
+					if depth != 0 {
+						t.Errorf("segment %d starts inside %d tables", i, depth)
+					}
+				}
+				depth += tableDepth(segment)
+				// Segments only grow past four times their size for tables
+				if len(segment) > 4*segmentBytes+1024 && !strings.Contains(segment, "<table") {
+					t.Errorf("segment %d is %d bytes", i, len(segment))
+				}
+			}
+		})
+	}
+}
+
+func TestConvertLargeArticle(t *testing.T) {
+	html := largeArticleHTML(2 * articleSegmentBytes)
+	last := strings.LastIndex(html, "<h2")
+	lastHeading := html[strings.Index(html[last:], ">")+last+1 : strings.Index(html[last:], "</h2>")+last]
+
+	// Content of every segment is kept, with one separator between them
+	content := convertHTMLToWML(html, RenderOptions{SupportsTables: true})
+	for _, want := range []string{"Lead paragraph of the large article.", "<b>Section 0</b>", "<b>" + lastHeading + "</b>", "Closing paragraph of section 0."} {
+		if !strings.Contains(content, want) {
+			t.Errorf("convertHTMLToWML() of a large article lacks %q", want)
+		}
+	}
+	if strings.Contains(content, "<br/><br/><br/>") {
+		t.Errorf("convertHTMLToWML() of a large article stacks breaks between segments")
+	}
+	if !strings.Contains(content, "Row 1 of section") {
+		t.Errorf("convertHTMLToWML() of a large article lacks the tables")
+	}
+
+	capped, truncated := truncateArticleHTML(html, articleSegmentBytes)
+	if !truncated {
+		t.Fatal("truncateArticleHTML() truncated = false, want true")
+	}
+	if content := convertHTMLToWML(capped, RenderOptions{SupportsTables: true}); !strings.HasSuffix(content, "<i>This article is too long to show in full and has been truncated.</i><br/>") {
+		t.Errorf("converted truncated article ends with %q, want the notice", content[max(len(content)-100, 0):])
+	}
+}
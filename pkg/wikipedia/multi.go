@@ -0,0 +1,196 @@
+package wikipedia
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MultiWikipedia serves several ZIM files side by side. Article and image IDs carry the
+// name of their wiki as a prefix ("en:1234"); IDs without a known prefix go to the
+// default wiki, which is the first one added.
+type MultiWikipedia struct {
+	wikis map[string]*Wikipedia
+	names []string // in the order the wikis were added
+}
+
+// NewMultiWikipedia creates an empty MultiWikipedia
+func NewMultiWikipedia() *MultiWikipedia {
+	return &MultiWikipedia{wikis: make(map[string]*Wikipedia)}
+}
+
+// Add registers w under name. Its article and image links will carry the name as prefix.
+func (m *MultiWikipedia) Add(name string, w *Wikipedia) error {
+	if _, exists := m.wikis[name]; exists {
+		return fmt.Errorf("wiki %q is already loaded", name)
+	}
+	if strings.Contains(name, ":") {
+		return fmt.Errorf("invalid wiki name %q: must not contain ':'", name)
+	}
+	w.name = name
+	// Cached articles link with the previous name
+	w.articles.clear()
+	m.wikis[name] = w
+	m.names = append(m.names, name)
+	return nil
+}
+
+// Default returns the wiki serving IDs without a prefix, nil if none is loaded
+func (m *MultiWikipedia) Default() *Wikipedia {
+	if len(m.names) == 0 {
+		return nil
+	}
+	return m.wikis[m.names[0]]
+}
+
+// Get returns the wiki loaded under name
+func (m *MultiWikipedia) Get(name string) (*Wikipedia, bool) {
+	w, ok := m.wikis[name]
+	return w, ok
+}
+
+// Names returns the names of the loaded wikis, the default first
+func (m *MultiWikipedia) Names() []string {
+	return append([]string(nil), m.names...)
+}
+
+// Resolve returns the wiki an ID refers to and the ID without its prefix
+func (m *MultiWikipedia) Resolve(id string) (*Wikipedia, string, error) {
+	if name, rest, ok := strings.Cut(id, ":"); ok {
+		if w, found := m.wikis[name]; found {
+			return w, rest, nil
+		}
+	}
+	w := m.Default()
+	if w == nil {
+		return nil, "", fmt.Errorf("no wiki loaded")
+	}
+	return w, id, nil
+}
+
+// ResolveArticleID parses an article ID such as "en:1234" or "1234"
+func (m *MultiWikipedia) ResolveArticleID(id string) (*Wikipedia, uint32, error) {
+	w, rest, err := m.Resolve(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	idx, err := strconv.ParseUint(rest, 10, 32)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid article ID %q", id)
+	}
+	return w, uint32(idx), nil
+}
+
+// GetArticle retrieves an article by its (possibly prefixed) ID
+func (m *MultiWikipedia) GetArticle(id string) (*Article, error) {
+	w, idx, err := m.ResolveArticleID(id)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetArticle(idx)
+}
+
+// GetImage retrieves an image by its (possibly prefixed) numeric ID or path
+func (m *MultiWikipedia) GetImage(id string) ([]byte, string, error) {
+	w, rest, err := m.Resolve(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if idx, parseErr := strconv.ParseUint(rest, 10, 32); parseErr == nil {
+		return w.GetImageByID(uint32(idx))
+	}
+	return w.GetImage(rest)
+}
+
+// Search searches all loaded wikis and merges the results by score
+func (m *MultiWikipedia) Search(ctx context.Context, query string, maxResults int) ([]SearchResult, error) {
+	results, _, err := m.SearchWithOffset(ctx, query, 0, maxResults)
+	return results, err
+}
+
+// SearchWithOffset searches all loaded wikis, merges the results by score and returns
+// up to limit of them starting at offset, along with the total number of matches. Once
+// ctx is done the wikis left are not searched and ctx.Err() is returned.
+func (m *MultiWikipedia) SearchWithOffset(ctx context.Context, query string, offset, limit int) ([]SearchResult, int, error) {
+	if len(m.names) == 1 {
+		return m.Default().SearchWithOffset(ctx, query, offset, limit)
+	}
+
+	offset = max(offset, 0)
+	var merged []SearchResult
+	total := 0
+	for _, name := range m.names {
+		// Any of the first offset+limit merged results may come from this wiki
+		results, count, err := m.wikis[name].SearchWithOffset(ctx, query, 0, offset+limit)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, 0, ctxErr
+		}
+		if err != nil {
+			log.Printf("Search in wiki %q failed: %v", name, err)
+			continue
+		}
+		merged = append(merged, results...)
+		total += count
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+	if offset >= len(merged) {
+		return []SearchResult{}, total, nil
+	}
+	return merged[offset:min(offset+limit, len(merged))], total, nil
+}
+
+// Autocomplete returns titles starting with prefix from the default wiki
+func (m *MultiWikipedia) Autocomplete(prefix string, limit int) ([]string, error) {
+	w := m.Default()
+	if w == nil {
+		return nil, nil
+	}
+	return w.Autocomplete(prefix, limit)
+}
+
+// Suggest returns a "did you mean" title from the default wiki
+func (m *MultiWikipedia) Suggest(query string) (string, error) {
+	w := m.Default()
+	if w == nil {
+		return "", nil
+	}
+	return w.Suggest(query)
+}
+
+// Close closes all loaded wikis
+func (m *MultiWikipedia) Close() error {
+	var firstErr error
+	for _, name := range m.names {
+		if err := m.wikis[name].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// FormatArticleID returns the ID of entry idx in the named wiki, unprefixed for ""
+func FormatArticleID(name string, idx uint32) string {
+	if name == "" {
+		return strconv.FormatUint(uint64(idx), 10)
+	}
+	return name + ":" + strconv.FormatUint(uint64(idx), 10)
+}
+
+// WikiNameFromPath derives a short wiki name from a ZIM file name, e.g. "en" for
+// wikipedia_en_all_nopic_2025-12.zim. Names that don't follow the Kiwix pattern are
+// used whole, without extension.
+func WikiNameFromPath(path string) string {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	parts := strings.Split(base, "_")
+	if len(parts) >= 3 && parts[1] != "" {
+		return strings.ToLower(parts[1])
+	}
+	return strings.ReplaceAll(base, ":", "")
+}
@@ -4,18 +4,26 @@ import (
 	"context"
 	cryptorand "crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"html"
 	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+	"unicode"
 
 	"github.com/blugelabs/bluge"
+	"github.com/blugelabs/bluge/search/highlight"
+	"golang.org/x/text/unicode/norm"
 )
 
 // BlugeIndex handles the persistent search index
@@ -27,8 +35,12 @@ type BlugeIndex struct {
 	cacheMu    sync.RWMutex
 	randomPool []uint32 // Pre-sampled pool of random article IDs
 	poolMu     sync.Mutex
-	poolIdx    int          // Current position in random pool
-	poolReady  chan struct{} // Closed when pool is ready
+	poolIdx    int                // Current position in random pool
+	poolReady  chan struct{}      // Closed when pool is ready
+	poolStop   context.CancelFunc // Stops filling the pool, on Close
+	poolDone   chan struct{}      // Closed when filling the pool has stopped
+	zimUUID    string             // UUID of the ZIM file the index was built from, "" for old indexes
+	writer     *bluge.Writer      // Writer of an in-memory index, nil for persisted ones
 }
 
 // DefaultIndexPath returns the default index path for a ZIM file
@@ -42,10 +54,37 @@ type indexEntry struct {
 	idx   uint32
 	title string
 	url   string
+	docID uint32 // directory index the document is stored under, the redirect's own for redirects
+	// redirect marks an alias title indexed for the article at idx
+	redirect bool
 }
 
+// IndexOptions controls what BuildBlugeIndex puts into the index
+type IndexOptions struct {
+	// FullText also indexes and stores the plain-text article body so searches match
+	// body text and results get snippets. This reads every article and makes the
+	// index several times larger.
+	FullText bool
+	// Workers is the number of goroutines building documents, 0 for one per CPU
+	Workers int
+	// BatchSize is the number of documents written to the index at once, 0 for
+	// DefaultIndexBatchSize. Smaller batches use less memory.
+	BatchSize int
+	// Redirects also indexes the titles of redirect entries, pointing at the article
+	// they resolve to, so alternate spellings and aliases are found. This makes the
+	// index larger.
+	Redirects bool
+}
+
+// DefaultIndexBatchSize is the number of documents per index write unless configured
+const DefaultIndexBatchSize = 10000
+
+// metaDocID is the ID of the document holding facts about the index itself, such as the
+// UUID of the ZIM file it was built from. Article documents are numbered, so it can't clash.
+const metaDocID = "meta"
+
 // BuildBlugeIndex creates a new Bluge index from a ZIM file using multiple workers
-func BuildBlugeIndex(zimPath, indexPath string) error {
+func BuildBlugeIndex(zimPath, indexPath string, opts IndexOptions) error {
 	// Open ZIM file
 	reader, err := NewZIMReader(zimPath)
 	if err != nil {
@@ -55,7 +94,7 @@ func BuildBlugeIndex(zimPath, indexPath string) error {
 
 	// Remove existing index if it exists
 	if _, err := os.Stat(indexPath); err == nil {
-		fmt.Printf("Removing existing index at %s\n", indexPath)
+		log.Printf("Removing existing index at %s", indexPath)
 		if err := os.RemoveAll(indexPath); err != nil {
 			return fmt.Errorf("failed to remove existing index: %w", err)
 		}
@@ -69,13 +108,66 @@ func BuildBlugeIndex(zimPath, indexPath string) error {
 	}
 	defer writer.Close()
 
+	log.Printf("Building Bluge index from %s", zimPath)
+	return writeBlugeIndex(reader, writer, opts, indexPath)
+}
+
+// BuildInMemoryIndex builds a Bluge index of a ZIM file in memory, for ZIM files small
+// enough that a persisted index isn't worth it. The index is lost when closed.
+func BuildInMemoryIndex(zimPath string, opts IndexOptions) (*BlugeIndex, error) {
+	reader, err := NewZIMReader(zimPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ZIM file: %w", err)
+	}
+	defer reader.Close()
+
+	writer, err := bluge.OpenWriter(bluge.InMemoryOnlyConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create index: %w", err)
+	}
+	log.Printf("Building in-memory search index from %s", zimPath)
+	if err := writeBlugeIndex(reader, writer, opts, "memory"); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	indexReader, err := writer.Reader()
+	if err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+
+	idx, err := newBlugeIndex(indexReader, "")
+	if err != nil {
+		indexReader.Close()
+		writer.Close()
+		return nil, err
+	}
+	// The writer holds the in-memory segments, it is closed with the index
+	idx.writer = writer
+	return idx, nil
+}
+
+// writeBlugeIndex indexes the articles of a ZIM file with writer, using multiple workers.
+// target names where the index goes in progress messages.
+func writeBlugeIndex(reader *ZIMReader, writer *bluge.Writer, opts IndexOptions, target string) error {
 	entryCount := reader.GetArticleCount()
-	numWorkers := runtime.NumCPU()
-	batchSize := 10000
+	numWorkers := opts.Workers
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultIndexBatchSize
+	}
 	channelBuffer := numWorkers * 1000
 
-	fmt.Printf("Building Bluge index from %s\n", zimPath)
-	fmt.Printf("Total entries to process: %d (using %d workers)\n", entryCount, numWorkers)
+	log.Printf("Total entries to process: %d (using %d workers, batch size %d)", entryCount, numWorkers, batchSize)
+	if opts.FullText {
+		log.Println("Full-text indexing enabled: article bodies will be indexed")
+	}
+	if opts.Redirects {
+		log.Println("Redirect indexing enabled: redirect titles will be indexed")
+	}
 
 	// Channels for pipeline
 	entryChan := make(chan indexEntry, channelBuffer)
@@ -95,6 +187,9 @@ func BuildBlugeIndex(zimPath, indexPath string) error {
 	var workerWg sync.WaitGroup
 	var writerWg sync.WaitGroup
 
+	// Redirect titles already queued, by target index and lowercased title
+	seenRedirects := make(map[string]struct{})
+
 	// Start reader goroutine - reads directory entries from ZIM
 	readerWg.Add(1)
 	go func() {
@@ -107,25 +202,37 @@ func BuildBlugeIndex(zimPath, indexPath string) error {
 				continue
 			}
 
-			// Only index articles (namespace 'A' or 'C')
-			if entry.Namespace != 'A' && entry.Namespace != 'C' {
-				continue
-			}
-
-			// Skip redirects
+			// Skip redirects, or index their title for the article they resolve to
 			if entry.IsRedirect {
+				if !opts.Redirects || !isArticleNamespace(entry.Namespace) || isResourceURL(entry.URL) {
+					continue
+				}
+				target, err := reader.resolveRedirect(entry)
+				if err != nil || !IsContentArticle(target) || !reader.hasHTMLContent(target) {
+					continue
+				}
+				// The target is already found under its own title
+				if strings.EqualFold(entry.Title, target.Title) {
+					continue
+				}
+				key := strconv.FormatUint(uint64(target.Index), 10) + ":" + strings.ToLower(entry.Title)
+				if _, dup := seenRedirects[key]; dup {
+					continue
+				}
+				seenRedirects[key] = struct{}{}
+
+				entryChan <- indexEntry{
+					idx:      target.Index,
+					title:    entry.Title,
+					url:      target.URL,
+					docID:    i,
+					redirect: true,
+				}
 				continue
 			}
 
-			// Skip resource files
-			url := strings.ToLower(entry.URL)
-			if strings.HasSuffix(url, ".css") || strings.HasSuffix(url, ".js") ||
-				strings.HasSuffix(url, ".png") || strings.HasSuffix(url, ".jpg") ||
-				strings.HasSuffix(url, ".jpeg") || strings.HasSuffix(url, ".gif") ||
-				strings.HasSuffix(url, ".svg") || strings.HasSuffix(url, ".ico") ||
-				strings.HasSuffix(url, ".woff") || strings.HasSuffix(url, ".woff2") ||
-				strings.HasSuffix(url, ".ttf") || strings.HasSuffix(url, ".eot") ||
-				strings.Contains(url, "/-/") {
+			// Only index articles (namespace 'A' or 'C')
+			if !IsContentArticle(entry) || !reader.hasHTMLContent(entry) {
 				continue
 			}
 
@@ -133,6 +240,7 @@ func BuildBlugeIndex(zimPath, indexPath string) error {
 				idx:   i,
 				title: entry.Title,
 				url:   entry.URL,
+				docID: i,
 			}
 		}
 	}()
@@ -145,7 +253,7 @@ func BuildBlugeIndex(zimPath, indexPath string) error {
 
 			for entry := range entryChan {
 				// Create document
-				doc := bluge.NewDocument(strconv.FormatUint(uint64(entry.idx), 10))
+				doc := bluge.NewDocument(strconv.FormatUint(uint64(entry.docID), 10))
 
 				// Add title field (searchable and stored)
 				doc.AddField(bluge.NewTextField("title", entry.title).StoreValue().SearchTermPositions())
@@ -153,12 +261,27 @@ func BuildBlugeIndex(zimPath, indexPath string) error {
 				// Add title_lower for case-insensitive exact matching
 				doc.AddField(bluge.NewKeywordField("title_exact", strings.ToLower(entry.title)).StoreValue())
 
+				// Add title_folded for case and accent insensitive matching ("zurich" finds "Zürich")
+				doc.AddField(bluge.NewKeywordField("title_folded", foldTitle(entry.title)))
+
 				// Add URL field (stored only)
 				doc.AddField(bluge.NewKeywordField("url", entry.url).StoreValue())
 
 				// Add index as numeric field for retrieval
 				doc.AddField(bluge.NewNumericField("idx", float64(entry.idx)).StoreValue())
 
+				// Mark redirect titles so random articles and counts skip them
+				if entry.redirect {
+					doc.AddField(bluge.NewKeywordField("redirect", "true"))
+				}
+
+				// Add plain-text body (stored for search snippets) for full-text indexes
+				if opts.FullText && !entry.redirect {
+					if body := articleBodyText(reader, entry.idx); body != "" {
+						doc.AddField(bluge.NewTextField("body", body).StoreValue().HighlightMatches())
+					}
+				}
+
 				docChan <- doc
 			}
 		}()
@@ -177,6 +300,8 @@ func BuildBlugeIndex(zimPath, indexPath string) error {
 
 		batch := bluge.NewBatch()
 		batchCount := 0
+		var rate rateWindow
+		rate.add(time.Now(), 0)
 
 		for doc := range docChan {
 			batch.Insert(doc)
@@ -187,7 +312,10 @@ func BuildBlugeIndex(zimPath, indexPath string) error {
 			// Log progress
 			if processed%logInterval == 0 {
 				pct := (processed * 100) / uint64(entryCount)
-				fmt.Printf("Building index: %d%% complete (%d articles indexed)\n", pct, count)
+				perSecond := rate.add(time.Now(), int64(processed))
+				eta := estimateRemaining(int64(entryCount)-int64(processed), perSecond)
+				log.Printf("Building index: %d%% complete (%d articles indexed, %.0f articles/s, ETA %s)",
+					pct, count, perSecond, formatETA(eta))
 			}
 
 			// Flush batch periodically
@@ -204,15 +332,17 @@ func BuildBlugeIndex(zimPath, indexPath string) error {
 			}
 		}
 
-		// Flush remaining documents
-		if batchCount > 0 {
-			if err := writer.Batch(batch); err != nil {
-				select {
-				case errChan <- fmt.Errorf("failed to write final batch: %w", err):
-				default:
-				}
-				return
+		// Flush remaining documents, with the metadata document
+		meta := bluge.NewDocument(metaDocID)
+		meta.AddField(bluge.NewKeywordField("meta", "true"))
+		meta.AddField(bluge.NewKeywordField("zim_uuid", reader.UUID()).StoreValue())
+		batch.Insert(meta)
+		if err := writer.Batch(batch); err != nil {
+			select {
+			case errChan <- fmt.Errorf("failed to write final batch: %w", err):
+			default:
 			}
+			return
 		}
 	}()
 
@@ -230,10 +360,42 @@ func BuildBlugeIndex(zimPath, indexPath string) error {
 	}
 
 	finalCount := articleCount.Load()
-	fmt.Printf("Index complete: %d articles indexed to %s\n", finalCount, indexPath)
+	log.Printf("Index complete: %d articles indexed to %s", finalCount, target)
 	return nil
 }
 
+// articlesQuery matches every article document, leaving out indexed redirect titles and
+// the metadata document
+func articlesQuery() bluge.Query {
+	return bluge.NewBooleanQuery().
+		AddMust(bluge.NewMatchAllQuery()).
+		AddMustNot(bluge.NewTermQuery("true").SetField("redirect")).
+		AddMustNot(bluge.NewTermQuery("true").SetField("meta"))
+}
+
+// articleBodyText returns the plain text of an article for full-text indexing
+func articleBodyText(reader *ZIMReader, idx uint32) string {
+	content, mimeType, err := reader.GetArticleContent(idx)
+	if err != nil || !strings.Contains(mimeType, "html") {
+		return ""
+	}
+	return wmlToPlainText(HTMLToWML(string(content)))
+}
+
+// reWMLTag matches a WML tag
+var reWMLTag = regexp.MustCompile(`<[^>]*>`)
+
+// wmlToPlainText strips WML tags and entities, leaving the text a user would read
+func wmlToPlainText(wml string) string {
+	text := reWMLTag.ReplaceAllString(wml, " ")
+	text = strings.ReplaceAll(text, "$$", "$")
+	text = html.UnescapeString(text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// snippetSize is the approximate length of search result snippets in bytes
+const snippetSize = 120
+
 // randomPoolSize is the number of random article IDs to pre-sample
 const randomPoolSize = 10000
 
@@ -249,23 +411,72 @@ func LoadBlugeIndex(indexPath string) (*BlugeIndex, error) {
 		return nil, fmt.Errorf("failed to open index: %w", err)
 	}
 
+	idx, err := newBlugeIndex(reader, indexPath)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+// newBlugeIndex wraps an open index reader and starts filling its random pool
+func newBlugeIndex(reader *bluge.Reader, path string) (*BlugeIndex, error) {
+	zimUUID, err := readIndexZIMUUID(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index metadata: %w", err)
+	}
+
 	idx := &BlugeIndex{
 		reader:     reader,
-		path:       indexPath,
+		path:       path,
 		randomPool: make([]uint32, 0, randomPoolSize),
 		poolReady:  make(chan struct{}),
+		poolDone:   make(chan struct{}),
+		zimUUID:    zimUUID,
 	}
 
 	// Pre-populate the random pool in background
-	go idx.fillRandomPool()
+	ctx, cancel := context.WithCancel(context.Background())
+	idx.poolStop = cancel
+	go idx.fillRandomPool(ctx)
 
 	return idx, nil
 }
 
+// readIndexZIMUUID returns the ZIM UUID stored in the metadata document, or "" for
+// indexes built before it was stored
+func readIndexZIMUUID(reader *bluge.Reader) (string, error) {
+	query := bluge.NewTermQuery(metaDocID).SetField("_id")
+	docMatches, err := reader.Search(context.Background(), bluge.NewTopNSearch(1, query))
+	if err != nil {
+		return "", err
+	}
+	match, err := docMatches.Next()
+	if err != nil || match == nil {
+		return "", err
+	}
+
+	var zimUUID string
+	err = match.VisitStoredFields(func(field string, value []byte) bool {
+		if field == "zim_uuid" {
+			zimUUID = string(value)
+			return false
+		}
+		return true
+	})
+	return zimUUID, err
+}
+
+// ZIMUUID returns the UUID of the ZIM file the index was built from, or "" if the index
+// is too old to record it
+func (b *BlugeIndex) ZIMUUID() string {
+	return b.zimUUID
+}
+
 // fillRandomPool uses reservoir sampling to collect random article IDs
-func (b *BlugeIndex) fillRandomPool() {
+func (b *BlugeIndex) fillRandomPool(ctx context.Context) {
+	defer close(b.poolDone)
 	log.Println("Building random article pool using reservoir sampling...")
-	ctx := context.Background()
 
 	// Seed RNG
 	var buf [8]byte
@@ -276,7 +487,7 @@ func (b *BlugeIndex) fillRandomPool() {
 	rng := rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(buf[:]))))
 
 	// Stream through all documents with reservoir sampling
-	query := bluge.NewMatchAllQuery()
+	query := articlesQuery()
 	searchReq := bluge.NewAllMatches(query)
 
 	docMatches, err := b.reader.Search(ctx, searchReq)
@@ -288,7 +499,7 @@ func (b *BlugeIndex) fillRandomPool() {
 	reservoir := make([]uint32, 0, randomPoolSize)
 	n := 0
 
-	for {
+	for ctx.Err() == nil {
 		docMatch, err := docMatches.Next()
 		if err != nil {
 			log.Printf("Error iterating for random pool: %v", err)
@@ -351,79 +562,124 @@ func (b *BlugeIndex) fillRandomPool() {
 	log.Printf("Random article pool ready: %d articles sampled", len(reservoir))
 }
 
-// Close closes the Bluge index reader
+// Close closes the Bluge index reader, and the writer of an in-memory index, once the random pool has stopped filling from it
 func (b *BlugeIndex) Close() error {
+	if b.poolStop != nil {
+		b.poolStop()
+		<-b.poolDone
+	}
+	var err error
 	if b.reader != nil {
-		return b.reader.Close()
+		err = b.reader.Close()
 	}
-	return nil
+	if b.writer != nil {
+		err = errors.Join(err, b.writer.Close())
+	}
+	return err
 }
 
-// Search performs a search query and returns results
-func (b *BlugeIndex) Search(query string, maxResults int) ([]SearchResult, error) {
+// Search performs a search query and returns results, giving up when ctx is done
+func (b *BlugeIndex) Search(ctx context.Context, query string, maxResults int) ([]SearchResult, error) {
+	results, _, err := b.SearchWithOffset(ctx, query, 0, maxResults)
+	return results, err
+}
+
+// SearchWithOffset returns up to limit results starting at offset, along with the total
+// number of matching documents. Bluge skips the first offset hits itself, so deep pages
+// don't collect and load every earlier result.
+func (b *BlugeIndex) SearchWithOffset(ctx context.Context, query string, offset, limit int) ([]SearchResult, uint64, error) {
 	query = strings.TrimSpace(query)
-	if query == "" {
-		return nil, nil
+	if query == "" || limit <= 0 {
+		return nil, 0, nil
 	}
+	offset = max(offset, 0)
 
-	log.Printf("Bluge search: query=%q, maxResults=%d", query, maxResults)
-	ctx := context.Background()
+	log.Printf("Bluge search: query=%q, offset=%d, limit=%d", query, offset, limit)
 
-	// Build a query that matches title field
-	// Use a boolean query with should clauses for flexible matching
-	queryLower := strings.ToLower(query)
+	// A leading "+" asks for articles whose title has every term of the query
+	query, andMode := strings.CutPrefix(query, AndQueryPrefix)
 
-	// Pre-allocate queries slice to avoid reallocations
-	queryCapacity := 5
-	if len(query) <= 3 {
-		queryCapacity = 4 // No fuzzy query for short queries
+	// Quoted phrases must match as a whole, the rest of the query matches as before
+	phrases, rest := parseQuotedPhrases(query)
+	if len(phrases) == 0 && rest == "" {
+		return nil, 0, nil
 	}
-	queries := make([]bluge.Query, 0, queryCapacity)
 
-	// 1. Exact title match (highest priority)
-	exactQuery := bluge.NewTermQuery(queryLower).SetField("title_exact").SetBoost(100.0)
-	queries = append(queries, exactQuery)
-
-	// 2. Prefix match on exact title
-	prefixQuery := bluge.NewPrefixQuery(queryLower).SetField("title_exact").SetBoost(50.0)
-	queries = append(queries, prefixQuery)
-
-	// 3. Match query on title (full-text search with analysis)
-	matchQuery := bluge.NewMatchQuery(query).SetField("title").SetBoost(10.0)
-	queries = append(queries, matchQuery)
-
-	// 4. Fuzzy match for typo tolerance (skip for short queries - expensive)
-	if len(query) > 3 {
-		fuzzyQuery := bluge.NewFuzzyQuery(queryLower).SetField("title_exact").SetFuzziness(1).SetBoost(5.0)
-		queries = append(queries, fuzzyQuery)
+	results, total, err := b.search(ctx, searchQuery(phrases, rest, andMode), offset, limit)
+	if err == nil && total == 0 && andMode && rest != "" {
+		log.Printf("No title has all of %q, matching any of them", rest)
+		results, total, err = b.search(ctx, searchQuery(phrases, rest, false), offset, limit)
+	}
+	if err != nil {
+		return nil, 0, err
 	}
 
-	// 5. Wildcard for partial matches
-	wildcardQuery := bluge.NewWildcardQuery("*" + queryLower + "*").SetField("title_exact").SetBoost(3.0)
-	queries = append(queries, wildcardQuery)
+	log.Printf("Bluge search complete: %d results (of %d) for %q", len(results), total, query)
+	return results, total, nil
+}
 
-	// Combine with boolean OR
+// AndQueryPrefix starts a search query whose terms must all be in the title of an article,
+// e.g. "+new york" doesn't find articles only mentioning "new". Without such articles the
+// terms match like in any other query.
+const AndQueryPrefix = "+"
+
+// searchQuery builds the query for the quoted phrases and the rest of a search query. The
+// phrases must all match, and the terms of the rest either all in the title with andMode,
+// or at least one of them in any way without (unless there are phrases to match).
+func searchQuery(phrases []string, rest string, andMode bool) bluge.Query {
 	boolQuery := bluge.NewBooleanQuery()
-	for _, q := range queries {
-		boolQuery.AddShould(q)
+	if rest != "" {
+		for _, q := range termQueries(rest) {
+			boolQuery.AddShould(q)
+		}
+	}
+	if andMode {
+		for _, term := range strings.Fields(rest) {
+			termQuery := bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery(term).SetField("title")).
+				AddShould(bluge.NewPrefixQuery(strings.ToLower(term)).SetField("title")).
+				SetMinShould(1)
+			boolQuery.AddMust(termQuery)
+		}
+	} else if len(phrases) == 0 {
+		boolQuery.SetMinShould(1)
+	}
+	for _, phrase := range phrases {
+		phraseQuery := bluge.NewBooleanQuery().
+			AddShould(bluge.NewMatchPhraseQuery(phrase).SetField("title").SetBoost(200.0)).
+			AddShould(bluge.NewMatchPhraseQuery(phrase).SetField("body").SetBoost(20.0)).
+			SetMinShould(1)
+		boolQuery.AddMust(phraseQuery)
 	}
-	boolQuery.SetMinShould(1)
+	return boolQuery
+}
 
+// search runs a query and returns up to limit results starting at offset, with snippets
+// of full-text indexes, along with the total number of matching documents
+func (b *BlugeIndex) search(ctx context.Context, boolQuery bluge.Query, offset, limit int) ([]SearchResult, uint64, error) {
 	// Execute search
-	searchReq := bluge.NewTopNSearch(maxResults, boolQuery).WithStandardAggregations()
+	searchReq := bluge.NewTopNSearch(limit, boolQuery).SetFrom(offset).WithStandardAggregations().IncludeLocations()
 	docMatches, err := b.reader.Search(ctx, searchReq)
 	if err != nil {
 		log.Printf("Bluge search error: %v", err)
-		return nil, fmt.Errorf("search failed: %w", err)
+		return nil, 0, fmt.Errorf("search failed: %w", err)
 	}
 
 	// Pre-allocate results slice
-	results := make([]SearchResult, 0, maxResults)
+	results := make([]SearchResult, 0, limit)
+
+	// Snippets are the best ~120 character fragment of the body around the matches
+	highlighter := highlight.NewSimpleHighlighter(
+		highlight.NewSimpleFragmenterSized(snippetSize),
+		highlight.NewHTMLFragmentFormatterTags("<b>", "</b>"),
+		highlight.DefaultSeparator,
+	)
 
 	// Iterate through results
 	match, err := docMatches.Next()
 	for err == nil && match != nil {
 		var result SearchResult
+		var body []byte
 		result.Score = match.Score
 
 		// Load stored fields
@@ -431,6 +687,8 @@ func (b *BlugeIndex) Search(query string, maxResults int) ([]SearchResult, error
 			switch field {
 			case "title":
 				result.Title = string(value)
+			case "body":
+				body = append([]byte(nil), value...)
 			case "url":
 				result.URL = string(value)
 			case "idx":
@@ -450,17 +708,202 @@ func (b *BlugeIndex) Search(query string, maxResults int) ([]SearchResult, error
 			break
 		}
 
+		if locations := match.Locations["body"]; len(body) > 0 && len(locations) > 0 {
+			result.Snippet = highlighter.BestFragment(locations, body)
+		}
+
 		results = append(results, result)
 		match, err = docMatches.Next()
 	}
 
 	if err != nil {
 		log.Printf("Bluge search iteration error: %v", err)
-		return nil, fmt.Errorf("error iterating results: %w", err)
+		return nil, 0, fmt.Errorf("error iterating results: %w", err)
+	}
+
+	return results, docMatches.Aggregations().Count(), nil
+}
+
+// termQueries returns the clauses matching an unquoted query against titles, and bodies
+// of full-text indexes, from exact title matches down to typo tolerant ones
+func termQueries(query string) []bluge.Query {
+	// Build a query that matches title field
+	// Use a boolean query with should clauses for flexible matching
+	queryLower := strings.ToLower(query)
+
+	// Pre-allocate queries slice to avoid reallocations
+	queryCapacity := 8
+	if len(query) <= 3 {
+		queryCapacity = 7 // No fuzzy query for short queries
+	}
+	queries := make([]bluge.Query, 0, queryCapacity)
+
+	// 1. Exact title match (highest priority)
+	exactQuery := bluge.NewTermQuery(queryLower).SetField("title_exact").SetBoost(100.0)
+	queries = append(queries, exactQuery)
+
+	// 2. Prefix match on exact title
+	prefixQuery := bluge.NewPrefixQuery(queryLower).SetField("title_exact").SetBoost(50.0)
+	queries = append(queries, prefixQuery)
+
+	// Exact and prefix matches ignoring accents, on indexes built with title_folded
+	queryFolded := foldTitle(query)
+	queries = append(queries, bluge.NewTermQuery(queryFolded).SetField("title_folded").SetBoost(90.0))
+	queries = append(queries, bluge.NewPrefixQuery(queryFolded).SetField("title_folded").SetBoost(45.0))
+
+	// 3. Match query on title (full-text search with analysis)
+	matchQuery := bluge.NewMatchQuery(query).SetField("title").SetBoost(10.0)
+	queries = append(queries, matchQuery)
+
+	// 4. Fuzzy match for typo tolerance (skip for short queries - expensive)
+	if len(query) > 3 {
+		fuzzyQuery := bluge.NewFuzzyQuery(queryLower).SetField("title_exact").SetFuzziness(1).SetBoost(5.0)
+		queries = append(queries, fuzzyQuery)
+	}
+
+	// 5. Wildcard for partial matches
+	wildcardQuery := bluge.NewWildcardQuery("*" + queryLower + "*").SetField("title_exact").SetBoost(3.0)
+	queries = append(queries, wildcardQuery)
+
+	// 6. Match query on body text (full-text indexes only), boosted below title matches
+	bodyQuery := bluge.NewMatchQuery(query).SetField("body").SetBoost(1.0)
+	queries = append(queries, bodyQuery)
+
+	return queries
+}
+
+// reQuotedPhrase matches a phrase in double quotes in a search query
+var reQuotedPhrase = regexp.MustCompile(`"([^"]*)"`)
+
+// parseQuotedPhrases splits a search query into its double quoted phrases and the rest
+// of the query, e.g. `"new york" pizza` into ["new york"] and "pizza". An unmatched quote
+// is ignored.
+func parseQuotedPhrases(query string) ([]string, string) {
+	var phrases []string
+	for _, m := range reQuotedPhrase.FindAllStringSubmatch(query, -1) {
+		if phrase := strings.TrimSpace(m[1]); phrase != "" {
+			phrases = append(phrases, phrase)
+		}
+	}
+	rest := reQuotedPhrase.ReplaceAllString(query, " ")
+	rest = strings.Join(strings.Fields(strings.ReplaceAll(rest, `"`, " ")), " ")
+	return phrases, rest
+}
+
+// Suggest returns the title closest to a misspelled query, or "" when no title is close
+// enough or the best match is just the query itself
+func (b *BlugeIndex) Suggest(query string) (string, error) {
+	queryLower := strings.ToLower(strings.TrimSpace(query))
+	if queryLower == "" {
+		return "", nil
+	}
+
+	fuzzyQuery := bluge.NewBooleanQuery().
+		AddShould(bluge.NewFuzzyQuery(queryLower).SetField("title_exact").SetFuzziness(2)).
+		AddShould(bluge.NewFuzzyQuery(foldTitle(query)).SetField("title_folded").SetFuzziness(2))
+	searchReq := bluge.NewTopNSearch(1, fuzzyQuery)
+	docMatches, err := b.reader.Search(context.Background(), searchReq)
+	if err != nil {
+		return "", fmt.Errorf("suggest failed: %w", err)
+	}
+
+	match, err := docMatches.Next()
+	if err != nil || match == nil {
+		return "", err
 	}
 
-	log.Printf("Bluge search complete: %d results for %q", len(results), query)
-	return results, nil
+	var title string
+	err = match.VisitStoredFields(func(field string, value []byte) bool {
+		if field == "title" {
+			title = string(value)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !isMeaningfulSuggestion(query, title) {
+		return "", nil
+	}
+	log.Printf("Suggesting %q for %q", title, query)
+	return title, nil
+}
+
+// Autocomplete returns up to limit titles starting with prefix, ignoring case, best match
+// first. Unlike Search it only looks up the title_exact terms, so it is cheap enough to
+// run as the user types.
+func (b *BlugeIndex) Autocomplete(prefix string, limit int) ([]string, error) {
+	prefixLower := strings.ToLower(strings.TrimSpace(prefix))
+	if prefixLower == "" || limit <= 0 {
+		return nil, nil
+	}
+
+	// The title itself ranks above titles continuing it
+	prefixQuery := bluge.NewBooleanQuery().
+		AddShould(bluge.NewTermQuery(prefixLower).SetField("title_exact").SetBoost(2.0)).
+		AddShould(bluge.NewPrefixQuery(prefixLower).SetField("title_exact")).
+		SetMinShould(1)
+	searchReq := bluge.NewTopNSearch(limit, prefixQuery)
+	docMatches, err := b.reader.Search(context.Background(), searchReq)
+	if err != nil {
+		return nil, fmt.Errorf("autocomplete failed: %w", err)
+	}
+
+	titles := make([]string, 0, limit)
+	match, err := docMatches.Next()
+	for err == nil && match != nil {
+		err = match.VisitStoredFields(func(field string, value []byte) bool {
+			if field == "title" {
+				// Redirect titles can repeat the title of an article
+				if title := string(value); !slices.Contains(titles, title) {
+					titles = append(titles, title)
+				}
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			break
+		}
+		match, err = docMatches.Next()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error iterating autocomplete results: %w", err)
+	}
+	return titles, nil
+}
+
+// isMeaningfulSuggestion reports whether suggestion differs from query by more than
+// case, accents, punctuation and spacing
+func isMeaningfulSuggestion(query, suggestion string) bool {
+	normalize := func(s string) string {
+		var b strings.Builder
+		for _, r := range foldTitle(s) {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				b.WriteRune(r)
+			}
+		}
+		return b.String()
+	}
+	return suggestion != "" && normalize(query) != normalize(suggestion)
+}
+
+// foldReplacer spells out letters that have no decomposition into a base letter and
+// accents, including the Turkish dotless i
+var foldReplacer = strings.NewReplacer("ß", "ss", "æ", "ae", "œ", "oe", "ø", "o", "đ", "d", "ł", "l", "ı", "i", "þ", "th")
+
+// foldTitle returns title in lower case without accents, so "Zürich", "ZURICH" and
+// "zurich" all fold to "zurich". Titles are folded identically when indexing and searching.
+func foldTitle(title string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(strings.TrimSpace(title))) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return foldReplacer.Replace(norm.NFC.String(b.String()))
 }
 
 // GetDocumentCount returns the number of documents in the index (cached after first call)
@@ -486,8 +929,8 @@ func (b *BlugeIndex) GetDocumentCount() (uint64, error) {
 	log.Println("Computing document count for search index...")
 	ctx := context.Background()
 
-	// Use a match all query with count aggregation
-	query := bluge.NewMatchAllQuery()
+	// Count articles only, with count aggregation
+	query := articlesQuery()
 	searchReq := bluge.NewTopNSearch(0, query).WithStandardAggregations()
 
 	docMatches, err := b.reader.Search(ctx, searchReq)
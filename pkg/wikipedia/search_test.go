@@ -0,0 +1,163 @@
+package wikipedia
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFoldTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Zürich", "zurich"},
+		{"ZÜRICH", "zurich"},
+		{"Zu\u0308rich", "zurich"}, // decomposed ü
+		{"zurich", "zurich"},
+		{"Straße", "strasse"},
+		{"STRASSE", "strasse"},
+		{"Æsir", "aesir"},
+		{"Encyclopædia", "encyclopaedia"},
+		{"Ørsted", "orsted"},
+		{"København", "kobenhavn"},
+		{"Łódź", "lodz"},
+		{"Wrocław", "wroclaw"},
+		{"Işık", "isik"},
+		{"İstanbul", "istanbul"},
+		{"Œuvre", "oeuvre"},
+		{"Þingvellir", "thingvellir"},
+		{"Đakovo", "dakovo"},
+		{"  São Paulo \t", "sao paulo"},
+		{"Crème brûlée", "creme brulee"},
+		{"Москва", "москва"},
+		{"東京", "東京"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := foldTitle(tt.title); got != tt.want {
+			t.Errorf("foldTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestRankTitle(t *testing.T) {
+	// Exact matches rank above prefixes, word starts, substrings and then misspellings,
+	// shorter titles first for the same kind of match. Each title ranks above the next.
+	tests := []struct {
+		query  string
+		titles []string
+	}{
+		{"paris", []string{"paris", "paris hilton", "parisian culture", "plaster of paris", "comparison", "parris island"}},
+		{"zurich", []string{"zurich", "zurichsee", "zurich airport", "lake zurich", "grosszurich", "zuerich"}},
+		{"mercury", []string{"mercury", "mercury (planet)", "freddie mercury", "mercory", "mecrury prize"}},
+	}
+	for _, tt := range tests {
+		for i := 1; i < len(tt.titles); i++ {
+			better, worse := rankTitle(tt.query, tt.titles[i-1]), rankTitle(tt.query, tt.titles[i])
+			if better <= worse {
+				t.Errorf("rankTitle(%q) of %q = %v, want more than the %v of %q", tt.query, tt.titles[i-1], better, worse, tt.titles[i])
+			}
+		}
+		if last := tt.titles[len(tt.titles)-1]; rankTitle(tt.query, last) <= 0 {
+			t.Errorf("rankTitle(%q, %q) = 0, want a match", tt.query, last)
+		}
+	}
+
+	noMatch := []struct{ query, title string }{
+		{"paris", "london"},
+		{"paris", "pairs"},     // two edits for a short query
+		{"nyc", "nyk"},         // no typo tolerance up to three letters
+		{"mercury", "mecruyr"}, // three edits
+		{"", "paris"},
+		{"paris", ""},
+	}
+	for _, tt := range noMatch {
+		if got := rankTitle(tt.query, tt.title); got != 0 {
+			t.Errorf("rankTitle(%q, %q) = %v, want 0", tt.query, tt.title, got)
+		}
+	}
+}
+
+func TestRankTitleFoldsCase(t *testing.T) {
+	for _, title := range []string{"Zürich", "ZÜRICH", "zurich", "Zu\u0308rich"} {
+		if got := rankTitle(foldTitle("ZURICH"), foldTitle(title)); got != 100 {
+			t.Errorf("rankTitle() of ZURICH and %q = %v, want an exact match", title, got)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"paris", "pairs", 2},
+		{"zürich", "zurich", 1}, // one letter, two bytes
+		{"zürich", "zürich", 0},
+		{"straße", "strasse", 2},
+		{"москва", "моска", 1},
+		{"東京", "京都", 2},
+		{"東京", "東京都", 1},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := editDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestSearchTitles(t *testing.T) {
+	titled := func(title string) testEntry {
+		entry := testArticle(strings.ReplaceAll(title, " ", "_"), "<p>About "+title+".</p>")
+		entry.title = title
+		return entry
+	}
+	redirect := testRedirect("Paris_(city)", "Paris")
+	redirect.title = "Paris (city)"
+	w, _ := openTestWikipedia(t, testZIM{entries: []testEntry{
+		titled("Paris"),
+		titled("Paris Hilton"),
+		titled("Parisian culture"),
+		titled("Plaster of Paris"),
+		titled("Comparison"),
+		titled("Parris Island"),
+		titled("London"),
+		titled("Zürich"),
+		redirect,
+	}})
+
+	tests := []struct {
+		query string
+		max   int
+		want  []string
+	}{
+		{"paris", 10, []string{"Paris", "Paris Hilton", "Parisian culture", "Plaster of Paris", "Comparison", "Parris Island"}},
+		{"PARIS", 10, []string{"Paris", "Paris Hilton", "Parisian culture", "Plaster of Paris", "Comparison", "Parris Island"}},
+		{"paris", 2, []string{"Paris", "Paris Hilton"}},
+		{"zurich", 10, []string{"Zürich"}},
+		{"londn", 10, []string{"London"}},
+		{AndQueryPrefix + " london", 10, []string{"London"}},
+		{"berlin", 10, nil},
+		{"  ", 10, nil},
+	}
+	for _, tt := range tests {
+		results, err := w.searchTitles(tt.query, tt.max)
+		if err != nil {
+			t.Fatalf("searchTitles(%q) error = %v", tt.query, err)
+		}
+		var got []string
+		for _, result := range results {
+			got = append(got, result.Title)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("searchTitles(%q, %d) = %q, want %q", tt.query, tt.max, got, tt.want)
+		}
+	}
+}
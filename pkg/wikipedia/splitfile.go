@@ -0,0 +1,114 @@
+package wikipedia
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// zimFile is the file a ZIMReader reads from, a single ZIM file or the parts of a split one
+type zimFile interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// splitZIMSuffix is the name suffix of the first part of a split ZIM file. Kiwix splits
+// large dumps into file.zimaa, file.zimab, ... which concatenate into file.zim.
+const splitZIMSuffix = ".zimaa"
+
+// IsSplitZIMPath reports whether path names the first part of a split ZIM file
+func IsSplitZIMPath(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), splitZIMSuffix)
+}
+
+// openZIMFile opens a ZIM file, or all parts of a split ZIM file given its first part
+func openZIMFile(path string) (zimFile, error) {
+	if IsSplitZIMPath(path) {
+		return openSplitFile(path)
+	}
+	return os.Open(path)
+}
+
+// splitFile presents the parts of a split file as one contiguous file
+type splitFile struct {
+	parts   []*os.File
+	offsets []int64 // offset of the start of each part in the whole file
+	size    int64
+}
+
+// openSplitFile opens the parts of a split file, first and the parts following it in
+// name order (first ending in "aa", then "ab", ...) until one is missing
+func openSplitFile(first string) (*splitFile, error) {
+	base := first[:len(first)-2]
+	f := &splitFile{}
+	for _, name := range splitPartNames(base, first[len(first)-2:]) {
+		part, err := os.Open(name)
+		if errors.Is(err, os.ErrNotExist) && len(f.parts) > 0 {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		info, err := part.Stat()
+		if err != nil {
+			part.Close()
+			f.Close()
+			return nil, err
+		}
+		f.parts = append(f.parts, part)
+		f.offsets = append(f.offsets, f.size)
+		f.size += info.Size()
+	}
+	return f, nil
+}
+
+// splitPartNames returns the possible part names of a split file, e.g. base+"aa" to
+// base+"zz", in the letter case of the first part's suffix
+func splitPartNames(base, firstSuffix string) []string {
+	letters := "abcdefghijklmnopqrstuvwxyz"
+	if firstSuffix == strings.ToUpper(firstSuffix) {
+		letters = strings.ToUpper(letters)
+	}
+	names := make([]string, 0, len(letters)*len(letters))
+	for _, a := range letters {
+		for _, b := range letters {
+			names = append(names, base+string(a)+string(b))
+		}
+	}
+	return names
+}
+
+// ReadAt reads from the parts covering the requested range of the whole file
+func (f *splitFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+
+	// Last part starting at or before off
+	i := sort.Search(len(f.offsets), func(i int) bool { return f.offsets[i] > off }) - 1
+	read := 0
+	for ; i >= 0 && i < len(f.parts) && read < len(p); i++ {
+		n, err := f.parts[i].ReadAt(p[read:], off+int64(read)-f.offsets[i])
+		read += n
+		if err != nil && err != io.EOF {
+			return read, err
+		}
+	}
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+// Close closes all parts
+func (f *splitFile) Close() error {
+	var errs []error
+	for _, part := range f.parts {
+		errs = append(errs, part.Close())
+	}
+	return errors.Join(errs...)
+}
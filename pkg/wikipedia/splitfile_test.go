@@ -0,0 +1,152 @@
+package wikipedia
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSplitParts writes data into parts of the sizes given plus one with the rest,
+// named base+"aa", base+"ab", ..., and returns the path of the first
+func writeSplitParts(t *testing.T, base string, data []byte, sizes ...int) string {
+	t.Helper()
+	names := splitPartNames(base, "aa")
+	for i := 0; i <= len(sizes); i++ {
+		part := data
+		if i < len(sizes) {
+			part, data = data[:sizes[i]], data[sizes[i]:]
+		}
+		if err := os.WriteFile(names[i], part, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return names[0]
+}
+
+func TestSplitFileReadAt(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	// A part of one byte, and the parts after the last left alone
+	first := writeSplitParts(t, filepath.Join(t.TempDir(), "test.zim"), data, 300, 1, 299)
+	f, err := openSplitFile(first)
+	if err != nil {
+		t.Fatalf("openSplitFile() error = %v", err)
+	}
+	defer f.Close()
+	if len(f.parts) != 4 || f.size != int64(len(data)) {
+		t.Fatalf("openSplitFile() = %d parts of %d bytes, want 4 of %d", len(f.parts), f.size, len(data))
+	}
+
+	tests := []struct {
+		name    string
+		off     int64
+		n       int
+		want    int // bytes read
+		wantEOF bool
+	}{
+		{"first part", 10, 100, 100, false},
+		{"to the end of the first part", 200, 100, 100, false},
+		{"start of the second part", 300, 1, 1, false},
+		{"across the first two parts", 250, 60, 60, false},
+		{"across all parts", 0, 1000, 1000, false},
+		{"across the one byte part", 299, 3, 3, false},
+		{"last part", 700, 300, 300, false},
+		{"past the end of the last part", 900, 200, 100, true},
+		{"past the end across parts", 500, 600, 500, true},
+		{"at the end", 1000, 10, 0, true},
+		{"beyond the end", 2000, 10, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := make([]byte, tt.n)
+			n, err := f.ReadAt(p, tt.off)
+			if n != tt.want || (err == io.EOF) != tt.wantEOF || (err != nil && err != io.EOF) {
+				t.Fatalf("ReadAt(%d bytes at %d) = %d, %v, want %d, EOF %v", tt.n, tt.off, n, err, tt.want, tt.wantEOF)
+			}
+			if n > 0 && !bytes.Equal(p[:n], data[tt.off:tt.off+int64(n)]) {
+				t.Errorf("ReadAt(%d bytes at %d) read the wrong bytes", tt.n, tt.off)
+			}
+		})
+	}
+
+	if _, err := f.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Error("ReadAt() at a negative offset error = nil")
+	}
+}
+
+func TestOpenSplitFileUpperCase(t *testing.T) {
+	data := []byte("the parts of a split file named in upper case")
+	base := filepath.Join(t.TempDir(), "TEST.ZIM")
+	names := splitPartNames(base, "AA")
+	for i, part := range [][]byte{data[:10], data[10:]} {
+		if err := os.WriteFile(names[i], part, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := openZIMFile(names[0])
+	if err != nil {
+		t.Fatalf("openZIMFile() error = %v", err)
+	}
+	defer f.Close()
+	p := make([]byte, len(data))
+	if n, err := f.ReadAt(p, 0); n != len(data) || err != nil || !bytes.Equal(p, data) {
+		t.Errorf("ReadAt() = %d, %v, %q, want all of %q", n, err, p[:n], data)
+	}
+}
+
+func TestOpenSplitFileMissing(t *testing.T) {
+	if _, err := openSplitFile(filepath.Join(t.TempDir(), "missing.zimaa")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("openSplitFile() of a missing file error = %v, want it not to exist", err)
+	}
+}
+
+func TestNewZIMReaderSplit(t *testing.T) {
+	zim := testZIM{
+		entries: []testEntry{
+			testArticle("Paris", "<p>Paris is the capital of France.</p>"),
+			testArticle("London", "<p>London is the capital of England.</p>"),
+			{namespace: 'A', url: "Zürich", title: "Zürich", content: bytes.Repeat([]byte("Zürich "), 200), cluster: 1},
+			testRedirect("Paname", "Paris"),
+		},
+		clusters: []testCluster{{info: 1}, {info: 6, compress: compressZstd}},
+	}
+	path, entries := writeTestZIM(t, zim)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Parts end inside the header, the directory and the clusters
+	first := writeSplitParts(t, filepath.Join(t.TempDir(), "test.zim"), data, 30, len(data)/2-30, len(data)/2-5)
+	reader, err := NewZIMReaderWithOptions(first, ZIMReaderOptions{})
+	if err != nil {
+		t.Fatalf("NewZIMReaderWithOptions() of a split file error = %v", err)
+	}
+	defer reader.Close()
+
+	if got := reader.GetArticleCount(); got != uint32(len(entries)) {
+		t.Fatalf("GetArticleCount() = %d, want %d", got, len(entries))
+	}
+	for i, want := range entries {
+		if want.redirect != "" {
+			continue
+		}
+		content, _, err := reader.GetArticleContent(uint32(i))
+		if err != nil {
+			t.Fatalf("GetArticleContent(%d) error = %v", i, err)
+		}
+		if !bytes.Equal(content, want.content) {
+			t.Errorf("GetArticleContent(%d) = %q, want %q", i, content, want.content)
+		}
+	}
+	idx := entryIndex(t, entries, 'A', "Paname")
+	if content, _, err := reader.GetArticleContent(idx); err != nil || !bytes.Equal(content, entries[entryIndex(t, entries, 'A', "Paris")].content) {
+		t.Errorf("GetArticleContent() of the redirect = %q, %v, want the content of Paris", content, err)
+	}
+}
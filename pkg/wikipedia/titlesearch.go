@@ -0,0 +1,245 @@
+package wikipedia
+
+import (
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// titleScanMaxEntries is the largest ZIM (in directory entries) for which the index-free
+// search scans every title. Larger dumps only get title prefix matches.
+const titleScanMaxEntries = 50000
+
+// titleEntry is an article title kept in memory for the linear-scan title search
+type titleEntry struct {
+	idx    uint32
+	url    string
+	title  string
+	folded string // title as folded by foldTitle
+}
+
+// searchTitles is the degraded search used when no Bluge index is loaded.
+// It combines title-pointer prefix matches with a ranked linear scan on small dumps.
+func (w *Wikipedia) searchTitles(query string, maxResults int) ([]SearchResult, error) {
+	// Only titles are searched, so AndQueryPrefix changes nothing
+	query = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(query), AndQueryPrefix))
+	if query == "" || maxResults <= 0 {
+		return nil, nil
+	}
+
+	log.Printf("Title search (no index): query=%q, maxResults=%d", query, maxResults)
+	queryFolded := foldTitle(query)
+	best := make(map[uint32]SearchResult)
+
+	add := func(result SearchResult) {
+		if existing, ok := best[result.Index]; !ok || result.Score > existing.Score {
+			best[result.Index] = result
+		}
+	}
+
+	// Prefix matches via the title pointer list. Titles are case-sensitive in the ZIM,
+	// so also try the Wikipedia convention of an uppercase first letter.
+	for _, prefix := range uniqueStrings(query, capitalizeFirst(query)) {
+		for _, namespace := range []byte{'A', 'C'} {
+			entries, err := w.reader.ListByTitlePrefix(namespace, prefix, maxResults)
+			if err != nil {
+				log.Printf("Title prefix search failed: %v", err)
+				break
+			}
+			for _, entry := range entries {
+				if entry.IsRedirect {
+					continue
+				}
+				add(SearchResult{
+					Index: entry.Index,
+					URL:   entry.URL,
+					Title: entry.Title,
+					Score: rankTitle(queryFolded, foldTitle(entry.Title)),
+				})
+			}
+		}
+	}
+
+	// Linear scan for mid-word and misspelled queries, only on small dumps
+	if w.reader.GetArticleCount() <= titleScanMaxEntries {
+		for _, entry := range w.getTitleList() {
+			score := rankTitle(queryFolded, entry.folded)
+			if score > 0 {
+				add(SearchResult{Index: entry.idx, URL: entry.url, Title: entry.title, Score: score})
+			}
+		}
+	} else if len(best) == 0 {
+		log.Printf("No prefix matches for %q; run 'wapipedia index' for full search on large dumps", query)
+	}
+
+	results := make([]SearchResult, 0, len(best))
+	for _, result := range best {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Title < results[j].Title
+	})
+	if len(results) > maxResults {
+		results = results[:maxResults]
+	}
+
+	log.Printf("Title search complete: %d results for %q", len(results), query)
+	return results, nil
+}
+
+// autocompleteTitles is the index-free title completion. Titles are case-sensitive in
+// the ZIM, so prefixes are looked up as typed and with an upper case first letter.
+func (w *Wikipedia) autocompleteTitles(prefix string, limit int) ([]string, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" || limit <= 0 {
+		return nil, nil
+	}
+
+	var titles []string
+	for _, p := range uniqueStrings(capitalizeFirst(prefix), prefix) {
+		for _, namespace := range []byte{'A', 'C'} {
+			entries, err := w.reader.ListByTitlePrefix(namespace, p, limit)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if len(titles) < limit && IsContentArticle(entry) && !slices.Contains(titles, entry.Title) {
+					titles = append(titles, entry.Title)
+				}
+			}
+		}
+	}
+	return titles, nil
+}
+
+// suggestTitle is the index-free spelling suggestion, only available on small dumps
+func (w *Wikipedia) suggestTitle(query string) string {
+	queryFolded := foldTitle(query)
+	if queryFolded == "" || w.reader.GetArticleCount() > titleScanMaxEntries {
+		return ""
+	}
+
+	best, bestDistance := "", 3
+	for _, entry := range w.getTitleList() {
+		if distance := editDistance(queryFolded, entry.folded); distance < bestDistance {
+			best, bestDistance = entry.title, distance
+		}
+	}
+	if !isMeaningfulSuggestion(query, best) {
+		return ""
+	}
+	return best
+}
+
+// getTitleList returns all article titles, reading the directory on first use
+func (w *Wikipedia) getTitleList() []titleEntry {
+	w.titleListOnce.Do(func() {
+		log.Println("Building in-memory title list for index-free search...")
+		count := w.reader.GetArticleCount()
+		for i := uint32(0); i < count; i++ {
+			entry, err := w.reader.GetDirectoryEntry(i)
+			if err != nil {
+				continue
+			}
+			if !IsContentArticle(entry) || !w.reader.hasHTMLContent(entry) {
+				continue
+			}
+			w.titleList = append(w.titleList, titleEntry{
+				idx:    i,
+				url:    entry.URL,
+				title:  entry.Title,
+				folded: foldTitle(entry.Title),
+			})
+		}
+		log.Printf("Title list ready: %d articles", len(w.titleList))
+	})
+	return w.titleList
+}
+
+// rankTitle scores how well a lowercased title matches a lowercased query (0 = no match)
+func rankTitle(query, title string) float64 {
+	if query == "" || title == "" {
+		return 0
+	}
+
+	// Shorter titles rank higher for the same kind of match
+	closeness := float64(len(query)) / float64(max(len(title), len(query))) * 10
+
+	switch {
+	case title == query:
+		return 100
+	case strings.HasPrefix(title, query):
+		return 50 + closeness
+	case strings.Contains(title, " "+query):
+		return 30 + closeness
+	case strings.Contains(title, query):
+		return 20 + closeness
+	}
+
+	// Typo tolerance, skipped for short queries like the Bluge fuzzy query
+	if utf8.RuneCountInString(query) <= 3 {
+		return 0
+	}
+	maxDistance := 1
+	if utf8.RuneCountInString(query) > 6 {
+		maxDistance = 2
+	}
+	distance := editDistance(query, title)
+	for _, word := range strings.Fields(title) {
+		distance = min(distance, editDistance(query, word))
+	}
+	if distance <= maxDistance {
+		return 10 - float64(distance)*3
+	}
+	return 0
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(min(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// capitalizeFirst uppercases the first letter of s
+func capitalizeFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// uniqueStrings returns the given strings with duplicates removed, preserving order
+func uniqueStrings(values ...string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,152 @@
+package wikipedia
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultVerifySampleSize is the number of clusters VerifyZIM decompresses unless
+// VerifyOptions sets another sample size or asks for all of them
+const DefaultVerifySampleSize = 100
+
+// maxVerifyProblems caps the problems listed in a VerifyReport, the counts stay exact
+const maxVerifyProblems = 20
+
+// VerifyOptions controls how much of a ZIM file VerifyZIM reads
+type VerifyOptions struct {
+	Full       bool // Decompress every cluster instead of a sample
+	SampleSize int  // Clusters to decompress, spread over the file, 0 for DefaultVerifySampleSize
+
+	// Progress, if set, is called as VerifyZIM starts each stage and while it reads entries
+	Progress func(progress VerifyProgress)
+}
+
+// VerifyStage is a stage of the checks VerifyZIM makes
+type VerifyStage int
+
+const (
+	VerifyEntries  VerifyStage = iota // reading directory entries and following redirects
+	VerifyClusters                    // decompressing clusters and extracting blobs
+)
+
+// VerifyProgress represents the progress of VerifyZIM through a stage
+type VerifyProgress struct {
+	Stage VerifyStage
+	Done  uint32 // entries or clusters checked so far
+	Total uint32 // entries or clusters the stage checks
+}
+
+// reportProgress passes the progress to the callback, if there is one
+func (opts VerifyOptions) reportProgress(stage VerifyStage, done, total uint32) {
+	if opts.Progress != nil {
+		opts.Progress(VerifyProgress{Stage: stage, Done: done, Total: total})
+	}
+}
+
+// VerifyReport lists what VerifyZIM found wrong with a ZIM file
+type VerifyReport struct {
+	Entries                uint32 // directory entries, including redirects
+	Redirects              uint32
+	Clusters               uint32
+	ClustersChecked        uint32 // clusters decompressed
+	UnreadableEntries      int    // entries that could not be parsed or point past the last cluster
+	BrokenRedirects        int    // redirects to a missing entry, in a loop or in a too long chain
+	UnsupportedCompression int    // clusters with a compression type the reader does not support
+	UnreadableClusters     int    // clusters that failed to read or decompress
+	UnreadableBlobs        int    // blobs of checked clusters that entries point at but cannot be extracted
+	Problems               []string
+}
+
+// OK reports whether no problems were found
+func (r *VerifyReport) OK() bool {
+	return r.UnreadableEntries == 0 && r.BrokenRedirects == 0 && r.UnsupportedCompression == 0 &&
+		r.UnreadableClusters == 0 && r.UnreadableBlobs == 0
+}
+
+// addProblem records a problem description, up to maxVerifyProblems of them
+func (r *VerifyReport) addProblem(format string, args ...any) {
+	if len(r.Problems) < maxVerifyProblems {
+		r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+	}
+}
+
+// VerifyZIM checks that every directory entry of a ZIM file can be read and every redirect
+// resolves, then decompresses a sample of its clusters (or all of them with
+// VerifyOptions.Full) and extracts the blobs entries point at. An error is only returned
+// if the file cannot be opened at all, problems with its content are in the report.
+func VerifyZIM(zimPath string, opts VerifyOptions) (*VerifyReport, error) {
+	z, err := NewZIMReaderWithOptions(zimPath, ZIMReaderOptions{LowMemory: true})
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	report := &VerifyReport{Entries: z.header.ArticleCount, Clusters: z.header.ClusterCount}
+
+	// Highest blob number referenced per cluster, plus one so 0 means unreferenced
+	blobsUsed := make([]uint32, z.header.ClusterCount)
+
+	opts.reportProgress(VerifyEntries, 0, report.Entries)
+	for idx := uint32(0); idx < report.Entries; idx++ {
+		if idx > 0 && idx%100000 == 0 {
+			opts.reportProgress(VerifyEntries, idx, report.Entries)
+		}
+
+		entry, err := z.GetDirectoryEntry(idx)
+		if err != nil {
+			report.UnreadableEntries++
+			report.addProblem("entry %d: %v", idx, err)
+			continue
+		}
+		if entry.IsRedirect {
+			report.Redirects++
+			if _, err := z.resolveRedirect(entry); err != nil {
+				report.BrokenRedirects++
+				report.addProblem("redirect %d (%c/%s): %v", idx, entry.Namespace, entry.URL, err)
+			}
+			continue
+		}
+		if entry.ClusterNum >= report.Clusters {
+			report.UnreadableEntries++
+			report.addProblem("entry %d (%c/%s): cluster %d out of range", idx, entry.Namespace, entry.URL, entry.ClusterNum)
+			continue
+		}
+		if entry.BlobNum >= blobsUsed[entry.ClusterNum] {
+			blobsUsed[entry.ClusterNum] = entry.BlobNum + 1
+		}
+	}
+
+	sampleSize := opts.SampleSize
+	if sampleSize <= 0 {
+		sampleSize = DefaultVerifySampleSize
+	}
+	step := uint32(1)
+	if !opts.Full && report.Clusters > uint32(sampleSize) {
+		step = report.Clusters / uint32(sampleSize)
+	}
+
+	opts.reportProgress(VerifyClusters, 0, (report.Clusters+step-1)/step)
+	for clusterNum := uint32(0); clusterNum < report.Clusters; clusterNum += step {
+		report.ClustersChecked++
+		cluster, err := z.readCluster(clusterNum)
+		if errors.Is(err, ErrUnsupportedCompression) {
+			report.UnsupportedCompression++
+			report.addProblem("cluster %d: %v", clusterNum, err)
+			continue
+		}
+		if err != nil {
+			report.UnreadableClusters++
+			report.addProblem("cluster %d: %v", clusterNum, err)
+			continue
+		}
+
+		for blobNum := uint32(0); blobNum < blobsUsed[clusterNum]; blobNum++ {
+			if _, err := z.extractBlobFromCluster(cluster.data, blobNum, cluster.extended); err != nil {
+				report.UnreadableBlobs++
+				report.addProblem("cluster %d blob %d: %v", clusterNum, blobNum, err)
+			}
+		}
+	}
+
+	return report, nil
+}
@@ -1,13 +1,21 @@
 package wikipedia
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"html"
+	"log"
+	"log/slog"
 	"math/rand"
 	"net/url"
+	"os"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode"
 )
 
 // Article represents a Wikipedia article
@@ -16,47 +24,163 @@ type Article struct {
 	URL     string
 	Title   string
 	Content string
+	// RedirectTarget is the URL an HTML redirect page points at, with any fragment, when
+	// it was returned instead of followed
+	RedirectTarget string
+	// Images are the images the article references, in article order
+	Images []ArticleImage
+}
+
+// IsEmpty reports whether the article has no readable text once converted, as for some
+// stubs and data pages. Images alone don't count as readable.
+func (a *Article) IsEmpty() bool {
+	return wmlToPlainText(a.Content) == ""
+}
+
+// ArticleImage is an image shown in an article
+type ArticleImage struct {
+	ID      string `json:"id"`      // ID of the image for /image/, a path if the ZIM file has no entry for it
+	Alt     string `json:"alt"`     // plain text alternative, empty if the article gives none
+	Caption string `json:"caption"` // plain text figure caption, empty if the image has none
 }
 
 // RenderOptions controls how HTML is converted to WML
 type RenderOptions struct {
-	SupportsTables bool // Whether the device supports WML tables
+	Mode              RenderMode
+	SupportsTables    bool // Whether the device supports WML tables
+	SupportsFieldsets bool // Whether to group list sections in WML fieldsets
+	SupportsImages    bool // Whether to show images, text-only browsers get none
+	MaxDeckSize       int  // Largest deck in bytes the device accepts, 0 if unknown
+	SkipCollapsed     bool // Whether to replace collapsed-by-default sections with their heading
+	KeepHatnote       bool // Whether to keep the first hatnote as a "See also" line instead of removing it
+	KeepExternalLinks bool // Whether to list external links as numbered footnotes instead of dropping their URL
+	UseSoftKeys       bool // Whether to bind page navigation to soft keys with <do>, some early browsers choke on it
+	FollowRedirects   bool // Whether to render the target of HTML redirect pages instead of the redirect itself
+
+	wiki   *Wikipedia      // wiki resolving article and image links, set while rendering its articles
+	images *[]ArticleImage // collects the images of the article being rendered, if set
+}
+
+// RenderMode is the markup language articles are rendered in
+type RenderMode int
+
+const (
+	RenderWML       RenderMode = iota // WML 1.1, for WAP 1.x browsers
+	RenderXHTMLMP                     // XHTML Mobile Profile, for WAP 2.0 browsers
+	RenderPlainText                   // UTF-8 text with newlines, for the JSON API and terminals
+)
+
+// Section represents a section heading of an article
+type Section struct {
+	Title  string // plain text heading
+	Anchor string // fragment identifier of the heading
+	Level  int    // heading level (2 for h2, 3 for h3)
 }
 
 // SearchResult represents a search result
 type SearchResult struct {
-	Index uint32
-	URL   string
-	Title string
-	Score float64
+	Index   uint32
+	URL     string
+	Title   string
+	Score   float64
+	ID      string // article ID for links, prefixed with the wiki name when several are loaded
+	Snippet string // HTML-escaped excerpt around the best body match with matches in <b>, empty for title-only indexes
 }
 
 // Wikipedia handles Wikipedia content from ZIM files
 type Wikipedia struct {
+	name         string // prefix of article and image IDs when served by a MultiWikipedia
 	zimPath      string
 	reader       *ZIMReader
-	blugeIndex   *BlugeIndex // persistent Bluge search index
-	articleCount uint32      // count of actual articles
+	blugeIndex   *BlugeIndex  // persistent Bluge search index
+	articleCount uint32       // count of actual articles
+	indexMu      sync.RWMutex // guards blugeIndex, articleCount, indexBuilding and closed, replaced by ReloadIndex
+	closed       bool
+	// indexBuilding is set while an in-memory index is built, see startInMemoryIndex
+	indexBuilding bool
+
+	titleList     []titleEntry // article titles for index-free search (small dumps only)
+	titleListOnce sync.Once
+
+	// Rendered articles. Entries belong to this reader and name, so they are dropped
+	// when either changes.
+	articles *articleCache
+}
+
+// ZIMInfo holds the common metadata of a ZIM file. Fields missing from the file are empty.
+type ZIMInfo struct {
+	Name        string // e.g. "wikipedia_en_all"
+	Title       string
+	Description string
+	Language    string // ISO 639-3 codes, comma separated, e.g. "eng"
+	Creator     string
+	Publisher   string
+	Date        string // YYYY-MM-DD
 }
 
 // NewWikipedia creates a new Wikipedia instance
 func NewWikipedia(zimPath string) (*Wikipedia, error) {
-	reader, err := NewZIMReader(zimPath)
+	return newWikipedia(zimPath, ZIMReaderOptions{LowMemory: true})
+}
+
+// newWikipedia creates a new Wikipedia instance reading the ZIM file with opts
+func newWikipedia(zimPath string, opts ZIMReaderOptions) (*Wikipedia, error) {
+	reader, err := NewZIMReaderWithOptions(zimPath, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	w := &Wikipedia{
-		zimPath: zimPath,
-		reader:  reader,
+		zimPath:  zimPath,
+		reader:   reader,
+		articles: newArticleCache(articleCacheEntries, articleCacheBytes),
 	}
 
 	return w, nil
 }
 
+// ErrStaleIndex is returned for a search index built from a different ZIM file than the
+// one loaded, whose results would point at the wrong articles
+var ErrStaleIndex = errors.New("search index was built from a different ZIM file")
+
+var refuseStaleIndex = false
+
+// SetRefuseStaleIndex sets whether a search index built from a different ZIM file is left
+// unloaded, disabling search, instead of used with a warning
+func SetRefuseStaleIndex(refuse bool) {
+	refuseStaleIndex = refuse
+}
+
+// checkIndexZIM compares the ZIM UUID recorded in an index with the loaded ZIM file's.
+// Indexes too old to record it pass with a notice.
+func (w *Wikipedia) checkIndexZIM(blugeIndex *BlugeIndex, indexPath string) error {
+	indexUUID := blugeIndex.ZIMUUID()
+	switch indexUUID {
+	case w.UUID():
+		return nil
+	case "":
+		slog.Info("Search index does not record its ZIM file, rebuild it to check it matches", "index", indexPath, "zim", w.zimPath)
+		return nil
+	}
+	return fmt.Errorf("%w: %s was built from ZIM %s, but %s is %s", ErrStaleIndex, indexPath, indexUUID, w.zimPath, w.UUID())
+}
+
+// warnStaleIndex logs that blugeIndex at indexPath was built from a different ZIM file,
+// with consequence telling what it means for search
+func (w *Wikipedia) warnStaleIndex(blugeIndex *BlugeIndex, indexPath, consequence string) {
+	slog.Warn("Search index was built from a different ZIM file, "+consequence,
+		"index", indexPath, "zim", w.zimPath, "zim_uuid", w.UUID(), "index_uuid", blugeIndex.ZIMUUID())
+}
+
 // NewWikipediaWithIndex creates a new Wikipedia instance and loads the Bluge index
 func NewWikipediaWithIndex(zimPath, indexPath string) (*Wikipedia, error) {
-	w, err := NewWikipedia(zimPath)
+	return NewWikipediaWithOptions(zimPath, indexPath, ZIMReaderOptions{LowMemory: true})
+}
+
+// NewWikipediaWithOptions creates a new Wikipedia instance reading the ZIM file with opts,
+// and loads the Bluge index
+func NewWikipediaWithOptions(zimPath, indexPath string, opts ZIMReaderOptions) (*Wikipedia, error) {
+	w, err := newWikipedia(zimPath, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -67,25 +191,147 @@ func NewWikipediaWithIndex(zimPath, indexPath string) (*Wikipedia, error) {
 	}
 
 	blugeIndex, err := LoadBlugeIndex(indexPath)
-	if err != nil {
+	if _, statErr := os.Stat(indexPath); os.IsNotExist(statErr) && w.startInMemoryIndex() {
+		slog.Info("No search index, building one in memory", "index", indexPath)
+	} else if err != nil {
 		// Index not available, search won't work
-		fmt.Printf("Warning: Search index not found at %s\n", indexPath)
-		fmt.Printf("Run 'wapipedia index -z %s' to build the search index.\n", zimPath)
+		slog.Warn("Search index not found, build it with 'wapipedia index'", "index", indexPath, "zim", zimPath)
+	} else if err := w.checkIndexZIM(blugeIndex, indexPath); err != nil && refuseStaleIndex {
+		w.warnStaleIndex(blugeIndex, indexPath, "search is disabled until it is rebuilt with 'wapipedia index'")
+		blugeIndex.Close()
 	} else {
+		if err != nil {
+			w.warnStaleIndex(blugeIndex, indexPath, "search results may point at the wrong articles until it is rebuilt with 'wapipedia index'")
+		}
 		w.blugeIndex = blugeIndex
 		if count, err := blugeIndex.GetDocumentCount(); err == nil {
 			w.articleCount = uint32(count)
-			fmt.Printf("Loaded search index with %d articles\n", count)
+			slog.Info("Loaded search index", "index", indexPath, "articles", count)
 		}
 	}
 
 	return w, nil
 }
 
-// Close closes the Wikipedia reader
+// DefaultInMemoryIndexBytes is the ZIM file size up to which a search index is built in
+// memory when there is no persisted one, unless changed with SetInMemoryIndexLimit
+const DefaultInMemoryIndexBytes = 400 * 1024 * 1024
+
+var inMemoryIndexBytes int64 = DefaultInMemoryIndexBytes
+
+// SetInMemoryIndexLimit sets the ZIM file size up to which NewWikipediaWithIndex builds a
+// search index in memory when there is no persisted one. Zero disables it.
+func SetInMemoryIndexLimit(maxBytes int64) {
+	inMemoryIndexBytes = maxBytes
+}
+
+// startInMemoryIndex starts building a search index in memory if the ZIM file is within
+// the in-memory index limit, and reports whether it did. Searches use the title list
+// until the index is ready.
+func (w *Wikipedia) startInMemoryIndex() bool {
+	info, err := os.Stat(w.zimPath)
+	if err != nil || inMemoryIndexBytes <= 0 || info.Size() > inMemoryIndexBytes {
+		return false
+	}
+
+	w.indexBuilding = true
+	go func() {
+		blugeIndex, err := BuildInMemoryIndex(w.zimPath, IndexOptions{Redirects: true})
+		var count uint64
+		if err == nil {
+			count, err = blugeIndex.GetDocumentCount()
+		}
+
+		w.indexMu.Lock()
+		defer w.indexMu.Unlock()
+		w.indexBuilding = false
+		switch {
+		case err != nil:
+			slog.Warn("Failed to build in-memory search index", "zim", w.zimPath, "error", err)
+			if blugeIndex != nil {
+				blugeIndex.Close()
+			}
+		case w.closed || w.blugeIndex != nil:
+			// Closed meanwhile, or an index was loaded with ReloadIndex
+			blugeIndex.Close()
+		default:
+			w.blugeIndex = blugeIndex
+			w.articleCount = uint32(count)
+			slog.Info("Built in-memory search index", "zim", w.zimPath, "articles", count)
+		}
+	}()
+	return true
+}
+
+// ReloadIndex opens the Bluge index at indexPath, or next to the ZIM file if empty, and
+// replaces the loaded index with it. Searches running meanwhile finish on the old index,
+// which is closed once they are done. On error the loaded index is kept.
+func (w *Wikipedia) ReloadIndex(indexPath string) error {
+	if indexPath == "" {
+		indexPath = DefaultIndexPath(w.zimPath)
+	}
+
+	blugeIndex, err := LoadBlugeIndex(indexPath)
+	if err != nil {
+		return fmt.Errorf("failed to load search index %s: %w", indexPath, err)
+	}
+	count, err := blugeIndex.GetDocumentCount()
+	if err != nil {
+		blugeIndex.Close()
+		return fmt.Errorf("failed to read search index %s: %w", indexPath, err)
+	}
+	if err := w.checkIndexZIM(blugeIndex, indexPath); err != nil {
+		if refuseStaleIndex {
+			blugeIndex.Close()
+			return err
+		}
+		w.warnStaleIndex(blugeIndex, indexPath, "search results may point at the wrong articles until it is rebuilt with 'wapipedia index'")
+	}
+
+	w.indexMu.Lock()
+	if w.closed {
+		w.indexMu.Unlock()
+		blugeIndex.Close()
+		return ErrClosed
+	}
+	old := w.blugeIndex
+	w.blugeIndex = blugeIndex
+	w.articleCount = uint32(count)
+	w.indexMu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	slog.Info("Reloaded search index", "index", indexPath, "articles", count)
+	return nil
+}
+
+// SearchIndexReady reports whether search is ready: the Bluge index is loaded, or there
+// is none next to the ZIM file to load and none being built in memory
+func (w *Wikipedia) SearchIndexReady() bool {
+	w.indexMu.RLock()
+	loaded, building := w.blugeIndex != nil, w.indexBuilding
+	w.indexMu.RUnlock()
+	if loaded {
+		return true
+	}
+	if building {
+		return false
+	}
+	_, err := os.Stat(DefaultIndexPath(w.zimPath))
+	return err != nil
+}
+
+// Close closes the Wikipedia reader. It waits for searches and ZIM reads in progress,
+// later calls of other methods return ErrClosed.
 func (w *Wikipedia) Close() error {
+	w.indexMu.Lock()
+	defer w.indexMu.Unlock()
+	w.closed = true
+	w.articles.clear()
 	if w.blugeIndex != nil {
 		w.blugeIndex.Close()
+		w.blugeIndex = nil
 	}
 	if w.reader != nil {
 		return w.reader.Close()
@@ -93,26 +339,205 @@ func (w *Wikipedia) Close() error {
 	return nil
 }
 
-// Search searches for articles matching the query using Bluge index
-func (w *Wikipedia) Search(query string, maxResults int) ([]SearchResult, error) {
+// Search searches for articles matching the query using Bluge index,
+// falling back to a title search when no index is loaded. The index search gives up
+// when ctx is done.
+func (w *Wikipedia) Search(ctx context.Context, query string, maxResults int) ([]SearchResult, error) {
+	w.indexMu.RLock()
+	defer w.indexMu.RUnlock()
+	if w.closed {
+		return nil, ErrClosed
+	}
+
+	var results []SearchResult
+	var err error
+	if w.blugeIndex == nil {
+		results, err = w.searchTitles(query, maxResults)
+	} else {
+		results, err = w.blugeIndex.Search(ctx, query, maxResults)
+	}
+	w.setResultIDs(results)
+	return results, err
+}
+
+// SearchWithOffset returns up to limit results starting at offset and the total number
+// of matches. Without an index the title search is sliced, and the total covers only
+// the results it collected.
+func (w *Wikipedia) SearchWithOffset(ctx context.Context, query string, offset, limit int) ([]SearchResult, int, error) {
+	w.indexMu.RLock()
+	defer w.indexMu.RUnlock()
+	if w.closed {
+		return nil, 0, ErrClosed
+	}
+
+	if w.blugeIndex != nil {
+		results, total, err := w.blugeIndex.SearchWithOffset(ctx, query, offset, limit)
+		w.setResultIDs(results)
+		return results, int(total), err
+	}
+
+	offset = max(offset, 0)
+	results, err := w.searchTitles(query, offset+limit+1)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := len(results)
+	if offset >= len(results) {
+		return []SearchResult{}, total, nil
+	}
+	results = results[offset:min(offset+limit, len(results))]
+	w.setResultIDs(results)
+	return results, total, nil
+}
+
+// setResultIDs fills in the link IDs of search results
+func (w *Wikipedia) setResultIDs(results []SearchResult) {
+	for i := range results {
+		results[i].ID = w.ArticleID(results[i].Index)
+	}
+}
+
+// Name returns the wiki name used as ID prefix, empty for a single served wiki
+func (w *Wikipedia) Name() string {
+	return w.name
+}
+
+// ArticleID returns the ID used in links to the entry at idx
+func (w *Wikipedia) ArticleID(idx uint32) string {
+	return FormatArticleID(w.name, idx)
+}
+
+// Suggest returns a "did you mean" title for a query that found nothing, or ""
+func (w *Wikipedia) Suggest(query string) (string, error) {
+	w.indexMu.RLock()
+	defer w.indexMu.RUnlock()
+	if w.closed {
+		return "", ErrClosed
+	}
+
 	if w.blugeIndex == nil {
-		return nil, errors.New("search index not loaded - run 'wapipedia index' first")
+		return w.suggestTitle(query), nil
+	}
+	return w.blugeIndex.Suggest(query)
+}
+
+// Autocomplete returns up to limit titles starting with prefix, from the Bluge index, or
+// from the title pointer list when no index is loaded
+func (w *Wikipedia) Autocomplete(prefix string, limit int) ([]string, error) {
+	w.indexMu.RLock()
+	defer w.indexMu.RUnlock()
+	if w.closed {
+		return nil, ErrClosed
 	}
-	return w.blugeIndex.Search(query, maxResults)
+
+	if w.blugeIndex != nil {
+		return w.blugeIndex.Autocomplete(prefix, limit)
+	}
+	return w.autocompleteTitles(prefix, limit)
+}
+
+// Stats returns the ZIM reader's counts and cluster cache metrics
+func (w *Wikipedia) Stats() ZIMReaderStats {
+	return w.reader.Stats()
+}
+
+// UUID returns the ZIM file's UUID, which changes with every new dump
+func (w *Wikipedia) UUID() string {
+	return w.reader.UUID()
+}
+
+// GetInfo returns the ZIM file's metadata
+func (w *Wikipedia) GetInfo() (*ZIMInfo, error) {
+	info := &ZIMInfo{}
+	fields := map[string]*string{
+		"Name":        &info.Name,
+		"Title":       &info.Title,
+		"Description": &info.Description,
+		"Language":    &info.Language,
+		"Creator":     &info.Creator,
+		"Publisher":   &info.Publisher,
+		"Date":        &info.Date,
+	}
+
+	found := false
+	for key, field := range fields {
+		if value, err := w.reader.GetMetadata(key); err == nil {
+			*field = value
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("ZIM file has no metadata")
+	}
+	return info, nil
+}
+
+// GetMainPageIndex returns the index of the ZIM main page, or false if the ZIM has none.
+// The header names the main page, or else the well-known entry W/mainPage. Redirects are
+// followed, so the index is that of the page itself.
+func (w *Wikipedia) GetMainPageIndex() (uint32, bool) {
+	idx := w.reader.GetMainPageIndex()
+	if idx != NoMainPage && idx < w.reader.GetArticleCount() {
+		if canonical, err := w.reader.canonicalIndex(idx); err == nil {
+			return canonical, true
+		}
+	}
+	if idx, err := w.reader.FindWellKnownEntry(wellKnownMainPage); err == nil {
+		return idx, true
+	}
+	return 0, false
+}
+
+// GetEntry returns the directory entry and MIME type of a ZIM entry without reading its
+// content. The MIME type is empty for redirects.
+func (w *Wikipedia) GetEntry(idx uint32) (*DirectoryEntry, string, error) {
+	entry, err := w.reader.GetDirectoryEntry(idx)
+	if err != nil {
+		return nil, "", err
+	}
+	if entry.IsRedirect {
+		return entry, "", nil
+	}
+	return entry, w.reader.GetMIMEType(entry.MimeType), nil
 }
 
 // GetArticle retrieves an article by its index
 func (w *Wikipedia) GetArticle(idx uint32) (*Article, error) {
-	return w.GetArticleWithOptions(idx, RenderOptions{SupportsTables: true})
+	return w.GetArticleWithOptions(context.Background(), idx, RenderOptions{SupportsTables: true, SupportsImages: true, FollowRedirects: true})
+}
+
+// GetArticleWithOptions retrieves an article with specific rendering options. Once ctx is
+// done it stops before the next cluster read or conversion and returns ctx.Err().
+func (w *Wikipedia) GetArticleWithOptions(ctx context.Context, idx uint32, opts RenderOptions) (*Article, error) {
+	opts.wiki, opts.images = nil, nil
+	key := articleCacheKey{idx: idx, opts: opts}
+	if article, ok := w.articles.get(key); ok {
+		return article, nil
+	}
+
+	article, err := w.getArticleWithRedirectDepth(ctx, idx, 0, opts)
+	if err != nil {
+		return nil, err
+	}
+	w.articles.put(key, article)
+	return article, nil
+}
+
+// IsArticleCached reports whether GetArticleWithOptions would answer from the rendered
+// article cache
+func (w *Wikipedia) IsArticleCached(idx uint32, opts RenderOptions) bool {
+	opts.wiki, opts.images = nil, nil
+	return w.articles.contains(articleCacheKey{idx: idx, opts: opts})
 }
 
-// GetArticleWithOptions retrieves an article with specific rendering options
-func (w *Wikipedia) GetArticleWithOptions(idx uint32, opts RenderOptions) (*Article, error) {
-	return w.getArticleWithRedirectDepth(idx, 0, opts)
+// ArticleCacheSize returns the number of cached rendered articles and their size in bytes
+func (w *Wikipedia) ArticleCacheSize() (int, int) {
+	return w.articles.size()
 }
 
-// getArticleWithRedirectDepth retrieves an article, following HTML redirects up to maxDepth
-func (w *Wikipedia) getArticleWithRedirectDepth(idx uint32, depth int, opts RenderOptions) (*Article, error) {
+// getArticleWithRedirectDepth retrieves an article, following HTML redirects up to 5 deep
+// if opts.FollowRedirects is set
+func (w *Wikipedia) getArticleWithRedirectDepth(ctx context.Context, idx uint32, depth int, opts RenderOptions) (*Article, error) {
 	if depth > 5 {
 		return nil, errors.New("too many redirects")
 	}
@@ -122,7 +547,7 @@ func (w *Wikipedia) getArticleWithRedirectDepth(idx uint32, depth int, opts Rend
 		return nil, err
 	}
 
-	content, _, err := w.reader.GetArticleContent(idx)
+	content, _, err := w.reader.getArticleContent(ctx, idx)
 	if err != nil {
 		return nil, err
 	}
@@ -130,40 +555,61 @@ func (w *Wikipedia) getArticleWithRedirectDepth(idx uint32, depth int, opts Rend
 	htmlContent := string(content)
 
 	// Check if this is an HTML redirect page and follow it
-	if strings.Contains(htmlContent, `http-equiv="refresh"`) {
-		reRefresh := regexp.MustCompile(`content="[^"]*URL='([^']*)'`)
-		matches := reRefresh.FindStringSubmatch(htmlContent)
-		if len(matches) > 1 {
-			target := matches[1]
-			// Clean up the target URL
-			target = strings.TrimPrefix(target, "./")
-			// Remove fragment/anchor
-			if idx := strings.Index(target, "#"); idx != -1 {
-				target = target[:idx]
+	redirectTarget, isRedirect := htmlRedirectTarget(htmlContent)
+	if isRedirect && opts.FollowRedirects {
+		// Remove fragment/anchor
+		target, _, _ := strings.Cut(redirectTarget, "#")
+		// Try to find and return the target article
+		for _, namespace := range []byte{'A', 'C'} {
+			if targetIdx, err := w.reader.FindArticleByURL(namespace, target); err == nil {
+				return w.getArticleWithRedirectDepth(ctx, targetIdx, depth+1, opts)
 			}
-			// Try to find and return the target article
-			targetArticle, err := w.GetArticleByURL(target)
-			if err == nil {
-				return targetArticle, nil
-			}
-			// If we can't find it, fall through to show the redirect message
 		}
+		// If we can't find it, fall through to show the redirect message
+	}
+
+	// Very long articles would take too long and too much memory to convert and page
+	htmlContent = capArticleHTML(entry.Title, htmlContent)
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	// Convert HTML to WML
-	wmlContent := HTMLToWMLWithOptions(htmlContent, opts)
+	var images []ArticleImage
+	opts.wiki, opts.images = w, &images
+	wmlContent := convertHTMLToWML(htmlContent, opts)
 
 	// Remove the article title from the beginning of content (it's shown in card title)
 	wmlContent = stripLeadingTitle(wmlContent, entry.Title)
+	if opts.Mode == RenderPlainText {
+		wmlContent = wmlToText(wmlContent)
+	}
 
 	return &Article{
-		Index:   idx,
-		URL:     entry.URL,
-		Title:   entry.Title,
-		Content: wmlContent,
+		Index:          idx,
+		URL:            entry.URL,
+		Title:          entry.Title,
+		Content:        wmlContent,
+		RedirectTarget: redirectTarget,
+		Images:         images,
 	}, nil
 }
 
+// htmlRedirectTarget returns the URL an HTML redirect page, one with a refresh meta tag,
+// points at
+func htmlRedirectTarget(htmlContent string) (string, bool) {
+	if !strings.Contains(htmlContent, `http-equiv="refresh"`) {
+		return "", false
+	}
+	reRefresh := regexp.MustCompile(`content="[^"]*URL='([^']*)'`)
+	matches := reRefresh.FindStringSubmatch(htmlContent)
+	if len(matches) < 2 {
+		return "", false
+	}
+	// Clean up the target URL
+	return strings.TrimPrefix(matches[1], "./"), true
+}
+
 // GetArticleByURL retrieves an article by its URL
 func (w *Wikipedia) GetArticleByURL(url string) (*Article, error) {
 	idx, err := w.reader.FindArticleByURL('A', url)
@@ -177,20 +623,106 @@ func (w *Wikipedia) GetArticleByURL(url string) (*Article, error) {
 	return w.GetArticle(idx)
 }
 
+// ResolveLink finds the article an internal link points at. Links usually name the URL
+// of their target or of a well-known entry such as mainPage, but some name its title, so
+// a link that matches no URL is looked up by title and then by title ignoring case.
+func (w *Wikipedia) ResolveLink(href string) (uint32, bool) {
+	namespaces := []byte{'A', 'C'}
+	for _, ns := range namespaces {
+		if idx, err := w.reader.FindArticleByURL(ns, href); err == nil {
+			return idx, true
+		}
+	}
+	if idx, err := w.reader.FindWellKnownEntry(href); err == nil {
+		return idx, true
+	}
+
+	title := href
+	if decoded, err := url.PathUnescape(href); err == nil {
+		title = decoded
+	}
+	title = strings.ReplaceAll(title, "_", " ")
+	for _, find := range []func(byte, string) (uint32, error){w.reader.FindArticleByTitle, w.reader.FindArticleByTitleFold} {
+		for _, ns := range namespaces {
+			if idx, err := find(ns, title); err == nil {
+				return idx, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// ArticleExists reports whether url names an article in the ZIM file, directly or through
+// redirects, without reading its content. Only the URL pointer list and directory entries
+// are read, never a cluster.
+func (w *Wikipedia) ArticleExists(url string) bool {
+	for _, ns := range []byte{'A', 'C'} {
+		idx, err := w.reader.FindArticleByURL(ns, url)
+		if err != nil {
+			continue
+		}
+		entry, err := w.reader.GetDirectoryEntry(idx)
+		if err == nil {
+			entry, err = w.reader.resolveRedirect(entry)
+		}
+		return err == nil && IsContentArticle(entry) && w.reader.hasHTMLContent(entry)
+	}
+	return false
+}
+
+// FindArticleByTitle returns the index of the article with exactly the given title,
+// falling back to its URL form ("Foo bar" -> "Foo_bar")
+func (w *Wikipedia) FindArticleByTitle(title string) (uint32, error) {
+	for _, ns := range []byte{'A', 'C'} {
+		entries, err := w.reader.ListByTitlePrefix(ns, title, 1)
+		if err != nil {
+			return 0, err
+		}
+		if len(entries) > 0 && entries[0].Title == title {
+			return entries[0].Index, nil
+		}
+	}
+
+	url := strings.ReplaceAll(title, " ", "_")
+	idx, err := w.reader.FindArticleByURL('A', url)
+	if err != nil {
+		idx, err = w.reader.FindArticleByURL('C', url)
+	}
+	return idx, err
+}
+
+// GetRawHTML returns the original HTML of an article as stored in the ZIM file
+func (w *Wikipedia) GetRawHTML(idx uint32) (string, error) {
+	content, _, err := w.GetRawContent(idx)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// GetRawContent returns the content of an entry as stored in the ZIM file, following
+// redirects, and its MIME type
+func (w *Wikipedia) GetRawContent(idx uint32) ([]byte, string, error) {
+	return w.reader.GetArticleContent(idx)
+}
+
+// DefaultImageNamespaces are the ZIM namespaces searched for images, in order: I for images
+// of old ZIM files, - for resources and the media of new ones, C for content, then M and X
+// where some files keep shared assets
+const DefaultImageNamespaces = "I-CMX"
+
+var imageNamespaces = DefaultImageNamespaces
+
+// SetImageNamespaces sets the ZIM namespaces searched for images, in order, one byte each
+func SetImageNamespaces(namespaces string) {
+	imageNamespaces = namespaces
+}
+
 // GetImage retrieves an image from the ZIM file by its path
 func (w *Wikipedia) GetImage(path string) ([]byte, string, error) {
-	// Images in ZIM files can be in namespace 'I' (images) or '-' (other resources)
-	// Try 'I' namespace first (traditional), then '-'
-	idx, err := w.reader.FindArticleByURL('I', path)
+	idx, err := w.FindImageID(path)
 	if err != nil {
-		idx, err = w.reader.FindArticleByURL('-', path)
-		if err != nil {
-			// Also try with 'C' namespace for content
-			idx, err = w.reader.FindArticleByURL('C', path)
-			if err != nil {
-				return nil, "", fmt.Errorf("image not found: %s", path)
-			}
-		}
+		return nil, "", err
 	}
 
 	content, mimeType, err := w.reader.GetArticleContent(idx)
@@ -210,28 +742,24 @@ func (w *Wikipedia) GetImageByID(idx uint32) ([]byte, string, error) {
 	return content, mimeType, nil
 }
 
-// FindImageID finds the ZIM index for an image by its path
+// FindImageID finds the ZIM index for an image by its path, searching the image namespaces
+// for the percent-decoded path and then the path as given
 func (w *Wikipedia) FindImageID(path string) (uint32, error) {
-	// Try URL-decoded path first (ZIM stores decoded URLs)
-	decodedPath, _ := url.QueryUnescape(path)
+	// ZIM files store decoded URLs, but image paths come from percent-encoded links.
+	// PathUnescape keeps "+", which is common in file names.
+	tryPaths := []string{path}
+	if decodedPath, err := url.PathUnescape(path); err == nil && decodedPath != path {
+		tryPaths = []string{decodedPath, path}
+	}
 
-	// Try with decoded path first
-	for _, tryPath := range []string{decodedPath, path} {
+	for _, tryPath := range tryPaths {
 		if tryPath == "" {
 			continue
 		}
-		// Images in ZIM files can be in namespace 'I' (images) or '-' (other resources)
-		idx, err := w.reader.FindArticleByURL('I', tryPath)
-		if err == nil {
-			return idx, nil
-		}
-		idx, err = w.reader.FindArticleByURL('-', tryPath)
-		if err == nil {
-			return idx, nil
-		}
-		idx, err = w.reader.FindArticleByURL('C', tryPath)
-		if err == nil {
-			return idx, nil
+		for i := 0; i < len(imageNamespaces); i++ {
+			if idx, err := w.reader.FindArticleByURL(imageNamespaces[i], tryPath); err == nil {
+				return idx, nil
+			}
 		}
 	}
 	return 0, fmt.Errorf("image not found: %s", path)
@@ -269,7 +797,7 @@ func (w *Wikipedia) GetInfobox(idx uint32) (string, string, error) {
 		return "", "", errors.New("no infobox found")
 	}
 
-	infoboxHTML := match[1]
+	infoboxHTML := formatCoordinates(match[1])
 
 	// Convert to WML table format
 	wmlContent := convertInfoboxToWML(infoboxHTML)
@@ -277,67 +805,293 @@ func (w *Wikipedia) GetInfobox(idx uint32) (string, string, error) {
 	return wmlContent, entry.Title, nil
 }
 
-// convertInfoboxToWML converts infobox HTML to WML table format
-func convertInfoboxToWML(infoboxHTML string) string {
-	var result strings.Builder
-
-	// Find all rows
-	reRow := regexp.MustCompile(`(?is)<tr[^>]*>(.*?)</tr>`)
-	rows := reRow.FindAllStringSubmatch(infoboxHTML, -1)
-
-	if len(rows) == 0 {
-		return ""
+// GetArticleSummary returns the first content paragraph of an article as WML text
+// without markup, truncated on a word boundary to at most maxChars characters. Zero
+// maxChars returns the whole paragraph.
+func (w *Wikipedia) GetArticleSummary(idx uint32, maxChars int) (string, error) {
+	content, _, err := w.reader.GetArticleContent(idx)
+	if err != nil {
+		return "", err
 	}
 
-	result.WriteString("<table columns=\"2\">\n")
-
-	for _, row := range rows {
-		if len(row) < 2 {
-			continue
-		}
-		rowContent := row[1]
+	summary := extractSummary(string(content))
+	if summary == "" {
+		return "", errors.New("no summary found")
+	}
+	return escapeWML(truncateWords(summary, maxChars)), nil
+}
 
-		// Extract header (th) and data (td) cells
-		reTh := regexp.MustCompile(`(?is)<th[^>]*>(.*?)</th>`)
-		reTd := regexp.MustCompile(`(?is)<td[^>]*>(.*?)</td>`)
+// extractSummary returns the plain text of the first paragraph with article content,
+// skipping empty, coordinate and hatnote paragraphs and those inside infoboxes
+func extractSummary(htmlContent string) string {
+	htmlContent = removeElementsWithClass(htmlContent, "table", "infobox", "sidebar", "navbox", "vertical-navbox", "ambox")
+	htmlContent = removeElementsWithClass(htmlContent, "div", "hatnote", "dablink", "rellink")
 
-		thMatches := reTh.FindAllStringSubmatch(rowContent, -1)
-		tdMatches := reTd.FindAllStringSubmatch(rowContent, -1)
+	reParagraph := regexp.MustCompile(`(?is)<p\b([^>]*)>(.*?)</p>`)
+	reRef := regexp.MustCompile(`(?is)<sup[^>]*class="[^"]*reference[^"]*"[^>]*>.*?</sup>`)
+	reTags := regexp.MustCompile(`<[^>]+>`)
+	reSpaces := regexp.MustCompile(`\s+`)
 
-		// Skip rows with no data
-		if len(thMatches) == 0 && len(tdMatches) == 0 {
+	for _, m := range reParagraph.FindAllStringSubmatch(htmlContent, -1) {
+		attrs, body := m[1], m[2]
+		if strings.Contains(attrs, "mw-empty-elt") || strings.Contains(attrs, "hatnote") ||
+			strings.Contains(body, `id="coordinates"`) {
 			continue
 		}
 
-		// Clean and extract cell text
-		var cells []string
-		for _, th := range thMatches {
-			if len(th) > 1 {
-				cells = append(cells, cleanCellContent(th[1]))
-			}
-		}
-		for _, td := range tdMatches {
-			if len(td) > 1 {
-				cells = append(cells, cleanCellContent(td[1]))
-			}
+		body = reRef.ReplaceAllString(body, "")
+		body = removePronunciations(body)
+		body = formatCoordinates(body)
+		text := html.UnescapeString(reTags.ReplaceAllString(body, ""))
+		text = removeCitationMarkers(text)
+		text = strings.TrimSpace(reSpaces.ReplaceAllString(text, " "))
+		if text != "" {
+			return text
 		}
+	}
+	return ""
+}
 
-		// Skip empty rows
-		hasContent := false
-		for _, cell := range cells {
-			if strings.TrimSpace(cell) != "" {
-				hasContent = true
-				break
-			}
-		}
-		if !hasContent {
-			continue
-		}
+// truncateWords shortens text to at most maxChars characters, cutting at the last word
+// boundary and marking the cut with "...". Zero maxChars leaves text as is.
+func truncateWords(text string, maxChars int) string {
+	runes := []rune(text)
+	if maxChars <= 0 || len(runes) <= maxChars {
+		return text
+	}
 
-		// Build row with 2 columns
-		result.WriteString("<tr>")
-		if len(cells) >= 2 {
-			result.WriteString(fmt.Sprintf("<td>%s</td><td>%s</td>", cells[0], cells[1]))
+	cut := string(runes[:max(maxChars-3, 0)])
+	if i := strings.LastIndexByte(cut, ' '); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:") + "..."
+}
+
+// GetSections returns the h2/h3 section headings of an article in document order
+func (w *Wikipedia) GetSections(idx uint32) ([]Section, error) {
+	content, _, err := w.reader.GetArticleContent(idx)
+	if err != nil {
+		return nil, err
+	}
+	return parseSections(string(content)), nil
+}
+
+// maxRelatedArticles caps the number of articles GetRelatedArticles returns
+const maxRelatedArticles = 20
+
+// GetRelatedArticles returns the articles an article links to from its "See also" section,
+// followed by those linked from the paragraphs of its lead, in link order without duplicates
+func (w *Wikipedia) GetRelatedArticles(idx uint32) ([]SearchResult, error) {
+	entry, err := w.reader.GetDirectoryEntry(idx)
+	if err != nil {
+		return nil, err
+	}
+	if entry, err = w.reader.resolveRedirect(entry); err != nil {
+		return nil, err
+	}
+	content, _, err := w.reader.GetArticleContent(entry.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	reHref := regexp.MustCompile(`(?i)<a\s[^>]*href=["']([^"']+)["']`)
+	seen := map[uint32]bool{entry.Index: true}
+	var results []SearchResult
+	for _, part := range relatedLinkSources(string(content)) {
+		for _, m := range reHref.FindAllStringSubmatch(part, -1) {
+			href, ok := internalLinkTarget(html.UnescapeString(m[1]))
+			if !ok {
+				continue
+			}
+			target, ok := w.ResolveLink(href)
+			if !ok {
+				continue
+			}
+			targetEntry, err := w.reader.GetDirectoryEntry(target)
+			if err != nil {
+				continue
+			}
+			if targetEntry, err = w.reader.resolveRedirect(targetEntry); err != nil || seen[targetEntry.Index] {
+				continue
+			}
+			seen[targetEntry.Index] = true
+
+			results = append(results, SearchResult{
+				Index: targetEntry.Index,
+				URL:   targetEntry.URL,
+				Title: targetEntry.Title,
+				ID:    w.ArticleID(targetEntry.Index),
+			})
+			if len(results) == maxRelatedArticles {
+				return results, nil
+			}
+		}
+	}
+	return results, nil
+}
+
+// relatedLinkSources returns the parts of article HTML whose links GetRelatedArticles
+// follows: the "See also" section, then the paragraphs before the first section heading
+func relatedLinkSources(htmlContent string) []string {
+	reHeading := regexp.MustCompile(`(?is)<h2[^>]*>(.*?)</h2>`)
+	reTags := regexp.MustCompile(`<[^>]+>`)
+	reParagraph := regexp.MustCompile(`(?is)<p[^>]*>.*?</p>`)
+
+	var sources []string
+	headings := reHeading.FindAllStringSubmatchIndex(htmlContent, -1)
+	for i, h := range headings {
+		title := html.UnescapeString(reTags.ReplaceAllString(htmlContent[h[2]:h[3]], ""))
+		if !strings.EqualFold(strings.TrimSpace(title), "See also") {
+			continue
+		}
+		end := len(htmlContent)
+		if i+1 < len(headings) {
+			end = headings[i+1][0]
+		}
+		sources = append(sources, htmlContent[h[1]:end])
+		break
+	}
+
+	lead := htmlContent
+	if len(headings) > 0 {
+		lead = htmlContent[:headings[0][0]]
+	}
+	return append(sources, strings.Join(reParagraph.FindAllString(lead, -1), ""))
+}
+
+// parseSections extracts the h2/h3 heading hierarchy from article HTML
+func parseSections(htmlContent string) []Section {
+	reHeading := regexp.MustCompile(`(?is)<h([23])([^>]*)>(.*?)</h[23]>`)
+	reID := regexp.MustCompile(`(?i)\bid=["']([^"']+)["']`)
+	reEditSection := regexp.MustCompile(`(?is)<span[^>]*class="[^"]*mw-editsection[^"]*"[^>]*>.*?</span>\s*</span>`)
+	reTags := regexp.MustCompile(`<[^>]+>`)
+	reSpaces := regexp.MustCompile(`\s+`)
+
+	var sections []Section
+	for _, m := range reHeading.FindAllStringSubmatch(htmlContent, -1) {
+		inner := reEditSection.ReplaceAllString(m[3], "")
+		title := html.UnescapeString(reTags.ReplaceAllString(inner, ""))
+		title = strings.TrimSpace(reSpaces.ReplaceAllString(title, " "))
+		if title == "" {
+			continue
+		}
+
+		// The anchor is on the heading itself or on its inner mw-headline span
+		anchor := strings.ReplaceAll(title, " ", "_")
+		if idMatch := reID.FindStringSubmatch(m[2]); len(idMatch) > 1 {
+			anchor = idMatch[1]
+		} else if idMatch := reID.FindStringSubmatch(m[3]); len(idMatch) > 1 {
+			anchor = idMatch[1]
+		}
+
+		level := 2
+		if m[1] == "3" {
+			level = 3
+		}
+		sections = append(sections, Section{Title: title, Anchor: anchor, Level: level})
+	}
+	return sections
+}
+
+// FindSectionPage returns the index of the chunk containing the rendered heading of
+// sections[n], or 0 if it cannot be found. Earlier sections are located first so
+// repeated heading names resolve to the right occurrence.
+func FindSectionPage(chunks []string, sections []Section, n int) int {
+	if n < 0 || n >= len(sections) {
+		return 0
+	}
+
+	page, offset := 0, 0
+	for i := 0; i <= n; i++ {
+		// Headings are bold in WML and h2-h4 elements in XHTML-MP
+		title := escapeWML(sections[i].Title)
+		markers := []string{"<b>" + title + "</b>", ">" + strings.ReplaceAll(title, "$$", "$") + "</h"}
+		found := false
+		for p := page; p < len(chunks) && !found; p++ {
+			start := 0
+			if p == page {
+				start = offset
+			}
+			for _, marker := range markers {
+				if pos := strings.Index(chunks[p][start:], marker); pos != -1 {
+					page, offset = p, start+pos+len(marker)
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			if i == n {
+				return 0
+			}
+			// Heading was not rendered (e.g. inside a removed box), keep looking from here
+			continue
+		}
+	}
+	return page
+}
+
+// convertInfoboxToWML converts infobox HTML to WML table format
+func convertInfoboxToWML(infoboxHTML string) string {
+	var result strings.Builder
+
+	// Find all rows
+	reRow := regexp.MustCompile(`(?is)<tr[^>]*>(.*?)</tr>`)
+	rows := reRow.FindAllStringSubmatch(infoboxHTML, -1)
+
+	if len(rows) == 0 {
+		return ""
+	}
+
+	result.WriteString("<table columns=\"2\">\n")
+
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		rowContent := row[1]
+
+		// Extract header (th) and data (td) cells
+		reTh := regexp.MustCompile(`(?is)<th[^>]*>(.*?)</th>`)
+		reTd := regexp.MustCompile(`(?is)<td[^>]*>(.*?)</td>`)
+
+		thMatches := reTh.FindAllStringSubmatch(rowContent, -1)
+		tdMatches := reTd.FindAllStringSubmatch(rowContent, -1)
+
+		// Skip rows with no data
+		if len(thMatches) == 0 && len(tdMatches) == 0 {
+			continue
+		}
+
+		// Clean and extract cell text
+		var cells []string
+		for _, th := range thMatches {
+			if len(th) > 1 {
+				cells = append(cells, cleanCellContent(th[1]))
+			}
+		}
+		for _, td := range tdMatches {
+			if len(td) > 1 {
+				cells = append(cells, cleanCellContent(td[1]))
+			}
+		}
+
+		// Skip empty rows
+		hasContent := false
+		for _, cell := range cells {
+			if strings.TrimSpace(cell) != "" {
+				hasContent = true
+				break
+			}
+		}
+		if !hasContent {
+			continue
+		}
+
+		// Build row with 2 columns
+		result.WriteString("<tr>")
+		if len(cells) >= 2 {
+			result.WriteString(fmt.Sprintf("<td>%s</td><td>%s</td>", cells[0], cells[1]))
 		} else if len(cells) == 1 {
 			result.WriteString(fmt.Sprintf("<td>%s</td><td></td>", cells[0]))
 		}
@@ -350,6 +1104,11 @@ func convertInfoboxToWML(infoboxHTML string) string {
 
 // cleanCellContent strips HTML and cleans up cell content for WML
 func cleanCellContent(content string) string {
+	return escapeWML(cellText(content))
+}
+
+// cellText returns the plain text of a table cell, truncated to fit a narrow column
+func cellText(content string) string {
 	// Remove nested HTML tags
 	reTags := regexp.MustCompile(`<[^>]+>`)
 	content = reTags.ReplaceAllString(content, " ")
@@ -357,43 +1116,196 @@ func cleanCellContent(content string) string {
 	// Decode HTML entities
 	content = html.UnescapeString(content)
 
+	content = removeCitationMarkers(content)
+
 	// Clean up whitespace
 	reSpaces := regexp.MustCompile(`\s+`)
 	content = reSpaces.ReplaceAllString(content, " ")
 	content = strings.TrimSpace(content)
 
-	// Escape for WML
-	content = escapeWML(content)
-
 	// Truncate very long content
-	if len(content) > 100 {
-		content = content[:97] + "..."
+	if runes := []rune(content); len(runes) > 100 {
+		content = string(runes[:97]) + "..."
 	}
 
 	return content
 }
 
-// GetRandomArticle returns a random article
+// ArticleMeta describes a ZIM entry without its content
+type ArticleMeta struct {
+	Index          uint32
+	Namespace      byte
+	URL            string
+	Title          string
+	MimeType       string // empty for redirects
+	IsRedirect     bool
+	RedirectTarget uint32 // final entry of the redirect chain, Index if not a redirect
+}
+
+// GetArticleMetadata returns an entry's namespace, URL, title and redirect target from the
+// directory alone, without decompressing any cluster
+func (w *Wikipedia) GetArticleMetadata(idx uint32) (*ArticleMeta, error) {
+	entry, err := w.reader.GetDirectoryEntry(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &ArticleMeta{
+		Index:          idx,
+		Namespace:      entry.Namespace,
+		URL:            entry.URL,
+		Title:          entry.Title,
+		IsRedirect:     entry.IsRedirect,
+		RedirectTarget: idx,
+	}
+	if entry.Title == "" {
+		meta.Title = entry.URL
+	}
+	if !entry.IsRedirect {
+		meta.MimeType = w.reader.GetMIMEType(entry.MimeType)
+		return meta, nil
+	}
+
+	target, err := w.reader.resolveRedirect(entry)
+	if err != nil {
+		return nil, err
+	}
+	meta.RedirectTarget = target.Index
+	return meta, nil
+}
+
+// ListArticles returns up to limit HTML articles in URL order, starting at directory
+// index offset, along with the directory index to continue from. Redirects and
+// resources are skipped like by the search index. The returned index equals
+// GetArticleCount once the directory is exhausted.
+func (w *Wikipedia) ListArticles(offset uint32, limit int) ([]*DirectoryEntry, uint32, error) {
+	count := w.reader.GetArticleCount()
+	var entries []*DirectoryEntry
+	idx := offset
+	for ; idx < count && len(entries) < limit; idx++ {
+		entry, err := w.reader.GetDirectoryEntry(idx)
+		if err != nil {
+			return nil, idx, err
+		}
+		if !IsContentArticle(entry) || !w.reader.hasHTMLContent(entry) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, idx, nil
+}
+
+// BrowseTitles returns up to limit HTML articles whose title starts with prefix, in title
+// order from the first title at or after from, along with the title the next page starts
+// at. The next title is empty once no more articles match. Redirects and resources are
+// skipped like by ListArticles.
+func (w *Wikipedia) BrowseTitles(prefix, from string, limit int) ([]*DirectoryEntry, string, error) {
+	prefix = capitalizeFirst(prefix)
+
+	var entries []*DirectoryEntry
+	next := ""
+	for _, namespace := range []byte{'A', 'C'} {
+		err := w.reader.scanTitles(namespace, prefix, from, func(entry *DirectoryEntry) bool {
+			if !IsContentArticle(entry) || !w.reader.hasHTMLContent(entry) {
+				return true
+			}
+			if len(entries) == limit {
+				next = entry.Title
+				return false
+			}
+			entries = append(entries, entry)
+			return true
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		// A ZIM file keeps its articles in one of the two namespaces
+		if len(entries) > 0 || next != "" {
+			break
+		}
+	}
+	return entries, next, nil
+}
+
+// ListCategories returns the names of the wiki's categories, see ZIMReader.ListCategories
+func (w *Wikipedia) ListCategories() ([]string, error) {
+	return w.reader.ListCategories()
+}
+
+// ListArticlesInCategory returns the articles in a category, see
+// ZIMReader.ListArticlesInCategory
+func (w *Wikipedia) ListArticlesInCategory(cat string) ([]*DirectoryEntry, error) {
+	return w.reader.ListArticlesInCategory(cat)
+}
+
+// GetArticleCount returns the number of directory entries, including redirects and resources
+func (w *Wikipedia) GetArticleCount() uint32 {
+	return w.reader.GetArticleCount()
+}
+
+// randomArticleAttempts is how many random articles GetRandomArticle tries before giving
+// up, skipping articles that fail to render or have no readable content
+const randomArticleAttempts = 10
+
+// GetRandomArticle returns a random article that has readable content
 func (w *Wikipedia) GetRandomArticle() (*Article, error) {
+	return w.GetRandomArticleWithOptions(context.Background(), RenderOptions{SupportsTables: true, SupportsImages: true, FollowRedirects: true})
+}
+
+// GetRandomArticleWithOptions returns a random article that has readable content, rendered
+// with opts. Rendering the candidates with the options the article is served with lets
+// the server serve the article returned without rendering it again.
+func (w *Wikipedia) GetRandomArticleWithOptions(ctx context.Context, opts RenderOptions) (*Article, error) {
+	for range randomArticleAttempts {
+		idx, err := w.GetRandomArticleIndex()
+		if err != nil {
+			return nil, err
+		}
+		article, err := w.GetArticleWithOptions(ctx, idx, opts)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err != nil {
+			log.Printf("Skipping random article %d: %v", idx, err)
+			continue
+		}
+		if !article.IsEmpty() {
+			return article, nil
+		}
+	}
+	return nil, errors.New("could not find a random article with readable content")
+}
+
+// GetRandomArticleIndex returns the index of a random article without reading its content
+func (w *Wikipedia) GetRandomArticleIndex() (uint32, error) {
 	// If search index is available, use it for efficient random selection
 	// The index only contains valid articles (no redirects, resources, etc.)
+	w.indexMu.RLock()
+	if w.closed {
+		w.indexMu.RUnlock()
+		return 0, ErrClosed
+	}
 	if w.blugeIndex != nil {
 		idx, err := w.blugeIndex.GetRandomArticleIndex()
 		if err == nil {
-			return w.GetArticle(idx)
+			w.indexMu.RUnlock()
+			return idx, nil
 		}
 		// Fall through to legacy method if index lookup fails
+		log.Printf("Random article from index failed: %v", err)
 	}
+	w.indexMu.RUnlock()
 
-	fmt.Println("Falling back to random article from ZIM")
+	log.Println("Falling back to random article from ZIM")
 
 	// Legacy method: randomly sample from ZIM file entries
 	articleCount := w.reader.GetArticleCount()
 	if articleCount == 0 {
-		return nil, errors.New("no articles available")
+		return 0, errors.New("no articles available")
 	}
 
-	// Try to find a valid HTML article (namespace A or C, not redirect, HTML content)
+	// Try to find a valid HTML article (namespace A or C, not redirect, HTML content).
+	// Candidates are checked on their directory entry so rejects never read a cluster.
 	maxAttempts := 500
 	for i := 0; i < maxAttempts; i++ {
 		idx := uint32(rand.Int63n(int64(articleCount)))
@@ -401,53 +1313,14 @@ func (w *Wikipedia) GetRandomArticle() (*Article, error) {
 		if err != nil {
 			continue
 		}
-
-		// Must be in article namespace and not a redirect
-		if entry.Namespace != 'A' && entry.Namespace != 'C' {
-			continue
-		}
-		if entry.IsRedirect {
-			continue
-		}
-
-		// Check if it's an HTML article by looking at the URL and content
-		url := strings.ToLower(entry.URL)
-		// Skip resource files
-		if strings.HasSuffix(url, ".css") || strings.HasSuffix(url, ".js") ||
-			strings.HasSuffix(url, ".png") || strings.HasSuffix(url, ".jpg") ||
-			strings.HasSuffix(url, ".jpeg") || strings.HasSuffix(url, ".gif") ||
-			strings.HasSuffix(url, ".svg") || strings.HasSuffix(url, ".ico") ||
-			strings.HasSuffix(url, ".woff") || strings.HasSuffix(url, ".woff2") ||
-			strings.HasSuffix(url, ".ttf") || strings.HasSuffix(url, ".eot") ||
-			strings.Contains(url, "/-/") {
+		if !IsContentArticle(entry) || !w.reader.hasHTMLContent(entry) {
 			continue
 		}
 
-		// Verify it's actually HTML by checking content
-		content, mimeType, err := w.reader.GetArticleContent(idx)
-		if err != nil {
-			continue
-		}
-
-		// Check MIME type if available
-		if mimeType != "" && !strings.Contains(mimeType, "html") && !strings.Contains(mimeType, "text") {
-			continue
-		}
-
-		// Check content starts with HTML-like content
-		contentStr := string(content)
-		if len(contentStr) < 50 {
-			continue
-		}
-		// Look for HTML indicators
-		if !strings.Contains(contentStr[:min(500, len(contentStr))], "<") {
-			continue
-		}
-
-		return w.GetArticle(idx)
+		return idx, nil
 	}
 
-	return nil, errors.New("could not find a valid random article")
+	return 0, errors.New("could not find a valid random article")
 }
 
 // min returns the minimum of two integers
@@ -460,25 +1333,79 @@ func min(a, b int) int {
 
 // HTMLToWML converts HTML content to WML-safe plain text (no tables)
 func HTMLToWML(htmlContent string) string {
-	return HTMLToWMLWithOptions(htmlContent, RenderOptions{SupportsTables: false})
+	return HTMLToWMLWithOptions(htmlContent, RenderOptions{SupportsImages: true})
+}
+
+// HTMLToPlainText converts HTML content to UTF-8 plain text, with the cleanup of
+// HTMLToWML but newlines for line breaks, "- " for list bullets and no markup or escaping
+func HTMLToPlainText(htmlContent string) string {
+	return HTMLToWMLWithOptions(htmlContent, RenderOptions{Mode: RenderPlainText})
 }
 
-// HTMLToWMLWithOptions converts HTML content to WML with configurable options
+// HTMLToWMLWithOptions converts HTML content to WML with configurable options, or to plain
+// text in RenderPlainText mode
 func HTMLToWMLWithOptions(htmlContent string, opts RenderOptions) string {
+	content := convertHTMLToWML(htmlContent, opts)
+	if opts.Mode == RenderPlainText {
+		content = wmlToText(content)
+	}
+	return content
+}
+
+// wmlToText turns the WML of convertHTMLToWML into plain text. Breaks become newlines,
+// list bullets "- ", other tags are removed and escaped characters restored.
+func wmlToText(wml string) string {
+	text := strings.ReplaceAll(wml, "<br/>", "\n")
+	text = regexp.MustCompile(`(?m)^• `).ReplaceAllString(text, "- ")
+	text = regexp.MustCompile(`<[^>]*>`).ReplaceAllString(text, "")
+	text = html.UnescapeString(strings.ReplaceAll(text, "$$", "$"))
+	text = regexp.MustCompile(`\n{3,}`).ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// convertHTMLToWML converts HTML content to WML. Plain text is rendered as WML without
+// tables or fieldsets, for wmlToText.
+func convertHTMLToWML(htmlContent string, opts RenderOptions) string {
 	// Check if this is an HTML redirect page
-	if strings.Contains(htmlContent, `http-equiv="refresh"`) {
-		// Extract the redirect target
-		reRefresh := regexp.MustCompile(`content="[^"]*URL='([^']*)'`)
-		matches := reRefresh.FindStringSubmatch(htmlContent)
-		if len(matches) > 1 {
-			target := matches[1]
-			// Clean up the target URL
-			target = strings.TrimPrefix(target, "./")
-			target = strings.ReplaceAll(target, "#", " - section: ")
-			return fmt.Sprintf("This article redirects to: %s\n\nPlease search for the target article.", escapeWML(target))
+	if target, ok := htmlRedirectTarget(htmlContent); ok {
+		target = strings.ReplaceAll(target, "#", " - section: ")
+		return fmt.Sprintf("This article redirects to: %s\n\nPlease search for the target article.", escapeWML(target))
+	}
+
+	// Convert long articles a few sections at a time, see splitHTMLSegments
+	var externalLinks []string
+	links := &externalLinks
+	if !opts.KeepExternalLinks {
+		links = nil
+	}
+	var parts []string
+	for i, segment := range splitHTMLSegments(htmlContent, articleSegmentBytes) {
+		if part := convertHTMLSegment(segment, opts, i == 0, links); part != "" {
+			parts = append(parts, part)
 		}
 	}
+	// Segments may end with a break, don't stack them with the separator
+	content := strings.Join(parts, "<br/><br/>")
+	if len(parts) > 1 {
+		content = regexp.MustCompile(`(<br/>){3,}`).ReplaceAllString(content, "<br/><br/>")
+	}
+
+	xhtml := opts.Mode == RenderXHTMLMP
+	if len(externalLinks) > 0 {
+		content = appendExternalLinkFootnotes(content, externalLinks, xhtml)
+	}
+
+	if xhtml {
+		content = wmlToXHTMLMP(content)
+	}
+
+	return content
+}
 
+// convertHTMLSegment converts a segment of an article to WML. Only the first segment
+// starts the article, the title and hatnote are only looked for there. External link
+// URLs are collected in externalLinks if it is set.
+func convertHTMLSegment(htmlContent string, opts RenderOptions, first bool, externalLinks *[]string) string {
 	// Remove script and style tags
 	reScript := regexp.MustCompile(`(?is)<script[^>]*>.*?</script>`)
 	reStyle := regexp.MustCompile(`(?is)<style[^>]*>.*?</style>`)
@@ -497,6 +1424,21 @@ func HTMLToWMLWithOptions(htmlContent string, opts RenderOptions) string {
 	reAmbox := regexp.MustCompile(`(?is)<table[^>]*class="[^"]*ambox[^"]*"[^>]*>.*?</table>`)
 	content = reAmbox.ReplaceAllString(content, "")
 
+	// Hatnotes come before the article text and make it start with a cross-reference
+	content = convertHatnotes(content, opts.KeepHatnote && first)
+
+	// Remove "[edit]" section links
+	content = removeElementsWithClass(content, "span", "mw-editsection", "mw-editsection-bracket")
+
+	// Pronunciations and coordinate markup flatten into gibberish at the start of articles
+	content = removePronunciations(content)
+	content = formatCoordinates(content)
+
+	// Collapsed-by-default sections are bonus content, hidden like on the desktop site
+	if opts.SkipCollapsed {
+		content = removeCollapsedSections(content)
+	}
+
 	// Remove table of contents
 	reToc := regexp.MustCompile(`(?is)<div[^>]*id="toc"[^>]*>.*?</div>`)
 	content = reToc.ReplaceAllString(content, "")
@@ -519,37 +1461,62 @@ func HTMLToWMLWithOptions(htmlContent string, opts RenderOptions) string {
 	content = reBodyHeader.ReplaceAllString(content, "")
 
 	// Remove article title at start (it's already in the card title)
-	reArticleTitle := regexp.MustCompile(`(?is)^\s*<[^>]*>?[^<]*</[^>]*>\s*`)
-	content = reArticleTitle.ReplaceAllString(content, "")
+	if first {
+		reArticleTitle := regexp.MustCompile(`(?is)^\s*<[^>]*>?[^<]*</[^>]*>\s*`)
+		content = reArticleTitle.ReplaceAllString(content, "")
+	}
 
 	// Remove reference sections and citations
 	reRef := regexp.MustCompile(`(?is)<sup[^>]*class="[^"]*reference[^"]*"[^>]*>.*?</sup>`)
 	content = reRef.ReplaceAllString(content, "")
+	content = removeElementsWithClass(content, "ol", "references")
+	content = removeElementsWithClass(content, "div", "reflist", "mw-references-wrap")
+	content = removeElementsWithClass(content, "cite", "citation")
+
+	// Keep the direction of embedded right-to-left names and terms
+	content = convertBidiSpans(content)
+
+	// Convert images to WML img tags pointing to /image/ endpoint, or drop them for
+	// devices that can't show them
+	if opts.SupportsImages {
+		content = convertHTMLImagesToWML(content, opts.linkWiki(), opts.images)
+	} else {
+		content = regexp.MustCompile(`(?i)<img[^>]*>`).ReplaceAllString(content, "")
+	}
 
-	// Convert images to WML img tags pointing to /image/ endpoint
-	content = convertHTMLImagesToWML(content)
+	// Convert HTML links to WML anchors, collecting external links for the footnotes
+	content = convertHTMLLinksToWML(content, opts.linkWiki(), externalLinks)
 
-	// Convert HTML links to WML anchors
-	content = convertHTMLLinksToWML(content)
+	// Convert article tables to WML tables if the device supports them,
+	// otherwise to text with line breaks
+	xhtml := opts.Mode == RenderXHTMLMP
+	wml := opts.Mode == RenderWML
+	if opts.SupportsTables && wml {
+		content = convertHTMLTablesToWML(content)
+	} else {
+		content = convertHTMLTablesToText(content)
+	}
 
-	// Convert article tables to text with line breaks
-	// Only infoboxes (which are handled separately via GetInfobox) use WML tables
-	content = convertHTMLTablesToText(content)
+	// Mark quotations so they survive tag stripping (formatted by formatBlockquotes)
+	reBlockquote := regexp.MustCompile(`(?i)<blockquote[^>]*>`)
+	content = reBlockquote.ReplaceAllString(content, "<br/>"+quoteOpenPlaceholder)
+	reEndBlockquote := regexp.MustCompile(`(?i)</blockquote>`)
+	content = reEndBlockquote.ReplaceAllString(content, quoteClosePlaceholder+"<br/>")
 
 	// Convert HTML formatting to WML formatting elements
 	// Bold: <b>, <strong>
-	reBold := regexp.MustCompile(`(?i)<(b|strong)[^>]*>(.*?)</(b|strong)>`)
+	reBold := regexp.MustCompile(`(?i)<(b|strong)\b[^>]*>(.*?)</(b|strong)>`)
 	content = reBold.ReplaceAllString(content, "<b>$2</b>")
 
 	// Italic: <i>, <em>, <cite>
-	reItalic := regexp.MustCompile(`(?i)<(i|em|cite)[^>]*>(.*?)</(i|em|cite)>`)
+	reItalic := regexp.MustCompile(`(?i)<(i|em|cite)\b[^>]*>(.*?)</(i|em|cite)>`)
 	content = reItalic.ReplaceAllString(content, "<i>$2</i>")
 
 	// Remove nested formatting tags (WML doesn't support nested <i>, <b>, etc.)
 	content = removeNestedFormattingTags(content)
 
 	// Underline
-	reUnderline := regexp.MustCompile(`(?i)<u[^>]*>(.*?)</u>`)
+	reUnderline := regexp.MustCompile(`(?i)<u\b[^>]*>(.*?)</u>`)
 	content = reUnderline.ReplaceAllString(content, "<u>$1</u>")
 
 	// Big text
@@ -560,15 +1527,26 @@ func HTMLToWMLWithOptions(htmlContent string, opts RenderOptions) string {
 	reSmall := regexp.MustCompile(`(?i)<small[^>]*>(.*?)</small>`)
 	content = reSmall.ReplaceAllString(content, "<small>$1</small>")
 
-	// Convert headings to bold with line breaks
+	// Group list sections under their heading (before headings are flattened)
+	if opts.SupportsFieldsets && wml {
+		content = wrapListSectionsInFieldsets(content)
+	}
+
+	// Convert headings to bold with line breaks, or mark them for XHTML-MP headings
+	heading := func(level int) string {
+		if xhtml {
+			return fmt.Sprintf("<br/><br/>%s%d%%%%$1%s<br/>", xhtmlHeadingPlaceholder, level, xhtmlHeadingClosePlaceholder)
+		}
+		return "<br/><br/><b>$1</b><br/>"
+	}
 	reH1 := regexp.MustCompile(`(?i)<h1[^>]*>(.*?)</h1>`)
-	content = reH1.ReplaceAllString(content, "<br/><br/><b>$1</b><br/>")
+	content = reH1.ReplaceAllString(content, heading(2))
 	reH2 := regexp.MustCompile(`(?i)<h2[^>]*>(.*?)</h2>`)
-	content = reH2.ReplaceAllString(content, "<br/><br/><b>$1</b><br/>")
+	content = reH2.ReplaceAllString(content, heading(2))
 	reH3 := regexp.MustCompile(`(?i)<h3[^>]*>(.*?)</h3>`)
-	content = reH3.ReplaceAllString(content, "<br/><br/><b>$1</b><br/>")
+	content = reH3.ReplaceAllString(content, heading(3))
 	reH456 := regexp.MustCompile(`(?i)<h[4-6][^>]*>(.*?)</h[4-6]>`)
-	content = reH456.ReplaceAllString(content, "<br/><br/><b>$1</b><br/>")
+	content = reH456.ReplaceAllString(content, heading(4))
 
 	// Paragraphs to breaks
 	reOpenP := regexp.MustCompile(`(?i)<p[^>]*>`)
@@ -584,15 +1562,8 @@ func HTMLToWMLWithOptions(htmlContent string, opts RenderOptions) string {
 	reDiv := regexp.MustCompile(`(?i)</?div[^>]*>`)
 	content = reDiv.ReplaceAllString(content, "<br/>")
 
-	// List items with bullet
-	reLi := regexp.MustCompile(`(?i)<li[^>]*>\s*`)
-	content = reLi.ReplaceAllString(content, "<br/>• ")
-	reEndLi := regexp.MustCompile(`(?i)</li>`)
-	content = reEndLi.ReplaceAllString(content, "")
-
-	// Remove ul/ol tags
-	reList := regexp.MustCompile(`(?i)</?[ou]l[^>]*>`)
-	content = reList.ReplaceAllString(content, "<br/>")
+	// List items with bullets, or numbers for ordered lists
+	content = convertListItems(content)
 
 	// Remove all remaining HTML tags but preserve WML formatting and table tags
 	// Use placeholders to protect WML tags during stripping
@@ -624,72 +1595,619 @@ func HTMLToWMLWithOptions(htmlContent string, opts RenderOptions) string {
 	}
 
 	// Protect WML anchor tags (they have dynamic href attributes)
-	reWMLAnchor := regexp.MustCompile(`<a href="/article\?id=\d+">`)
+	reWMLAnchor := regexp.MustCompile(`<a href="/article\?id=[^"]+">`)
 	anchorMatches := reWMLAnchor.FindAllString(content, -1)
 	for i, anchor := range anchorMatches {
 		content = strings.Replace(content, anchor, fmt.Sprintf("%%WMLANCHOR%d%%", i), 1)
 	}
 
-	// Strip all remaining HTML tags
-	reTags := regexp.MustCompile(`<[^>]+>`)
-	content = reTags.ReplaceAllString(content, "")
+	// Strip all remaining HTML tags
+	reTags := regexp.MustCompile(`<[^>]+>`)
+	content = reTags.ReplaceAllString(content, "")
+
+	// Restore WML formatting tags
+	for tag, placeholder := range wmlTagPlaceholders {
+		content = strings.ReplaceAll(content, placeholder, tag)
+	}
+
+	// Restore WML img tags
+	for i, img := range imgMatches {
+		content = strings.Replace(content, fmt.Sprintf("%%WMLIMG%d%%", i), img, 1)
+	}
+
+	// Restore WML anchor tags
+	for i, anchor := range anchorMatches {
+		content = strings.Replace(content, fmt.Sprintf("%%WMLANCHOR%d%%", i), anchor, 1)
+	}
+
+	// Decode HTML entities
+	content = html.UnescapeString(content)
+
+	// Remove citation markers whose reference markup wasn't recognized above
+	content = removeCitationMarkers(content)
+
+	// Prefix quoted lines with "> "
+	content = formatBlockquotes(content)
+
+	// Clean up whitespace between tags
+	reSpaceBetweenBr := regexp.MustCompile(`<br/>\s*<br/>`)
+	for i := 0; i < 5; i++ { // Multiple passes to catch nested cases
+		content = reSpaceBetweenBr.ReplaceAllString(content, "<br/><br/>")
+	}
+
+	// Remove empty bullets (• with only whitespace after)
+	reEmptyBullet := regexp.MustCompile(`<br/>•\s*(<br/>|$)`)
+	for i := 0; i < 5; i++ {
+		content = reEmptyBullet.ReplaceAllString(content, "<br/>")
+	}
+
+	// Clean up multiple consecutive breaks (more than 2)
+	reMultiBr := regexp.MustCompile(`(<br/>){3,}`)
+	content = reMultiBr.ReplaceAllString(content, "<br/><br/>")
+
+	// Clean up whitespace
+	reMultiSpace := regexp.MustCompile(`[ \t]+`)
+	content = reMultiSpace.ReplaceAllString(content, " ")
+
+	// Remove whitespace around breaks
+	content = regexp.MustCompile(`\s*<br/>\s*`).ReplaceAllString(content, "<br/>")
+
+	// Re-add single space after breaks for readability but not multiple
+	reMultiBr2 := regexp.MustCompile(`(<br/>){3,}`)
+	content = reMultiBr2.ReplaceAllString(content, "<br/><br/>")
+
+	// Remove breaks at start
+	for strings.HasPrefix(content, "<br/>") {
+		content = strings.TrimPrefix(content, "<br/>")
+	}
+
+	content = strings.TrimSpace(content)
+
+	// u, big and small are converted after the first pass, and may overlap the others
+	content = removeNestedFormattingTags(content)
+
+	// Separate HTML spans often become "</b> <b>", which wastes deck bytes
+	content = mergeFormattingRuns(content)
+
+	// Escape special WML characters (preserving WML formatting tags)
+	content = escapeWMLPreserveTags(content)
+
+	// Restore fieldsets (their titles have been escaped along with the content)
+	if opts.SupportsFieldsets && wml {
+		content = restoreFieldsets(content)
+	}
+
+	// Restore tables (their cells have been escaped along with the content)
+	if opts.SupportsTables && wml {
+		content = restoreTables(content)
+	}
+
+	return content
+}
+
+// Heading placeholders survive tag stripping and escaping until wmlToXHTMLMP. The opening
+// placeholder is followed by the heading level and "%%".
+const (
+	xhtmlHeadingPlaceholder      = "%%XHTMLH"
+	xhtmlHeadingClosePlaceholder = "%%XHTMLHC%%"
+)
+
+// wmlToXHTMLMP turns converted article content into XHTML Mobile Profile markup: text
+// separated by blank lines becomes paragraphs, bulleted lines become lists, marked
+// headings become h2-h4 and bold and italic become strong and em
+func wmlToXHTMLMP(content string) string {
+	// WML variable escaping doesn't apply to XHTML
+	content = strings.ReplaceAll(content, "$$", "$")
+
+	content = strings.NewReplacer(
+		"<b>", "<strong>", "</b>", "</strong>",
+		"<i>", "<em>", "</i>", "</em>",
+		"<u>", "<em>", "</u>", "</em>",
+	).Replace(content)
+
+	reHeading := regexp.MustCompile(`^` + regexp.QuoteMeta(xhtmlHeadingPlaceholder) + `([2-4])%%(.*)` + regexp.QuoteMeta(xhtmlHeadingClosePlaceholder) + `$`)
+
+	var result strings.Builder
+	for _, block := range strings.Split(content, "<br/><br/>") {
+		inParagraph, inList := false, false
+		closeBlock := func() {
+			if inParagraph {
+				result.WriteString("</p>")
+				inParagraph = false
+			}
+			if inList {
+				result.WriteString("</ul>")
+				inList = false
+			}
+		}
+
+		for _, line := range strings.Split(block, "<br/>") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if m := reHeading.FindStringSubmatch(line); m != nil {
+				closeBlock()
+				fmt.Fprintf(&result, "<h%s>%s</h%s>", m[1], strings.TrimSpace(m[2]), m[1])
+				continue
+			}
+			if item, ok := strings.CutPrefix(line, "• "); ok {
+				if inParagraph {
+					result.WriteString("</p>")
+					inParagraph = false
+				}
+				if !inList {
+					result.WriteString("<ul>")
+					inList = true
+				}
+				result.WriteString("<li>" + item + "</li>")
+				continue
+			}
+			if inList {
+				result.WriteString("</ul>")
+				inList = false
+			}
+			if inParagraph {
+				result.WriteString("<br/>" + line)
+			} else {
+				result.WriteString("<p>" + line)
+				inParagraph = true
+			}
+		}
+		closeBlock()
+	}
+
+	// Headings that ended up inside escaped text or were never closed
+	content = result.String()
+	content = strings.ReplaceAll(content, xhtmlHeadingClosePlaceholder, "")
+	content = regexp.MustCompile(regexp.QuoteMeta(xhtmlHeadingPlaceholder)+`\d%%`).ReplaceAllString(content, "")
+	return content
+}
+
+// Fieldset placeholders survive tag stripping and escaping until restoreFieldsets
+const (
+	fieldsetOpenPlaceholder  = "%%WMLFIELDSET%%"
+	fieldsetTitlePlaceholder = "%%WMLFIELDSETT%%"
+	fieldsetClosePlaceholder = "%%WMLFIELDSETC%%"
+)
+
+// Blockquote placeholders survive tag stripping until formatBlockquotes
+const (
+	quoteOpenPlaceholder  = "%%WMLQUOTE%%"
+	quoteClosePlaceholder = "%%WMLQUOTEC%%"
+)
+
+// formatBlockquotes replaces each marked quotation with its lines prefixed by "> ",
+// innermost first so nested quotes get "> > ". Empty quotations are dropped.
+func formatBlockquotes(content string) string {
+	for {
+		open := strings.LastIndex(content, quoteOpenPlaceholder)
+		if open < 0 {
+			break
+		}
+		innerStart := open + len(quoteOpenPlaceholder)
+		closeLen := len(quoteClosePlaceholder)
+		end := strings.Index(content[innerStart:], quoteClosePlaceholder)
+		if end < 0 {
+			// Unclosed quotation, quote the rest of the article
+			end = len(content) - innerStart
+			closeLen = 0
+		}
+
+		lines := strings.Split(trimBreaks(content[innerStart:innerStart+end]), "<br/>")
+		for i, line := range lines {
+			if line = strings.TrimSpace(line); line != "" {
+				lines[i] = "> " + line
+			}
+		}
+		quote := strings.Join(lines, "<br/>")
+		if strings.TrimSpace(strings.ReplaceAll(quote, "<br/>", "")) != "" {
+			quote = "<br/>" + quote + "<br/>"
+		}
+
+		content = content[:open] + quote + content[innerStart+end+closeLen:]
+	}
+
+	// Closing markers without an opening one
+	return strings.ReplaceAll(content, quoteClosePlaceholder, "")
+}
+
+// wrapListSectionsInFieldsets marks lists that directly follow a heading so they
+// can be rendered inside a <fieldset> titled with the heading text
+func wrapListSectionsInFieldsets(content string) string {
+	reHeading := regexp.MustCompile(`(?is)<h[2-6][^>]*>(.*?)</h[2-6]>`)
+	reListStart := regexp.MustCompile(`(?i)^\s*<[ou]l[\s>]`)
+	reTags := regexp.MustCompile(`<[^>]+>`)
+
+	var result strings.Builder
+	last := 0
+	for _, m := range reHeading.FindAllStringSubmatchIndex(content, -1) {
+		if m[0] < last {
+			continue
+		}
+
+		// Collect consecutive lists after the heading
+		listStart, listEnd := m[1], m[1]
+		for {
+			loc := reListStart.FindStringIndex(content[listEnd:])
+			if loc == nil {
+				break
+			}
+			end := findListEnd(content, listEnd+loc[1]-4)
+			if end < 0 {
+				break
+			}
+			listEnd = end
+		}
+		if listEnd == m[1] {
+			continue
+		}
+
+		title := strings.TrimSpace(html.UnescapeString(reTags.ReplaceAllString(content[m[2]:m[3]], "")))
+		if runes := []rune(title); len(runes) > 30 {
+			title = string(runes[:27]) + "..."
+		}
+
+		result.WriteString(content[last:listStart])
+		result.WriteString(fieldsetOpenPlaceholder + html.EscapeString(title) + fieldsetTitlePlaceholder)
+		result.WriteString(content[listStart:listEnd])
+		result.WriteString(fieldsetClosePlaceholder)
+		last = listEnd
+	}
+	result.WriteString(content[last:])
+
+	return result.String()
+}
+
+// listLevel is an open <ul> or <ol> while converting list items
+type listLevel struct {
+	ordered bool
+	number  int    // number of the last item in an ordered list
+	prefix  string // number of the enclosing ordered item, e.g. "2." for items 2.1., 2.2.
+}
+
+// convertListItems replaces <li> with a bullet, or with its number ("1. ", "2. ") inside
+// an <ol>. Numbers restart for every list; an ordered list nested in a numbered item is
+// numbered below it ("2.1. "). The list tags themselves become line breaks.
+func convertListItems(content string) string {
+	reListTag := regexp.MustCompile(`(?i)<(/?)(ul|ol|li)\b([^>]*)>`)
+	reStart := regexp.MustCompile(`(?i)\b(?:start|value)="?(-?\d+)`)
+
+	var result strings.Builder
+	var stack []listLevel
+	last := 0
+	for _, m := range reListTag.FindAllStringSubmatchIndex(content, -1) {
+		result.WriteString(content[last:m[0]])
+		last = m[1]
+
+		closing := m[3] > m[2]
+		tag := strings.ToLower(content[m[4]:m[5]])
+		attrs := content[m[6]:m[7]]
+
+		switch {
+		case tag == "li" && closing:
+			// Items end where the next one starts
+		case tag == "li":
+			// Drop whitespace between the tag and the item text
+			for last < len(content) && strings.ContainsRune(" \t\r\n", rune(content[last])) {
+				last++
+			}
+			if len(stack) == 0 || !stack[len(stack)-1].ordered {
+				result.WriteString("<br/>• ")
+				break
+			}
+			level := &stack[len(stack)-1]
+			level.number++
+			if sm := reStart.FindStringSubmatch(attrs); sm != nil {
+				level.number, _ = strconv.Atoi(sm[1])
+			}
+			fmt.Fprintf(&result, "<br/>%s%d. ", level.prefix, level.number)
+		case closing:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			result.WriteString("<br/>")
+		default:
+			level := listLevel{ordered: tag == "ol"}
+			if level.ordered {
+				if sm := reStart.FindStringSubmatch(attrs); sm != nil {
+					start, _ := strconv.Atoi(sm[1])
+					level.number = start - 1
+				}
+				if len(stack) > 0 && stack[len(stack)-1].ordered {
+					parent := stack[len(stack)-1]
+					level.prefix = fmt.Sprintf("%s%d.", parent.prefix, parent.number)
+				}
+			}
+			stack = append(stack, level)
+			result.WriteString("<br/>")
+		}
+	}
+	result.WriteString(content[last:])
+
+	return result.String()
+}
+
+// findListEnd returns the offset just past the list element opening at or after start,
+// taking nested lists into account, or -1 if the list is not closed
+func findListEnd(content string, start int) int {
+	reListTag := regexp.MustCompile(`(?i)<(/?)[ou]l[\s>]`)
+	depth := 0
+	for _, loc := range reListTag.FindAllStringSubmatchIndex(content[start:], -1) {
+		if loc[3] > loc[2] {
+			depth--
+			if depth == 0 {
+				closeEnd := strings.IndexByte(content[start+loc[0]:], '>')
+				return start + loc[0] + closeEnd + 1
+			}
+		} else {
+			depth++
+		}
+	}
+	return -1
+}
+
+// removeCollapsedSections replaces collapsible elements that are collapsed by default
+// with a short note naming their heading
+func removeCollapsedSections(content string) string {
+	reCollapsible := regexp.MustCompile(`(?i)<(div|table)\b[^>]*class="([^"]*)"[^>]*>`)
+	reHeading := regexp.MustCompile(`(?is)<(?:caption|th)[^>]*>(.*?)</(?:caption|th)>|<div[^>]*class="[^"]*NavHead[^"]*"[^>]*>(.*?)</div>`)
+	reTags := regexp.MustCompile(`<[^>]*>`)
+
+	var result strings.Builder
+	pos := 0
+	for {
+		loc := reCollapsible.FindStringSubmatchIndex(content[pos:])
+		if loc == nil {
+			break
+		}
+		start := pos + loc[0]
+		tag := strings.ToLower(content[pos+loc[2] : pos+loc[3]])
+		if !isCollapsedClass(content[pos+loc[4] : pos+loc[5]]) {
+			result.WriteString(content[pos : pos+loc[1]])
+			pos += loc[1]
+			continue
+		}
+		end := findElementEnd(content, start, tag)
+		if end < 0 {
+			break
+		}
+
+		result.WriteString(content[pos:start])
+		block := content[start:end]
+		heading := ""
+		if m := reHeading.FindStringSubmatch(block); m != nil {
+			heading = strings.TrimSpace(reTags.ReplaceAllString(m[1]+m[2], ""))
+		}
+		if heading != "" {
+			result.WriteString("<p><i>" + heading + " (collapsed)</i></p>")
+		} else {
+			result.WriteString("<p><i>(collapsed content)</i></p>")
+		}
+		pos = end
+	}
+	result.WriteString(content[pos:])
+	return result.String()
+}
+
+// removeCitationMarkers removes citation markers such as [12] or [3, 4] from text.
+// Only numeric ones, so [sic] and other bracketed text stays.
+func removeCitationMarkers(text string) string {
+	reCitation := regexp.MustCompile(`[ \t]*\[\d+(?:\s*[,–-]\s*\d+)*\]`)
+	return reCitation.ReplaceAllString(text, "")
+}
 
-	// Restore WML formatting tags
-	for tag, placeholder := range wmlTagPlaceholders {
-		content = strings.ReplaceAll(content, placeholder, tag)
+// Pronunciation placeholder marks where removePronunciations removed one, to clean up
+// what was around it
+const pronunciationPlaceholder = "%%WMLIPA%%"
+
+// removePronunciations removes IPA pronunciations and their audio links, along with
+// the language labels and parentheses they leave empty, e.g. "Paris (French: [paʁi])"
+// becomes "Paris"
+func removePronunciations(content string) string {
+	content = replaceElementsWithClass(content, "span", pronunciationPlaceholder, "IPA", "ext-phonos", "haudio")
+	reRespelling := regexp.MustCompile(`(?is)<i\b[^>]*title="[^"]*pronunciation respelling[^"]*"[^>]*>.*?</i>`)
+	content = reRespelling.ReplaceAllString(content, pronunciationPlaceholder)
+	if !strings.Contains(content, pronunciationPlaceholder) {
+		return content
 	}
 
-	// Restore WML img tags
-	for i, img := range imgMatches {
-		content = strings.Replace(content, fmt.Sprintf("%%WMLIMG%d%%", i), img, 1)
+	placeholder := regexp.QuoteMeta(pronunciationPlaceholder)
+	reLabel := regexp.MustCompile(`(?i)(?:<a\b[^>]*>[^<]*</a>|\p{L}+)(?:\s+pronunciation)?:\s*((?:<[^>]*>|\s)*` + placeholder + `)`)
+	content = reLabel.ReplaceAllString(content, "$1")
+	content = strings.ReplaceAll(content, pronunciationPlaceholder, "")
+
+	// Parentheses with only tags, separators and whitespace left in them, innermost first
+	// as audio links come in parentheses of their own
+	reEmpty := regexp.MustCompile(`\s*\((?:<[^>]*>|\s|&nbsp;|[;,/])*\)`)
+	for {
+		result := reEmpty.ReplaceAllString(content, "")
+		if result == content {
+			break
+		}
+		content = result
 	}
+	reLeadingSeparator := regexp.MustCompile(`\(((?:<[^>]*>|\s)*)[;,]\s*`)
+	content = reLeadingSeparator.ReplaceAllString(content, "($1")
+	reTrailingSeparator := regexp.MustCompile(`\s*[;,]\s*((?:<[^>]*>)*)\s*\)`)
+	return reTrailingSeparator.ReplaceAllString(content, "$1)")
+}
 
-	// Restore WML anchor tags
-	for i, anchor := range anchorMatches {
-		content = strings.Replace(content, fmt.Sprintf("%%WMLANCHOR%d%%", i), anchor, 1)
+// formatCoordinates replaces coordinate markup with a short decimal form such as
+// "51.5°N, 0.1°W", using the machine-readable copy Wikipedia includes next to the
+// coordinates it shows
+func formatCoordinates(content string) string {
+	reGeo := regexp.MustCompile(`(?i)<span[^>]*class="geo"[^>]*>\s*(-?\d+(?:\.\d+)?)\s*;\s*(-?\d+(?:\.\d+)?)\s*</span>`)
+	reShown := regexp.MustCompile(`(?i)<span\b[^>]*class="[^"]*\bgeo-default\b[^"]*"[^>]*>`)
+
+	var result strings.Builder
+	pos := 0
+	for {
+		loc := reGeo.FindStringSubmatchIndex(content[pos:])
+		if loc == nil {
+			break
+		}
+		geoStart, geoEnd := pos+loc[0], pos+loc[1]
+		lat, _ := strconv.ParseFloat(content[pos+loc[2]:pos+loc[3]], 64)
+		lon, _ := strconv.ParseFloat(content[pos+loc[4]:pos+loc[5]], 64)
+		text := coordinateText(lat, lon)
+
+		// The coordinates shown on Wikipedia come before their machine-readable copy,
+		// replace those and leave the copy to be removed below. Decimal coordinates
+		// shown hold the copy, the whole of them is replaced.
+		if shown := reShown.FindAllStringIndex(content[pos:geoStart], -1); len(shown) > 0 {
+			start := pos + shown[len(shown)-1][0]
+			if end := findElementEnd(content, start, "span"); end > 0 && end <= geoStart {
+				result.WriteString(content[pos:start])
+				result.WriteString(text)
+				result.WriteString(content[end:geoEnd])
+				pos = geoEnd
+				continue
+			} else if end >= geoEnd {
+				result.WriteString(content[pos:start])
+				result.WriteString(text)
+				pos = end
+				continue
+			}
+		}
+		result.WriteString(content[pos:geoStart])
+		result.WriteString(text)
+		pos = geoEnd
 	}
+	result.WriteString(content[pos:])
 
-	// Decode HTML entities
-	content = html.UnescapeString(content)
+	// The decimal duplicates are hidden on Wikipedia itself
+	return removeElementsWithClass(result.String(), "span", "geo-nondefault", "geo-multi-punct", "geo")
+}
 
-	// Clean up whitespace between tags
-	reSpaceBetweenBr := regexp.MustCompile(`<br/>\s*<br/>`)
-	for i := 0; i < 5; i++ { // Multiple passes to catch nested cases
-		content = reSpaceBetweenBr.ReplaceAllString(content, "<br/><br/>")
+// coordinateText formats decimal coordinates as e.g. "51.5°N, 0.1°W"
+func coordinateText(lat, lon float64) string {
+	ns, ew := "N", "E"
+	if lat < 0 {
+		ns, lat = "S", -lat
 	}
-
-	// Remove empty bullets (• with only whitespace after)
-	reEmptyBullet := regexp.MustCompile(`<br/>•\s*(<br/>|$)`)
-	for i := 0; i < 5; i++ {
-		content = reEmptyBullet.ReplaceAllString(content, "<br/>")
+	if lon < 0 {
+		ew, lon = "W", -lon
 	}
+	return fmt.Sprintf("%.1f°%s, %.1f°%s", lat, ns, lon, ew)
+}
 
-	// Clean up multiple consecutive breaks (more than 2)
-	reMultiBr := regexp.MustCompile(`(<br/>){3,}`)
-	content = reMultiBr.ReplaceAllString(content, "<br/><br/>")
+// convertHatnotes removes hatnotes ("For other uses, see ...") and disambiguation notices.
+// With keepFirst the first one that has a link is kept as a compact "See also" line
+// with that link.
+func convertHatnotes(content string, keepFirst bool) string {
+	reLink := regexp.MustCompile(`(?is)<a\b[^>]*href=[^>]*>.*?</a>`)
+	kept := !keepFirst
+	return replaceElementsWithClassFunc(content, "div", []string{"hatnote", "dablink", "rellink"}, func(element string) string {
+		if kept {
+			return ""
+		}
+		link := reLink.FindString(element)
+		if link == "" {
+			return ""
+		}
+		kept = true
+		return "<p><i>See also: " + link + "</i></p>"
+	})
+}
 
-	// Clean up whitespace
-	reMultiSpace := regexp.MustCompile(`[ \t]+`)
-	content = reMultiSpace.ReplaceAllString(content, " ")
+// removeElementsWithClass removes tag elements, including their content and nested
+// elements, whose class attribute contains one of classes
+func removeElementsWithClass(content, tag string, classes ...string) string {
+	return replaceElementsWithClass(content, tag, "", classes...)
+}
 
-	// Remove whitespace around breaks
-	content = regexp.MustCompile(`\s*<br/>\s*`).ReplaceAllString(content, "<br/>")
+// replaceElementsWithClass replaces tag elements, including their content and nested
+// elements, whose class attribute contains one of classes with replacement
+func replaceElementsWithClass(content, tag, replacement string, classes ...string) string {
+	return replaceElementsWithClassFunc(content, tag, classes, func(string) string {
+		return replacement
+	})
+}
 
-	// Re-add single space after breaks for readability but not multiple
-	reMultiBr2 := regexp.MustCompile(`(<br/>){3,}`)
-	content = reMultiBr2.ReplaceAllString(content, "<br/><br/>")
+// replaceElementsWithClassFunc replaces tag elements whose class attribute contains one
+// of classes with the result of replace for the whole element
+func replaceElementsWithClassFunc(content, tag string, classes []string, replace func(element string) string) string {
+	reElement := regexp.MustCompile(`(?i)<` + tag + `\b[^>]*class="([^"]*)"[^>]*>`)
 
-	// Remove breaks at start
-	for strings.HasPrefix(content, "<br/>") {
-		content = strings.TrimPrefix(content, "<br/>")
+	var result strings.Builder
+	pos := 0
+	for {
+		loc := reElement.FindStringSubmatchIndex(content[pos:])
+		if loc == nil {
+			break
+		}
+		start := pos + loc[0]
+		if !hasClass(content[pos+loc[2]:pos+loc[3]], classes) {
+			result.WriteString(content[pos : pos+loc[1]])
+			pos += loc[1]
+			continue
+		}
+		end := findElementEnd(content, start, tag)
+		if end < 0 {
+			break
+		}
+		result.WriteString(content[pos:start])
+		result.WriteString(replace(content[start:end]))
+		pos = end
 	}
+	result.WriteString(content[pos:])
+	return result.String()
+}
 
-	content = strings.TrimSpace(content)
+// hasClass reports whether a class attribute contains one of classes
+func hasClass(class string, classes []string) bool {
+	for _, c := range strings.Fields(class) {
+		for _, want := range classes {
+			if c == want {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-	// Escape special WML characters (preserving WML formatting tags)
-	content = escapeWMLPreserveTags(content)
+// isCollapsedClass reports whether a class attribute marks an element collapsed by default
+func isCollapsedClass(class string) bool {
+	collapsible, collapsed := false, false
+	for _, c := range strings.Fields(class) {
+		switch c {
+		case "mw-collapsible", "collapsible", "NavFrame":
+			collapsible = true
+		case "mw-collapsed", "collapsed", "autocollapse":
+			collapsed = true
+		}
+	}
+	return collapsible && collapsed
+}
 
-	return content
+// findElementEnd returns the offset just past the tag element opening at start, taking
+// nested elements of the same name into account, or -1 if it is not closed
+func findElementEnd(content string, start int, tag string) int {
+	reTag := regexp.MustCompile(`(?i)<(/?)` + tag + `[\s>]`)
+	depth := 0
+	for _, loc := range reTag.FindAllStringSubmatchIndex(content[start:], -1) {
+		if loc[3] > loc[2] {
+			depth--
+			if depth == 0 {
+				closeEnd := strings.IndexByte(content[start+loc[0]:], '>')
+				return start + loc[0] + closeEnd + 1
+			}
+		} else {
+			depth++
+		}
+	}
+	return -1
+}
+
+// restoreFieldsets turns fieldset placeholders into WML fieldset elements
+func restoreFieldsets(content string) string {
+	reFieldset := regexp.MustCompile(regexp.QuoteMeta(fieldsetOpenPlaceholder) + `(.*?)` + regexp.QuoteMeta(fieldsetTitlePlaceholder))
+	content = reFieldset.ReplaceAllStringFunc(content, func(m string) string {
+		title := reFieldset.FindStringSubmatch(m)[1]
+		return `<fieldset title="` + strings.TrimSpace(title) + `">`
+	})
+	return strings.ReplaceAll(content, fieldsetClosePlaceholder, "</fieldset>")
 }
 
 // Global wiki instance reference for image ID lookup during conversion
@@ -700,32 +2218,55 @@ func SetGlobalWiki(w *Wikipedia) {
 	globalWiki = w
 }
 
-// convertHTMLImagesToWML converts HTML img tags to WML img tags pointing to /image/ endpoint
-func convertHTMLImagesToWML(content string) string {
+// linkWiki returns the wiki that resolves links while rendering with these options
+func (opts RenderOptions) linkWiki() *Wikipedia {
+	if opts.wiki != nil {
+		return opts.wiki
+	}
+	return globalWiki
+}
+
+// inlineImageWidth is the width requested for images shown inside an article, smaller
+// than the image endpoint's default used when an image is opened on its own
+const inlineImageWidth = 64
+
+// convertHTMLImagesToWML converts HTML img tags to WML img tags pointing to /image/ endpoint,
+// appending the images to images if it is not nil
+func convertHTMLImagesToWML(content string, wiki *Wikipedia, images *[]ArticleImage) string {
 	// Match img tags with src attribute
 	reImg := regexp.MustCompile(`(?i)<img[^>]*src=["']([^"']+)["'][^>]*>`)
+	reSrc := regexp.MustCompile(`(?i)src=["']([^"']+)["']`)
+	reAlt := regexp.MustCompile(`(?i)alt=["']([^"']+)["']`)
+
+	var out strings.Builder
+	last := 0
+	for _, loc := range reImg.FindAllStringIndex(content, -1) {
+		out.WriteString(content[last:loc[0]])
+		last = loc[1]
+		imgTag := content[loc[0]:loc[1]]
 
-	content = reImg.ReplaceAllStringFunc(content, func(imgTag string) string {
 		// Extract src
-		srcMatch := regexp.MustCompile(`(?i)src=["']([^"']+)["']`).FindStringSubmatch(imgTag)
+		srcMatch := reSrc.FindStringSubmatch(imgTag)
 		if len(srcMatch) < 2 {
-			return ""
+			continue
 		}
 		src := srcMatch[1]
 
 		// Skip non-image files, SVGs (not supported in WBMP), and data URIs
 		srcLower := strings.ToLower(src)
 		if strings.HasPrefix(srcLower, "data:") {
-			return ""
+			continue
 		}
 		if strings.HasSuffix(srcLower, ".svg") {
-			return "" // SVG can't be converted to WBMP
+			continue // SVG can't be converted to WBMP
 		}
 
 		// Extract alt text if available
 		alt := "image"
-		altMatch := regexp.MustCompile(`(?i)alt=["']([^"']+)["']`).FindStringSubmatch(imgTag)
+		var altText string
+		altMatch := reAlt.FindStringSubmatch(imgTag)
 		if len(altMatch) > 1 {
+			altText = wmlToPlainText(altMatch[1])
 			alt = altMatch[1]
 			// Truncate long alt text
 			if len(alt) > 20 {
@@ -746,22 +2287,178 @@ func convertHTMLImagesToWML(content string) string {
 			src = src[1:]
 		}
 
-		// Try to find image ID for shorter URLs
-		if globalWiki != nil {
-			if imgID, err := globalWiki.FindImageID(src); err == nil {
-				return fmt.Sprintf(`<br/><img src="/image/%d" alt="%s"/><br/>`, imgID, alt)
+		// Try to find image ID for shorter URLs, falling back to a path-based URL
+		id := src
+		if wiki != nil {
+			if imgID, err := wiki.FindImageID(src); err == nil {
+				id = wiki.ArticleID(imgID)
+			} else if wiki.name != "" {
+				id = wiki.name + ":" + src
 			}
 		}
+		if images != nil {
+			*images = append(*images, ArticleImage{ID: id, Alt: altText, Caption: imageCaption(content[loc[1]:])})
+		}
+		fmt.Fprintf(&out, `<br/><img src="/image/%s?w=%d" alt="%s"/><br/>`, id, inlineImageWidth, alt)
+	}
+	out.WriteString(content[last:])
+
+	return out.String()
+}
+
+// imageCaption returns the plain text caption of the image whose tag ends where after
+// starts: the figcaption of its figure, or the thumbcaption of older ZIM files. Images
+// outside figures have none.
+func imageCaption(after string) string {
+	// Only look as far as the next image, the end of the figure or the next paragraph
+	reEnd := regexp.MustCompile(`(?i)<img|</figure>|<p[\s>]`)
+	reCaption := regexp.MustCompile(`(?is)<figcaption[^>]*>(.*?)</figcaption>|<div[^>]*class="[^"]*thumbcaption[^"]*"[^>]*>(.*?)</div>`)
+	if end := reEnd.FindStringIndex(after); end != nil {
+		after = after[:end[0]]
+	}
+	m := reCaption.FindStringSubmatch(after)
+	if m == nil {
+		return ""
+	}
+	return removeCitationMarkers(wmlToPlainText(m[1] + m[2]))
+}
+
+// Unicode bidi control characters, used because WML has no dir attribute
+const (
+	bidiLRE = "\u202A" // left-to-right embedding
+	bidiRLE = "\u202B" // right-to-left embedding
+	bidiPDF = "\u202C" // pop directional formatting
+	bidiLRO = "\u202D" // left-to-right override
+	bidiRLO = "\u202E" // right-to-left override
+)
+
+// convertBidiSpans replaces bdo/bdi elements and spans with a dir attribute by
+// Unicode bidi control characters so the inline text keeps its visual order
+func convertBidiSpans(content string) string {
+	reDir := regexp.MustCompile(`(?i)\bdir=["']?(rtl|ltr)`)
+	getDir := func(attrs string) string {
+		if m := reDir.FindStringSubmatch(attrs); len(m) > 1 {
+			return strings.ToLower(m[1])
+		}
+		return ""
+	}
+
+	// bdo forces the direction of its content
+	reBdo := regexp.MustCompile(`(?is)<bdo([^>]*)>(.*?)</bdo>`)
+	content = reBdo.ReplaceAllStringFunc(content, func(m string) string {
+		sub := reBdo.FindStringSubmatch(m)
+		switch getDir(sub[1]) {
+		case "rtl":
+			return bidiRLO + sub[2] + bidiPDF
+		case "ltr":
+			return bidiLRO + sub[2] + bidiPDF
+		}
+		return sub[2]
+	})
 
-		// Fallback to path-based URL if ID lookup fails
-		return fmt.Sprintf(`<br/><img src="/image/%s" alt="%s"/><br/>`, src, alt)
+	// bdi and dir spans embed their content; bdi without dir uses the text's own direction
+	reEmbed := regexp.MustCompile(`(?is)<(bdi|span)(\s[^>]*)?>(.*?)</(?:bdi|span)>`)
+	content = reEmbed.ReplaceAllStringFunc(content, func(m string) string {
+		sub := reEmbed.FindStringSubmatch(m)
+		dir := getDir(sub[2])
+		if dir == "" && strings.EqualFold(sub[1], "bdi") && isRTLText(sub[3]) {
+			dir = "rtl"
+		}
+		switch dir {
+		case "rtl":
+			return bidiRLE + sub[3] + bidiPDF
+		case "ltr":
+			return bidiLRE + sub[3] + bidiPDF
+		}
+		return m
 	})
 
 	return content
 }
 
-// convertHTMLLinksToWML converts HTML anchor tags to WML anchors with article IDs
-func convertHTMLLinksToWML(content string) string {
+// isRTLText reports whether the first strongly directional letter in s is right-to-left
+func isRTLText(s string) bool {
+	s = regexp.MustCompile(`<[^>]+>`).ReplaceAllString(s, "")
+	for _, r := range s {
+		if unicode.In(r, unicode.Hebrew, unicode.Arabic, unicode.Syriac, unicode.Thaana, unicode.Nko) {
+			return true
+		}
+		if unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return false
+}
+
+// External link placeholders mark footnote references, they survive tag stripping, citation
+// marker removal and escaping until appendExternalLinkFootnotes. The placeholder is
+// followed by the footnote number and "%%".
+const externalLinkPlaceholder = "%%WMLEXT"
+
+// appendExternalLinkFootnotes numbers the external link references in content and
+// appends the list of their URLs
+func appendExternalLinkFootnotes(content string, links []string, xhtml bool) string {
+	reRef := regexp.MustCompile(regexp.QuoteMeta(externalLinkPlaceholder) + `(\d+)%%`)
+	content = reRef.ReplaceAllString(content, "[$1]")
+
+	var b strings.Builder
+	b.WriteString(trimBreaks(content))
+	if xhtml {
+		fmt.Fprintf(&b, "<br/><br/>%s2%%%%External links%s<br/>", xhtmlHeadingPlaceholder, xhtmlHeadingClosePlaceholder)
+	} else {
+		b.WriteString("<br/><br/><b>External links</b><br/>")
+	}
+	for i, link := range links {
+		link = escapeWML(link)
+		fmt.Fprintf(&b, `[%d] <a href="%s">%s</a><br/>`, i+1, link, link)
+	}
+	return b.String()
+}
+
+// internalLinkTarget returns the article URL an href of article HTML links to, cleaned of
+// relative path prefixes and its fragment and decoded. External, anchor and special links
+// and links to files, templates, categories and other non-article pages return false.
+func internalLinkTarget(href string) (string, bool) {
+	// Skip external links, anchors, and special links
+	if strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") ||
+		strings.HasPrefix(href, "#") || strings.HasPrefix(href, "mailto:") ||
+		strings.HasPrefix(href, "javascript:") {
+		return "", false
+	}
+
+	// Clean up the href
+	href = strings.TrimPrefix(href, "./")
+	href = strings.TrimPrefix(href, "../")
+	if strings.HasPrefix(href, "/") {
+		href = href[1:]
+	}
+
+	// Remove fragment/anchor from URL
+	if idx := strings.Index(href, "#"); idx != -1 {
+		href = href[:idx]
+	}
+
+	// URL decode the href
+	decodedHref, _ := url.QueryUnescape(href)
+	if decodedHref != "" {
+		href = decodedHref
+	}
+
+	// Skip non-article links (files, special pages, etc.)
+	hrefLower := strings.ToLower(href)
+	if strings.HasPrefix(hrefLower, "file:") || strings.HasPrefix(hrefLower, "special:") ||
+		strings.HasPrefix(hrefLower, "wikipedia:") || strings.HasPrefix(hrefLower, "help:") ||
+		strings.HasPrefix(hrefLower, "template:") || strings.HasPrefix(hrefLower, "category:") ||
+		strings.HasPrefix(hrefLower, "talk:") || strings.HasPrefix(hrefLower, "user:") {
+		return "", false
+	}
+	return href, href != ""
+}
+
+// convertHTMLLinksToWML converts HTML anchor tags to WML anchors with article IDs. External
+// links are dropped for their text, unless externalLinks is set: their URLs are then added
+// to it and the text is marked with a footnote reference.
+func convertHTMLLinksToWML(content string, wiki *Wikipedia, externalLinks *[]string) string {
 	// First, handle anchor tags with href attribute
 	reAnchor := regexp.MustCompile(`(?is)<a\s[^>]*href=["']([^"']+)["'][^>]*>(.*?)</a>`)
 
@@ -790,50 +2487,28 @@ func convertHTMLLinksToWML(content string) string {
 			return ""
 		}
 
-		// Skip external links, anchors, and special links
-		if strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") ||
-			strings.HasPrefix(href, "#") || strings.HasPrefix(href, "mailto:") ||
-			strings.HasPrefix(href, "javascript:") {
-			// Return just the text for external/special links
-			return linkText
-		}
-
-		// Handle internal Wikipedia links
-		// Clean up the href
-		href = strings.TrimPrefix(href, "./")
-		href = strings.TrimPrefix(href, "../")
-		if strings.HasPrefix(href, "/") {
-			href = href[1:]
-		}
-
-		// Remove fragment/anchor from URL
-		if idx := strings.Index(href, "#"); idx != -1 {
-			href = href[:idx]
-		}
-
-		// URL decode the href
-		decodedHref, _ := url.QueryUnescape(href)
-		if decodedHref != "" {
-			href = decodedHref
+		// Keep the URL of external links as a footnote if asked to
+		isExternal := strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://")
+		if isExternal && externalLinks != nil {
+			href = html.UnescapeString(href)
+			n := slices.Index(*externalLinks, href) + 1
+			if n == 0 {
+				*externalLinks = append(*externalLinks, href)
+				n = len(*externalLinks)
+			}
+			return fmt.Sprintf("%s%s%d%%%%", linkText, externalLinkPlaceholder, n)
 		}
 
-		// Skip non-article links (files, special pages, etc.)
-		hrefLower := strings.ToLower(href)
-		if strings.HasPrefix(hrefLower, "file:") || strings.HasPrefix(hrefLower, "special:") ||
-			strings.HasPrefix(hrefLower, "wikipedia:") || strings.HasPrefix(hrefLower, "help:") ||
-			strings.HasPrefix(hrefLower, "template:") || strings.HasPrefix(hrefLower, "category:") ||
-			strings.HasPrefix(hrefLower, "talk:") || strings.HasPrefix(hrefLower, "user:") {
+		// Return just the text for external, special and non-article links
+		href, ok := internalLinkTarget(href)
+		if !ok {
 			return linkText
 		}
 
 		// Try to find article ID
-		if globalWiki != nil {
-			if idx, err := globalWiki.reader.FindArticleByURL('A', href); err == nil {
-				return fmt.Sprintf(`<a href="/article?id=%d">%s</a>`, idx, escapeWML(linkText))
-			}
-			// Try C namespace
-			if idx, err := globalWiki.reader.FindArticleByURL('C', href); err == nil {
-				return fmt.Sprintf(`<a href="/article?id=%d">%s</a>`, idx, escapeWML(linkText))
+		if wiki != nil {
+			if idx, ok := wiki.ResolveLink(href); ok {
+				return fmt.Sprintf(`<a href="/article?id=%s">%s</a>`, wiki.ArticleID(idx), escapeWML(linkText))
 			}
 		}
 
@@ -843,10 +2518,27 @@ func convertHTMLLinksToWML(content string) string {
 
 	// Clean up any remaining anchor tags without href (like <a name="...">)
 	reAnchorNoHref := regexp.MustCompile(`(?is)<a\s[^>]*>(.*?)</a>`)
-	content = reAnchorNoHref.ReplaceAllString(content, "$1")
+	content = reAnchorNoHref.ReplaceAllStringFunc(content, func(m string) string {
+		if strings.HasPrefix(m, `<a href="/article?id=`) {
+			return m
+		}
+		return reAnchorNoHref.FindStringSubmatch(m)[1]
+	})
 
-	// Remove any stray closing </a> tags that might remain
-	content = strings.ReplaceAll(content, "</a>", "")
+	// Remove any stray closing </a> tags that might remain, keeping those of converted links
+	reLinkTag := regexp.MustCompile(`<a href="/article\?id=[^"]*">|</a>`)
+	inLink := false
+	content = reLinkTag.ReplaceAllStringFunc(content, func(tag string) string {
+		if tag != "</a>" {
+			inLink = true
+			return tag
+		}
+		if !inLink {
+			return ""
+		}
+		inLink = false
+		return tag
+	})
 
 	return content
 }
@@ -908,6 +2600,96 @@ func convertHTMLTablesToText(content string) string {
 	return content
 }
 
+// maxTableColumns caps the columns of article tables; extra cells are merged into the last column
+const maxTableColumns = 3
+
+// Table placeholders survive tag stripping and escaping until restoreTables
+const (
+	tableOpenPlaceholder  = "%%WMLTABLE"
+	tableClosePlaceholder = "%%WMLTABLEC%%"
+	rowOpenPlaceholder    = "%%WMLTR%%"
+	rowClosePlaceholder   = "%%WMLTRC%%"
+	cellOpenPlaceholder   = "%%WMLTD%%"
+	cellClosePlaceholder  = "%%WMLTDC%%"
+)
+
+// convertHTMLTablesToWML converts article tables to WML tables of at most maxTableColumns
+// columns. Header cells are bolded, empty rows dropped and short rows padded.
+func convertHTMLTablesToWML(content string) string {
+	reTable := regexp.MustCompile(`(?is)<table[^>]*>(.*?)</table>`)
+	reRow := regexp.MustCompile(`(?is)<tr[^>]*>(.*?)</tr>`)
+	reCell := regexp.MustCompile(`(?is)<(t[hd])[^>]*>(.*?)</t[hd]>`)
+
+	return reTable.ReplaceAllStringFunc(content, func(tableHTML string) string {
+		tableContent := reTable.FindStringSubmatch(tableHTML)[1]
+
+		var rows [][]string
+		columns := 0
+		for _, row := range reRow.FindAllStringSubmatch(tableContent, -1) {
+			var cells []string
+			hasContent := false
+			for _, cell := range reCell.FindAllStringSubmatch(row[1], -1) {
+				text := html.EscapeString(cellText(cell[2]))
+				if text != "" {
+					hasContent = true
+					if strings.EqualFold(cell[1], "th") {
+						text = "<b>" + text + "</b>"
+					}
+				}
+				cells = append(cells, text)
+			}
+			if !hasContent {
+				continue
+			}
+
+			// Merge overflow cells into the last column
+			if len(cells) > maxTableColumns {
+				var overflow []string
+				for _, cell := range cells[maxTableColumns-1:] {
+					if cell != "" {
+						overflow = append(overflow, cell)
+					}
+				}
+				cells = append(cells[:maxTableColumns-1], strings.Join(overflow, " - "))
+			}
+			columns = max(columns, len(cells))
+			rows = append(rows, cells)
+		}
+		if len(rows) == 0 {
+			return ""
+		}
+
+		var result strings.Builder
+		result.WriteString("<br/>" + tableOpenPlaceholder + strconv.Itoa(columns) + "%%")
+		for _, cells := range rows {
+			result.WriteString(rowOpenPlaceholder)
+			for i := 0; i < columns; i++ {
+				result.WriteString(cellOpenPlaceholder)
+				if i < len(cells) {
+					result.WriteString(cells[i])
+				}
+				result.WriteString(cellClosePlaceholder)
+			}
+			result.WriteString(rowClosePlaceholder)
+		}
+		result.WriteString(tableClosePlaceholder + "<br/>")
+		return result.String()
+	})
+}
+
+// restoreTables replaces the placeholders of convertHTMLTablesToWML with WML table tags
+func restoreTables(content string) string {
+	reTableOpen := regexp.MustCompile(regexp.QuoteMeta(tableOpenPlaceholder) + `(\d+)%%`)
+	content = reTableOpen.ReplaceAllString(content, `<table columns="$1">`)
+	return strings.NewReplacer(
+		tableClosePlaceholder, "</table>",
+		rowOpenPlaceholder, "<tr>",
+		rowClosePlaceholder, "</tr>",
+		cellOpenPlaceholder, "<td>",
+		cellClosePlaceholder, "</td>",
+	).Replace(content)
+}
+
 // escapeWMLPreserveTags escapes WML special chars but preserves WML formatting tags
 func escapeWMLPreserveTags(s string) string {
 	// All WML tags to preserve (no tables - article tables are converted to text)
@@ -942,7 +2724,7 @@ func escapeWMLPreserveTags(s string) string {
 	}
 
 	// Protect anchor tags with href attributes
-	reAnchor := regexp.MustCompile(`<a href="/article\?id=(\d+)">`)
+	reAnchor := regexp.MustCompile(`<a href="/article\?id=([^"]+)">`)
 	anchorMatches := reAnchor.FindAllStringSubmatch(s, -1)
 	for i, match := range anchorMatches {
 		s = strings.Replace(s, match[0], fmt.Sprintf("%%ANCHOR_%d%%", i), 1)
@@ -1029,42 +2811,207 @@ func SplitContent(content string, maxLength int) []string {
 	return chunks
 }
 
-// stripLeadingTitle removes the article title from the beginning of content
-// since it's already displayed in the card title
-func stripLeadingTitle(content string, title string) string {
-	// Remove leading breaks
-	content = strings.TrimPrefix(content, "<br/>")
-	content = strings.TrimPrefix(content, "<br/>")
+// deckTag is an element left open at a page boundary
+type deckTag struct {
+	name string // element name, e.g. "b"
+	open string // original opening tag, reused to reopen the element on the next page
+}
+
+// atomicDeckTags are elements whose content is kept on one page unless it alone is too
+// large for a page
+var atomicDeckTags = map[string]bool{
+	"a": true, "b": true, "i": true, "u": true, "big": true, "small": true,
+	"em": true, "strong": true, "tr": true, "h2": true, "h3": true, "h4": true,
+}
+
+// SplitContentByDeckSize splits rendered WML into pages of at most maxBytes bytes as
+// sent to the device (escaped entities and multi-byte characters count in full).
+// Links, formatting runs and table rows are never split unless they alone exceed a
+// page; elements open at a page boundary are closed and reopened on the next page.
+func SplitContentByDeckSize(content string, maxBytes int) []string {
+	if len(content) <= maxBytes {
+		return []string{content}
+	}
+
+	reToken := regexp.MustCompile(`<[^>]*>|\s+|[^<\s]+|<`)
+	reTagName := regexp.MustCompile(`^</?([a-zA-Z]+)`)
+
+	closing := func(tags []deckTag) string {
+		var b strings.Builder
+		for i := len(tags) - 1; i >= 0; i-- {
+			b.WriteString("</" + tags[i].name + ">")
+		}
+		return b.String()
+	}
+	reopening := func(tags []deckTag) string {
+		var b strings.Builder
+		for _, t := range tags {
+			b.WriteString(t.open)
+		}
+		return b.String()
+	}
+	inAtomic := func(tags []deckTag) bool {
+		for _, t := range tags {
+			if atomicDeckTags[t.name] {
+				return true
+			}
+		}
+		return false
+	}
 
-	// Pattern: title as plain text at start
-	if after, ok := strings.CutPrefix(content, title); ok {
-		content = after
+	var pages []string
+	var page, segment strings.Builder
+	var stack, segStack []deckTag // open elements at the end of the page / pending segment
+	pageHasContent, segHasContent := false, false
+
+	flush := func() {
+		text := trimBreaks(page.String()) + closing(stack)
+		if pageText := removeEmptyDeckTags(text); strings.TrimSpace(pageText) != "" {
+			pages = append(pages, pageText)
+		}
+		page.Reset()
+		page.WriteString(reopening(stack))
+		pageHasContent = false
+	}
+	takeSegment := func() {
+		page.WriteString(segment.String())
+		stack = append([]deckTag(nil), segStack...)
+		pageHasContent = pageHasContent || segHasContent
+		segment.Reset()
+		segHasContent = false
+	}
+	commit := func() {
+		if !segHasContent && !pageHasContent && len(segStack) == len(stack) {
+			// Drop whitespace and breaks at the start of a page
+			segment.Reset()
+			return
+		}
+		if pageHasContent && page.Len()+segment.Len()+len(closing(segStack)) > maxBytes {
+			flush()
+		}
+		takeSegment()
 	}
 
-	// Pattern: title in bold at start
-	boldTitle := "<b>" + title + "</b>"
-	if after, ok := strings.CutPrefix(content, boldTitle); ok {
-		content = after
+	for _, token := range reToken.FindAllString(content, -1) {
+		switch {
+		case strings.HasPrefix(token, "<") && len(token) > 1:
+			segment.WriteString(token)
+			m := reTagName.FindStringSubmatch(token)
+			switch {
+			case m == nil || strings.HasSuffix(token, "/>"):
+				// Void element such as <br/> or <img .../>
+				if strings.HasPrefix(token, "<img") {
+					segHasContent = true
+				}
+				if strings.HasPrefix(token, "<br") && !inAtomic(segStack) {
+					commit()
+				}
+			case strings.HasPrefix(token, "</"):
+				name := strings.ToLower(m[1])
+				for i := len(segStack) - 1; i >= 0; i-- {
+					if segStack[i].name == name {
+						segStack = append([]deckTag(nil), segStack[:i]...)
+						break
+					}
+				}
+			default:
+				segStack = append(segStack, deckTag{name: strings.ToLower(m[1]), open: token})
+			}
+		case strings.TrimSpace(token) == "":
+			segment.WriteString(token)
+			if !inAtomic(segStack) {
+				commit()
+			} else if page.Len()+segment.Len()+len(closing(segStack)) > maxBytes {
+				// An atomic run does not fit: move it to a fresh page, or split it if it
+				// is larger than a page on its own
+				if pageHasContent {
+					flush()
+				} else {
+					takeSegment()
+					flush()
+				}
+			}
+		default:
+			segment.WriteString(token)
+			segHasContent = true
+		}
+	}
+	commit()
+	if pageHasContent {
+		flush()
 	}
 
-	// Pattern: breaks then title
-	content = strings.TrimPrefix(content, "<br/>")
-	content = strings.TrimPrefix(content, "<br/>")
-	if after, ok := strings.CutPrefix(content, title); ok {
-		content = after
+	if len(pages) == 0 {
+		return []string{""}
 	}
-	if after, ok := strings.CutPrefix(content, boldTitle); ok {
-		content = after
+	return pages
+}
+
+// trimBreaks removes whitespace and <br/> tags from both ends of s
+func trimBreaks(s string) string {
+	for {
+		trimmed := strings.TrimSpace(s)
+		trimmed = strings.TrimPrefix(trimmed, "<br/>")
+		trimmed = strings.TrimSuffix(trimmed, "<br/>")
+		if trimmed == s {
+			return s
+		}
+		s = trimmed
 	}
+}
 
-	// Clean up leading breaks again
-	for strings.HasPrefix(content, "<br/>") {
-		content = strings.TrimPrefix(content, "<br/>")
+// removeEmptyDeckTags drops element pairs left empty by a page split
+func removeEmptyDeckTags(s string) string {
+	reEmpty := regexp.MustCompile(`<(b|i|u|big|small|em|strong|fieldset|td|tr|table|p|li|ul)(\s[^>]*)?>(\s|<br/>)*</(b|i|u|big|small|em|strong|fieldset|td|tr|table|p|li|ul)>`)
+	for {
+		result := reEmpty.ReplaceAllStringFunc(s, func(m string) string {
+			sub := reEmpty.FindStringSubmatch(m)
+			if sub[1] != sub[4] {
+				return m
+			}
+			return ""
+		})
+		if result == s {
+			return s
+		}
+		s = result
 	}
+}
+
+// stripLeadingTitle removes the article title from the beginning of content
+// since it's already displayed in the card title. The title is only removed as a line
+// of its own, possibly in <b> or <big>, so a lead sentence starting with it stays.
+func stripLeadingTitle(content string, title string) string {
+	content = trimLeadingBreaks(content)
 
+	line, rest, _ := strings.Cut(content, "<br/>")
+	if strings.EqualFold(normalizeTitleLine(line), normalizeTitleLine(escapeWML(title))) {
+		content = trimLeadingBreaks(rest)
+	}
 	return content
 }
 
+// trimLeadingBreaks removes whitespace and <br/> tags from the beginning of content
+func trimLeadingBreaks(content string) string {
+	for {
+		trimmed := strings.TrimPrefix(strings.TrimLeft(content, " \t\n"), "<br/>")
+		if trimmed == content {
+			return content
+		}
+		content = trimmed
+	}
+}
+
+// normalizeTitleLine returns the text of a line of WML content for comparison with a
+// title: without formatting tags and escaping, and with whitespace collapsed
+func normalizeTitleLine(line string) string {
+	reFormatting := regexp.MustCompile(`(?i)</?(?:b|big|i|u|strong|em)>`)
+	line = reFormatting.ReplaceAllString(line, "")
+	line = html.UnescapeString(strings.ReplaceAll(line, "$$", "$"))
+	line = strings.ReplaceAll(line, "_", " ")
+	return strings.Join(strings.Fields(line), " ")
+}
+
 // FormatTitle formats a title for display in WML
 func FormatTitle(title string) string {
 	// Truncate long titles
@@ -1074,6 +3021,29 @@ func FormatTitle(title string) string {
 	return escapeWML(title)
 }
 
+// mergeFormattingRuns joins adjacent runs of the same WML formatting element, keeping the
+// whitespace between them ("<b>a</b> <b>b</b>" becomes "<b>a b</b>"), and drops empty ones
+func mergeFormattingRuns(content string) string {
+	reAdjacent := regexp.MustCompile(`</(b|i|u|big|small)>(\s*)<(b|i|u|big|small)>`)
+	reEmpty := regexp.MustCompile(`<(b|i|u|big|small)>(\s*)</(b|i|u|big|small)>`)
+	for {
+		result := content
+		for _, re := range []*regexp.Regexp{reAdjacent, reEmpty} {
+			result = re.ReplaceAllStringFunc(result, func(m string) string {
+				sub := re.FindStringSubmatch(m)
+				if sub[1] != sub[3] {
+					return m
+				}
+				return sub[2]
+			})
+		}
+		if result == content {
+			return content
+		}
+		content = result
+	}
+}
+
 // removeNestedFormattingTags removes nested WML formatting tags
 // WML does not support nested formatting like <i><i>text</i></i>
 func removeNestedFormattingTags(content string) string {
@@ -1104,7 +3074,54 @@ func removeNestedFormattingTags(content string) string {
 		}
 	}
 
-	return content
+	// Each tag is now balanced on its own, but different tags may still overlap
+	return fixInterleavedFormatting(content)
+}
+
+// fixInterleavedFormatting rewrites overlapping WML formatting elements into properly
+// nested ones by closing and reopening the inner elements where an outer one ends, so
+// "<b>foo<i>bar</b>baz</i>" becomes "<b>foo<i>bar</i></b><i>baz</i>". Closing tags
+// without an open element are dropped and elements left open are closed at the end.
+func fixInterleavedFormatting(content string) string {
+	reTag := regexp.MustCompile(`<(/?)(b|i|u|big|small)>`)
+	if !reTag.MatchString(content) {
+		return content
+	}
+
+	var result strings.Builder
+	var open []string // names of the open elements, innermost last
+	last := 0
+	for _, m := range reTag.FindAllStringSubmatchIndex(content, -1) {
+		result.WriteString(content[last:m[0]])
+		last = m[1]
+		name := content[m[4]:m[5]]
+
+		if m[3] == m[2] { // opening tag
+			open = append(open, name)
+			result.WriteString("<" + name + ">")
+			continue
+		}
+
+		pos := slices.Index(open, name)
+		if pos < 0 {
+			continue
+		}
+		inner := open[pos+1:]
+		for i := len(inner) - 1; i >= 0; i-- {
+			result.WriteString("</" + inner[i] + ">")
+		}
+		result.WriteString("</" + name + ">")
+		for _, tag := range inner {
+			result.WriteString("<" + tag + ">")
+		}
+		open = append(open[:pos], inner...)
+	}
+	result.WriteString(content[last:])
+
+	for i := len(open) - 1; i >= 0; i-- {
+		result.WriteString("</" + open[i] + ">")
+	}
+	return result.String()
 }
 
 // removeOneNestedOpen removes one nested opening tag
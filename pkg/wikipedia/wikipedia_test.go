@@ -0,0 +1,396 @@
+package wikipedia
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestArticleIsEmpty(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"no content", "", true},
+		{"whitespace", " \n\t ", true},
+		{"breaks", "<br/><br/>\n<br/>", true},
+		{"formatting without text", "<b></b><i> </i><br/>", true},
+		{"non-breaking space", "&#160;<br/>", true},
+		{"text", "Paris is the capital of France.", false},
+		{"formatted text", "<br/><b>Paris</b><br/>", false},
+		{"link", `<a href="/article?id=4">Paris</a>`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			article := &Article{Title: "Paris", Content: tt.content}
+			if got := article.IsEmpty(); got != tt.want {
+				t.Errorf("IsEmpty() of %q = %v, want %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLToWMLWithOptionsEmpty(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+	}{
+		{"empty", ""},
+		{"whitespace", "  \n\t\r\n  "},
+		{"tags only", "<html><body><div><p></p><span> </span></div></body></html>"},
+		{"title only", `<h1 id="firstHeading">Paris</h1>`},
+		{"empty table", "<h1>Paris</h1><table><tr><td></td><td> </td></tr></table>"},
+		{"breaks", "<h1>Paris</h1><br><br/><br />"},
+		{"scripts and styles", "<h1>Paris</h1><script>var x = 1;</script><style>p { color: red; }</style>"},
+	}
+	modes := []struct {
+		name string
+		opts RenderOptions
+	}{
+		{"wml", RenderOptions{SupportsTables: true, SupportsImages: true}},
+		{"xhtml", RenderOptions{Mode: RenderXHTMLMP, SupportsTables: true, SupportsImages: true}},
+		{"text", RenderOptions{Mode: RenderPlainText}},
+	}
+	for _, tt := range tests {
+		for _, mode := range modes {
+			t.Run(tt.name+"/"+mode.name, func(t *testing.T) {
+				content := HTMLToWMLWithOptions(tt.html, mode.opts)
+				if strings.TrimSpace(wmlToPlainText(content)) != "" {
+					t.Errorf("HTMLToWMLWithOptions(%q) = %q, want no text", tt.html, content)
+				}
+				if article := (&Article{Content: content}); !article.IsEmpty() {
+					t.Errorf("article converted from %q is not empty: %q", tt.html, content)
+				}
+			})
+		}
+	}
+}
+
+func TestHTMLToWMLWithOptionsText(t *testing.T) {
+	html := "<h1>Paris</h1><p>Paris is the capital of <b>France</b>.</p>"
+	content := HTMLToWMLWithOptions(html, RenderOptions{SupportsTables: true})
+	if !strings.Contains(content, "Paris is the capital of <b>France</b>.") {
+		t.Errorf("HTMLToWMLWithOptions(%q) = %q, want the paragraph", html, content)
+	}
+	if (&Article{Content: content}).IsEmpty() {
+		t.Errorf("article converted from %q is empty", html)
+	}
+}
+
+func TestStripLeadingTitle(t *testing.T) {
+	tests := []struct {
+		name    string
+		title   string
+		content string
+		want    string
+	}{
+		{"plain", "Paris", "Paris<br/>Paris is the capital of France.", "Paris is the capital of France."},
+		{"bold", "Paris", "<br/><br/><b>Paris</b><br/><br/>Paris is the capital of France.", "Paris is the capital of France."},
+		{"big", "Paris", "<big>Paris</big><br/>Text", "Text"},
+		{"other case", "Paris", "PARIS<br/>Text", "Text"},
+		{"ampersand", "AT&T", "<b>AT&amp;T</b><br/>AT&amp;T is a company.", "AT&amp;T is a company."},
+		{"ampersand as character reference", "AT&T", "AT&#38;T<br/>Text", "Text"},
+		{"ampersands and spaces", "Marks & Spencer", "<b>Marks  &amp;\nSpencer</b><br/>Text", "Text"},
+		{"accents", "Zürich", "<b>Zürich</b><br/>Zürich is a city.", "Zürich is a city."},
+		{"accents as character references", "Zürich", "Z&#252;rich<br/>Text", "Text"},
+		{"accented capitals", "Île-de-France", "ÎLE-DE-FRANCE<br/>Text", "Text"},
+		{"dollar", "$5 note", "$$5 note<br/>Text", "Text"},
+		{"underscores", "Mercury_(planet)", "Mercury (planet)<br/>Text", "Text"},
+		{"lead sentence", "Paris", "Paris is the capital of France.<br/>More", "Paris is the capital of France.<br/>More"},
+		{"title with more", "AT&T", "AT&amp;T Inc.<br/>Text", "AT&amp;T Inc.<br/>Text"},
+		{"accents differ", "Zürich", "Zurich<br/>Text", "Zurich<br/>Text"},
+		{"unescaped ampersand differs", "AT&T", "AT&amp;amp;T<br/>Text", "AT&amp;amp;T<br/>Text"},
+		{"title only", "Paris", "<b>Paris</b>", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripLeadingTitle(tt.content, tt.title); got != tt.want {
+				t.Errorf("stripLeadingTitle(%q, %q) = %q, want %q", tt.content, tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTitleLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"Paris", "Paris"},
+		{"<b>AT&amp;T</b>", "AT&T"},
+		{"<B><I>Marks &amp; Spencer</I></B>", "Marks & Spencer"},
+		{"AT&#38;T &#x26; more", "AT&T & more"},
+		{"<big>Zürich</big>", "Zürich"},
+		{"Z&#252;rich &amp; Gen&egrave;ve", "Zürich & Genève"},
+		{"  São\tPaulo \n", "São Paulo"},
+		{"Mercury_(planet)", "Mercury (planet)"},
+		{"$$5 &lt;note&gt;", "$5 <note>"},
+	}
+	for _, tt := range tests {
+		if got := normalizeTitleLine(tt.line); got != tt.want {
+			t.Errorf("normalizeTitleLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+// openTestWikipedia writes a ZIM file with writeTestZIM and opens it without a search index
+func openTestWikipedia(t *testing.T, zim testZIM) (*Wikipedia, []testEntry) {
+	t.Helper()
+	path, entries := writeTestZIM(t, zim)
+	w, err := NewWikipedia(path)
+	if err != nil {
+		t.Fatalf("NewWikipedia() error = %v", err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w, entries
+}
+
+func TestFindImageID(t *testing.T) {
+	image := func(namespace byte, url string) testEntry {
+		return testEntry{namespace: namespace, url: url, mimeType: 1, content: []byte("image " + url)}
+	}
+	w, entries := openTestWikipedia(t, testZIM{entries: []testEntry{
+		image('I', "Eiffel_Tower_(1889).jpg"),
+		image('-', "Café+Crème.png"),
+		image('I', "50%_mark.png"),
+		image('C', "Zürich/Grossmünster.jpg"),
+	}})
+
+	tests := []struct {
+		path      string
+		namespace byte
+		want      string
+	}{
+		{"Eiffel_Tower_(1889).jpg", 'I', "Eiffel_Tower_(1889).jpg"},
+		{"Eiffel_Tower_%281889%29.jpg", 'I', "Eiffel_Tower_(1889).jpg"},
+		{"Eiffel%20Tower%20(1889).jpg", 'I', "Eiffel_Tower_(1889).jpg"},
+		{"Caf%C3%A9+Cr%C3%A8me.png", '-', "Café+Crème.png"},
+		{"Caf%C3%A9%2BCr%C3%A8me.png", '-', "Café+Crème.png"},
+		{"50%25_mark.png", 'I', "50%_mark.png"},
+		{"50%_mark.png", 'I', "50%_mark.png"},
+		{"Z%C3%BCrich/Grossm%C3%BCnster.jpg", 'C', "Zürich/Grossmünster.jpg"},
+	}
+	for _, tt := range tests {
+		want := entryIndex(t, entries, tt.namespace, tt.want)
+		if idx, err := w.FindImageID(tt.path); err != nil || idx != want {
+			t.Errorf("FindImageID(%q) = %d, %v, want %d (%c/%s)", tt.path, idx, err, want, tt.namespace, tt.want)
+		}
+		content, mimeType, err := w.GetImage(tt.path)
+		if err != nil || string(content) != "image "+tt.want || mimeType != "image/png" {
+			t.Errorf("GetImage(%q) = %q, %q, %v, want the image", tt.path, content, mimeType, err)
+		}
+	}
+
+	for _, path := range []string{"", "Missing.png", "Caf%C3%A9%20Cr%C3%A8me.png", "Eiffel_Tower_%2"} {
+		if idx, err := w.FindImageID(path); err == nil {
+			t.Errorf("FindImageID(%q) = %d, want an error", path, idx)
+		}
+	}
+
+	// Only the configured namespaces are searched
+	SetImageNamespaces("I")
+	t.Cleanup(func() { SetImageNamespaces(DefaultImageNamespaces) })
+	if idx, err := w.FindImageID("Caf%C3%A9+Cr%C3%A8me.png"); err == nil {
+		t.Errorf("FindImageID() outside the image namespaces = %d, want an error", idx)
+	}
+}
+
+func TestMergeFormattingRuns(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"adjacent", "<b>foo</b><b>bar</b>", "<b>foobar</b>"},
+		{"space between", "<b>foo</b> <b>bar</b>", "<b>foo bar</b>"},
+		{"whitespace between", "<i>foo</i>\n\t<i>bar</i>", "<i>foo\n\tbar</i>"},
+		{"several runs", "<u>a</u><u>b</u> <u>c</u>", "<u>ab c</u>"},
+		{"every element", "<big>a</big><big>b</big><small>c</small><small>d</small>", "<big>ab</big><small>cd</small>"},
+		{"different elements", "<b>foo</b><i>bar</i>", "<b>foo</b><i>bar</i>"},
+		{"text between", "<b>foo</b>, <b>bar</b>", "<b>foo</b>, <b>bar</b>"},
+		{"break between", "<b>foo</b><br/><b>bar</b>", "<b>foo</b><br/><b>bar</b>"},
+		{"empty", "foo<b></b>bar", "foobar"},
+		{"whitespace only", "foo<i> </i>bar", "foo bar"},
+		{"mismatched empty", "<b> </i>", "<b> </i>"},
+		{"empty between runs", "<b>foo</b><i></i><b>bar</b>", "<b>foobar</b>"},
+		{"nested runs", "<b><i>foo</i><i>bar</i></b>", "<b><i>foobar</i></b>"},
+		{"no formatting", "foo bar", "foo bar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeFormattingRuns(tt.content); got != tt.want {
+				t.Errorf("mergeFormattingRuns(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+// wellNestedFormatting reports whether every WML formatting element in content is closed,
+// in the order opposite to opening
+func wellNestedFormatting(content string) bool {
+	var open []string
+	for _, m := range regexp.MustCompile(`<(/?)(b|i|u|big|small)>`).FindAllStringSubmatch(content, -1) {
+		if m[1] == "" {
+			open = append(open, m[2])
+			continue
+		}
+		if len(open) == 0 || open[len(open)-1] != m[2] {
+			return false
+		}
+		open = open[:len(open)-1]
+	}
+	return len(open) == 0
+}
+
+func TestFixInterleavedFormatting(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"interleaved", "<b>foo<i>bar</b>baz</i>", "<b>foo<i>bar</i></b><i>baz</i>"},
+		{"three elements", "<b>a<i>b<u>c</b>d</i>e</u>", "<b>a<i>b<u>c</u></i></b><i><u>d</u></i><u>e</u>"},
+		{"nested", "<b>foo<i>bar</i>baz</b>", "<b>foo<i>bar</i>baz</b>"},
+		{"across a break", "<b>foo<br/>bar</b>", "<b>foo<br/>bar</b>"},
+		{"interleaved across a break", "<b>foo<i>bar<br/>baz</b>qux</i>", "<b>foo<i>bar<br/>baz</i></b><i>qux</i>"},
+		{"closed after a break", "<i>foo<b>bar</i><br/>baz</b>", "<i>foo<b>bar</b></i><b><br/>baz</b>"},
+		{"stray closing tag", "</i>foo<b>bar</b>", "foo<b>bar</b>"},
+		{"left open", "<b>foo<i>bar", "<b>foo<i>bar</i></b>"},
+		{"no formatting", "foo<br/>bar", "foo<br/>bar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fixInterleavedFormatting(tt.content)
+			if got != tt.want {
+				t.Errorf("fixInterleavedFormatting(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+			if !wellNestedFormatting(got) {
+				t.Errorf("fixInterleavedFormatting(%q) = %q is not well nested", tt.content, got)
+			}
+		})
+	}
+}
+
+func TestHTMLToWMLInterleavedFormatting(t *testing.T) {
+	tests := []struct {
+		html string
+		want string
+	}{
+		{"<h1>Paris</h1><p><b>foo<i>bar</b>baz</i></p>", "<b>foo<i>bar</i></b><i>baz</i><br/>"},
+		{"<h1>Paris</h1><p><strong>foo<br>bar</strong> end</p>", "<b>foo<br/>bar</b> end<br/>"},
+		{"<h1>Paris</h1><p><b>foo<em>bar<br>baz</b>qux</em></p>", "<b>foo<i>bar<br/>baz</i></b><i>qux</i><br/>"},
+	}
+	for _, tt := range tests {
+		got := HTMLToWMLWithOptions(tt.html, RenderOptions{})
+		if got != tt.want {
+			t.Errorf("HTMLToWMLWithOptions(%q) = %q, want %q", tt.html, got, tt.want)
+		}
+		if !wellNestedFormatting(got) {
+			t.Errorf("HTMLToWMLWithOptions(%q) = %q is not well nested", tt.html, got)
+		}
+	}
+}
+
+// readFixture returns the content of a file in testdata
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// TestHTMLToWMLFixtures converts article HTML written the way Kiwix ZIM files store it
+func TestHTMLToWMLFixtures(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []string // in the WML and the plain text
+		notWant []string // in neither
+	}{
+		{
+			fixture: "edit_sections.html",
+			want: []string{
+				"<b>Toponymy</b>", "<b>Prehistory</b>", "<b>Roman London</b>",
+				"attested already in the first century AD.",
+				// Only the markup goes, text that happens to say edit stays
+				"The editors of the <i>London Gazette</i> [edit] this text, which mentions the word edit on purpose.",
+			},
+			notWant: []string{"Toponymy[edit]", "History[edit]", "[edit]<br/>", "edit source", "|", "Edit section", "action=edit"},
+		},
+		{
+			fixture: "coordinates.html",
+			want: []string{
+				"Coordinates: 48.9°N, 2.4°E",
+				"Montsouris Park, south of the Eiffel Tower, is at 48.8°N, 2.3°E in the south",
+				"lies at 34.6°S, 58.4°W.",
+			},
+			notWant: []string{"48°51′24″N", "2°21′08″E", "48.8567°N", "48.8567; 2.3522", "48.8222; 2.3381", "-34.6037", "\ufeff", " / "},
+		},
+		{
+			fixture: "pronunciation_ipa.html",
+			want: []string{
+				"London</b> is the capital and largest city",
+				"Paris</b> is the capital of France.",
+				"Zürich</b> (Swiss German: <i>Züri</i>) is the largest city",
+				"The planet (from Latin <i>Mercurius</i>) keeps its etymology",
+			},
+			notWant: []string{"ˈ", "[paʁi]", "[ˈtsyːrɪç]", "pronunciation:", "German: [", "listen", "ⓘ", "( )", "()", "; )"},
+		},
+		{
+			fixture: "pronunciation_respelling.html",
+			want: []string{
+				"Leicester</b> is a city in the East Midlands",
+				"Worcestershire</b> is a county, and <i>Worcestershire sauce</i> is named after it.",
+			},
+			notWant: []string{"LEST", "WUUS", "ˈ", "( )", "()"},
+		},
+		{
+			fixture: "coordinates_geo_default.html",
+			want: []string{
+				"Coordinates: 48.9°N, 2.3°E",
+				"beside the Seine at 48.9°N, 2.3°E, near the Pont",
+			},
+			notWant: []string{"48°51′29.6″N", "48.8584", "2.2945", "\ufeff", " / "},
+		},
+		{
+			fixture: "coordinates_geo_nondefault.html",
+			want: []string{
+				"Coordinates: 33.9°S, 18.4°E",
+				"Cape Point, at 34.4°S, 18.5°E, is south of the city.",
+			},
+			notWant: []string{"33°55′31″S", "33.92528", "34.35722", "(Cape Point)", "\ufeff", " / "},
+		},
+	}
+	modes := []struct {
+		name string
+		opts RenderOptions
+	}{
+		{"wml", RenderOptions{SupportsTables: true}},
+		{"text", RenderOptions{Mode: RenderPlainText}},
+	}
+	for _, tt := range tests {
+		html := readFixture(t, tt.fixture)
+		for _, mode := range modes {
+			t.Run(tt.fixture+"/"+mode.name, func(t *testing.T) {
+				content := HTMLToWMLWithOptions(html, mode.opts)
+				for _, want := range tt.want {
+					if mode.opts.Mode == RenderPlainText {
+						want = wmlToText(want)
+					}
+					if !strings.Contains(content, want) {
+						t.Errorf("converted %s lacks %q:\n%s", tt.fixture, want, content)
+					}
+				}
+				for _, notWant := range tt.notWant {
+					if strings.Contains(content, notWant) {
+						t.Errorf("converted %s has %q:\n%s", tt.fixture, notWant, content)
+					}
+				}
+			})
+		}
+	}
+}
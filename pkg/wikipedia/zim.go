@@ -1,17 +1,29 @@
 package wikipedia
 
 import (
+	"bufio"
 	"bytes"
+	"compress/bzip2"
 	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"log"
-	"os"
+	"log/slog"
+	"math"
+	neturl "net/url"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/klauspost/compress/zstd"
 	"github.com/ulikunitz/xz"
@@ -30,7 +42,8 @@ var zstdDecoderPool = sync.Pool{
 
 // clusterCacheEntry represents a cached decompressed cluster
 type clusterCacheEntry struct {
-	data []byte
+	data     []byte
+	extended bool // blob offsets are 8 bytes instead of 4
 }
 
 // clusterCache is a simple LRU-like cache for decompressed clusters
@@ -39,6 +52,8 @@ type clusterCache struct {
 	entries map[uint32]*clusterCacheEntry
 	order   []uint32 // LRU order (most recent at end)
 	maxSize int      // max number of entries
+	hits    atomic.Uint64
+	misses  atomic.Uint64
 }
 
 func newClusterCache(maxSize int) *clusterCache {
@@ -49,13 +64,15 @@ func newClusterCache(maxSize int) *clusterCache {
 	}
 }
 
-func (c *clusterCache) get(clusterNum uint32) ([]byte, bool) {
+func (c *clusterCache) get(clusterNum uint32) (*clusterCacheEntry, bool) {
 	c.mu.RLock()
 	entry, ok := c.entries[clusterNum]
 	c.mu.RUnlock()
 	if !ok {
+		c.misses.Add(1)
 		return nil, false
 	}
+	c.hits.Add(1)
 	// Move to end of order (most recently used)
 	c.mu.Lock()
 	for i, num := range c.order {
@@ -66,10 +83,18 @@ func (c *clusterCache) get(clusterNum uint32) ([]byte, bool) {
 		}
 	}
 	c.mu.Unlock()
-	return entry.data, true
+	return entry, true
 }
 
-func (c *clusterCache) put(clusterNum uint32, data []byte) {
+// peek returns a cached cluster without updating the LRU order or hit counters
+func (c *clusterCache) peek(clusterNum uint32) (*clusterCacheEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[clusterNum]
+	return entry, ok
+}
+
+func (c *clusterCache) put(clusterNum uint32, entry *clusterCacheEntry) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -86,13 +111,42 @@ func (c *clusterCache) put(clusterNum uint32, data []byte) {
 		//log.Printf("Evicted cluster %d from cache", oldest)
 	}
 
-	c.entries[clusterNum] = &clusterCacheEntry{data: data}
+	c.entries[clusterNum] = entry
 	c.order = append(c.order, clusterNum)
 }
 
+// ZIMReaderStats reports the size of a ZIM file and how well its cluster cache performs
+type ZIMReaderStats struct {
+	ArticleCount   uint32 // directory entries, including redirects and resources
+	ClusterCount   uint32
+	CachedClusters int
+	CacheCapacity  int
+	CachedBytes    int // decompressed size of the cached clusters
+	CacheHits      uint64
+	CacheMisses    uint64
+}
+
+// HitRatio returns the fraction of cluster reads served from the cache, 0 before any read
+func (s ZIMReaderStats) HitRatio() float64 {
+	if s.CacheHits+s.CacheMisses == 0 {
+		return 0
+	}
+	return float64(s.CacheHits) / float64(s.CacheHits+s.CacheMisses)
+}
+
+// ErrClosed is returned by reads from a ZIMReader, or a Wikipedia, that has been closed
+var ErrClosed = errors.New("ZIM file is closed")
+
+// ErrUnsupportedCompression is returned when a cluster uses a compression type the reader
+// cannot decompress
+var ErrUnsupportedCompression = errors.New("unsupported cluster compression type")
+
 // ZIM file format constants
 const (
-	ZimMagicNumber = 0x44D495A // ZIM magic number (little endian)
+	clusterExtendedFlag = 0x10 // cluster info bit for 8-byte blob offsets (large clusters)
+
+	ZimMagicNumber = 0x44D495A  // ZIM magic number (little endian)
+	NoMainPage     = 0xFFFFFFFF // MainPage header value when no main page is set
 )
 
 // ZIMHeader represents the header of a ZIM file
@@ -114,6 +168,7 @@ type ZIMHeader struct {
 
 // DirectoryEntry represents an entry in the ZIM directory
 type DirectoryEntry struct {
+	Index       uint32 // position in the URL pointer list
 	MimeType    uint16
 	ParamLen    uint8
 	Namespace   byte
@@ -124,47 +179,105 @@ type DirectoryEntry struct {
 	Title       string
 	RedirectIdx uint32
 	IsRedirect  bool
+	Params      []byte // extra parameter data of ParamLen bytes, unused by current ZIM files
 }
 
-// ZIMReader handles reading ZIM files
+// ZIMReader handles reading ZIM files, including split ones. All reads use ReadAt, so it
+// is safe for concurrent use without locking the file.
 type ZIMReader struct {
-	file          *os.File
+	file          zimFile
 	header        ZIMHeader
 	mimeTypes     []string
 	urlPtrs       []uint64
 	titlePtrs     []uint32
 	clusterPtrs   []uint64
-	mu            sync.RWMutex
+	titlePtrsOnce sync.Once // title pointers are loaded lazily, only index-free lookups need them
+	titlePtrsErr  error
 	clusterCache  *clusterCache // LRU cache for decompressed clusters
 	lowMemoryMode bool          // Whether to use low-memory optimizations
+	loadsMu       sync.Mutex
+	loads         map[uint32]*clusterLoad // clusters being read and decompressed
+}
+
+// guardedFile makes reads after Close fail with ErrClosed instead of using the closed
+// file. Close waits for the reads in progress to finish.
+type guardedFile struct {
+	mu     sync.RWMutex
+	file   zimFile
+	closed bool
+}
+
+func (f *guardedFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.closed {
+		return 0, ErrClosed
+	}
+	return f.file.ReadAt(p, off)
+}
+
+// Close closes the file once, later calls do nothing
+func (f *guardedFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	return f.file.Close()
+}
+
+// clusterLoad is a cluster being read and decompressed, done is closed once entry or err is set
+type clusterLoad struct {
+	done  chan struct{}
+	entry *clusterCacheEntry
+	err   error
+}
+
+// Cluster cache sizes, in decompressed clusters, used unless ZIMReaderOptions sets one
+const (
+	DefaultClusterCacheSize   = 50
+	LowMemoryClusterCacheSize = 10 // Much smaller cache for 512MB systems
+)
+
+// ZIMReaderOptions controls the memory use of a ZIMReader
+type ZIMReaderOptions struct {
+	LowMemory        bool // Whether to use low-memory optimizations
+	ClusterCacheSize int  // Decompressed clusters to cache, 0 for the default of the memory mode
 }
 
 // NewZIMReader creates a new ZIM file reader
 func NewZIMReader(filepath string) (*ZIMReader, error) {
-	return NewZIMReaderWithOptions(filepath, true)
+	return NewZIMReaderWithOptions(filepath, ZIMReaderOptions{LowMemory: true})
 }
 
-// NewZIMReaderWithOptions creates a new ZIM file reader with memory optimization options
-func NewZIMReaderWithOptions(filepath string, lowMemoryMode bool) (*ZIMReader, error) {
-	log.Printf("Opening ZIM file: %s (low memory mode: %v)", filepath, lowMemoryMode)
+// NewZIMReaderWithOptions creates a new ZIM file reader with memory optimization options.
+// The first part of a split ZIM file (file.zimaa) opens all its parts.
+func NewZIMReaderWithOptions(filepath string, opts ZIMReaderOptions) (*ZIMReader, error) {
+	lowMemoryMode := opts.LowMemory
+	slog.Info("Opening ZIM file", "path", filepath, "low_memory", lowMemoryMode)
 
-	file, err := os.Open(filepath)
+	file, err := openZIMFile(filepath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open ZIM file: %w", err)
 	}
 
 	// Determine cache size based on available memory
 	// Use smaller cache in low memory mode
-	cacheSize := 50
-	if lowMemoryMode {
-		cacheSize = 10 // Much smaller cache for 512MB systems
+	cacheSize := opts.ClusterCacheSize
+	if cacheSize <= 0 {
+		cacheSize = DefaultClusterCacheSize
+		if lowMemoryMode {
+			cacheSize = LowMemoryClusterCacheSize
+		}
 	}
-	//log.Printf("Cluster cache size: %d entries", cacheSize)
+	slog.Info("Cluster cache size", "path", filepath, "clusters", cacheSize)
 
 	reader := &ZIMReader{
-		file:          file,
+		file:          &guardedFile{file: file},
 		clusterCache:  newClusterCache(cacheSize),
 		lowMemoryMode: lowMemoryMode,
+		loads:         make(map[uint32]*clusterLoad),
 	}
 	if err := reader.readHeader(); err != nil {
 		file.Close()
@@ -188,28 +301,42 @@ func NewZIMReaderWithOptions(filepath string, lowMemoryMode bool) (*ZIMReader, e
 
 	// Force GC after loading pointers to free any temporary allocations
 	if lowMemoryMode {
-		log.Println("Running GC after ZIM initialization")
+		slog.Debug("Running GC after ZIM initialization")
 		runtime.GC()
 	}
 
-	log.Printf("ZIM file loaded: %d articles, %d clusters", reader.header.ArticleCount, reader.header.ClusterCount)
+	slog.Info("ZIM file loaded", "path", filepath, "articles", reader.header.ArticleCount, "clusters", reader.header.ClusterCount)
 	return reader, nil
 }
 
+// Stats returns the reader's counts and cluster cache metrics
+func (z *ZIMReader) Stats() ZIMReaderStats {
+	stats := ZIMReaderStats{
+		ArticleCount:  z.header.ArticleCount,
+		ClusterCount:  z.header.ClusterCount,
+		CacheCapacity: z.clusterCache.maxSize,
+		CacheHits:     z.clusterCache.hits.Load(),
+		CacheMisses:   z.clusterCache.misses.Load(),
+	}
+
+	z.clusterCache.mu.RLock()
+	stats.CachedClusters = len(z.clusterCache.entries)
+	for _, entry := range z.clusterCache.entries {
+		stats.CachedBytes += len(entry.data)
+	}
+	z.clusterCache.mu.RUnlock()
+
+	return stats
+}
+
 // Close closes the ZIM file
 func (z *ZIMReader) Close() error {
 	return z.file.Close()
 }
 
 func (z *ZIMReader) readHeader() error {
-	z.mu.Lock()
-	defer z.mu.Unlock()
-
-	if _, err := z.file.Seek(0, io.SeekStart); err != nil {
-		return err
-	}
-
-	if err := binary.Read(z.file, binary.LittleEndian, &z.header); err != nil {
+	header := io.NewSectionReader(z.file, 0, int64(binary.Size(z.header)))
+	if err := binary.Read(header, binary.LittleEndian, &z.header); err != nil {
 		return fmt.Errorf("failed to read ZIM header: %w", err)
 	}
 
@@ -221,30 +348,18 @@ func (z *ZIMReader) readHeader() error {
 }
 
 func (z *ZIMReader) readMimeTypes() error {
-	z.mu.Lock()
-	defer z.mu.Unlock()
-
-	if _, err := z.file.Seek(int64(z.header.MimeListPos), io.SeekStart); err != nil {
-		return err
-	}
+	r := bufio.NewReader(io.NewSectionReader(z.file, int64(z.header.MimeListPos), math.MaxInt64-int64(z.header.MimeListPos)))
 
 	z.mimeTypes = []string{}
 	for {
-		var buf bytes.Buffer
-		b := make([]byte, 1)
-		for {
-			if _, err := z.file.Read(b); err != nil {
-				return err
-			}
-			if b[0] == 0 {
-				break
-			}
-			buf.WriteByte(b[0])
+		mimeType, err := r.ReadString(0)
+		if err != nil {
+			return err
 		}
-		if buf.Len() == 0 {
+		if mimeType = strings.TrimSuffix(mimeType, "\x00"); mimeType == "" {
 			break
 		}
-		z.mimeTypes = append(z.mimeTypes, buf.String())
+		z.mimeTypes = append(z.mimeTypes, mimeType)
 	}
 
 	return nil
@@ -252,9 +367,6 @@ func (z *ZIMReader) readMimeTypes() error {
 
 // GetMIMEType returns the MIME type string for a given index
 func (z *ZIMReader) GetMIMEType(idx uint16) string {
-	z.mu.Lock()
-	defer z.mu.Unlock()
-
 	if int(idx) < len(z.mimeTypes) {
 		return z.mimeTypes[idx]
 	}
@@ -262,39 +374,29 @@ func (z *ZIMReader) GetMIMEType(idx uint16) string {
 }
 
 func (z *ZIMReader) readURLPointers() error {
-	z.mu.Lock()
-	defer z.mu.Unlock()
-
-	if _, err := z.file.Seek(int64(z.header.URLPtrPos), io.SeekStart); err != nil {
-		return err
-	}
-
-	z.urlPtrs = make([]uint64, z.header.ArticleCount)
-	for i := uint32(0); i < z.header.ArticleCount; i++ {
-		if err := binary.Read(z.file, binary.LittleEndian, &z.urlPtrs[i]); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	var err error
+	z.urlPtrs, err = z.readPointers(z.header.URLPtrPos, z.header.ArticleCount)
+	return err
 }
 
 func (z *ZIMReader) readClusterPointers() error {
-	z.mu.Lock()
-	defer z.mu.Unlock()
+	var err error
+	z.clusterPtrs, err = z.readPointers(z.header.ClusterPtrPos, z.header.ClusterCount)
+	return err
+}
 
-	if _, err := z.file.Seek(int64(z.header.ClusterPtrPos), io.SeekStart); err != nil {
-		return err
+// readPointers reads a list of count 8-byte file offsets starting at pos
+func (z *ZIMReader) readPointers(pos uint64, count uint32) ([]uint64, error) {
+	buf := make([]byte, int(count)*8)
+	if _, err := z.file.ReadAt(buf, int64(pos)); err != nil {
+		return nil, err
 	}
 
-	z.clusterPtrs = make([]uint64, z.header.ClusterCount)
-	for i := uint32(0); i < z.header.ClusterCount; i++ {
-		if err := binary.Read(z.file, binary.LittleEndian, &z.clusterPtrs[i]); err != nil {
-			return err
-		}
+	ptrs := make([]uint64, count)
+	for i := range ptrs {
+		ptrs[i] = binary.LittleEndian.Uint64(buf[i*8:])
 	}
-
-	return nil
+	return ptrs, nil
 }
 
 // GetDirectoryEntry reads a directory entry at the given index
@@ -302,82 +404,113 @@ func (z *ZIMReader) GetDirectoryEntry(idx uint32) (*DirectoryEntry, error) {
 	if idx >= z.header.ArticleCount {
 		return nil, errors.New("index out of range")
 	}
+	ptr := int64(z.urlPtrs[idx])
 
-	z.mu.RLock()
-	ptr := z.urlPtrs[idx]
-	z.mu.RUnlock()
-
-	z.mu.Lock()
-	defer z.mu.Unlock()
-
-	if _, err := z.file.Seek(int64(ptr), io.SeekStart); err != nil {
-		return nil, err
-	}
-
-	entry := &DirectoryEntry{}
+	// Most entries fit in one read; longer URLs and titles are read with a larger buffer
+	for size := directoryEntryReadSize; ; size *= 2 {
+		buf := make([]byte, size)
+		n, err := z.file.ReadAt(buf, ptr)
+		if err != nil && (err != io.EOF || n == 0) {
+			return nil, err
+		}
 
-	if err := binary.Read(z.file, binary.LittleEndian, &entry.MimeType); err != nil {
-		return nil, err
+		entry, complete, err := parseDirectoryEntry(buf[:n], idx)
+		if err != nil || complete {
+			return entry, err
+		}
+		if n < size {
+			return nil, io.ErrUnexpectedEOF
+		}
 	}
+}
 
-	if err := binary.Read(z.file, binary.LittleEndian, &entry.ParamLen); err != nil {
-		return nil, err
-	}
+// directoryEntryReadSize is the initial number of bytes read for a directory entry
+const directoryEntryReadSize = 512
 
-	if err := binary.Read(z.file, binary.LittleEndian, &entry.Namespace); err != nil {
-		return nil, err
+// parseDirectoryEntry decodes a directory entry, reporting incomplete if buf ends
+// before its URL, title and parameter data do. As in the ZIM format specification,
+// the parameter data follows the title.
+func parseDirectoryEntry(buf []byte, idx uint32) (*DirectoryEntry, bool, error) {
+	const fixedSize = 12 // mime type, parameter length, namespace, revision and redirect index or cluster
+	if len(buf) < fixedSize+4 {
+		return nil, false, nil
 	}
 
-	if err := binary.Read(z.file, binary.LittleEndian, &entry.Revision); err != nil {
-		return nil, err
+	entry := &DirectoryEntry{
+		Index:     idx,
+		MimeType:  binary.LittleEndian.Uint16(buf[0:]),
+		ParamLen:  buf[2],
+		Namespace: buf[3],
+		Revision:  binary.LittleEndian.Uint32(buf[4:]),
 	}
 
 	// Check if it's a redirect (mime type = 0xFFFF)
+	pos := fixedSize
 	if entry.MimeType == 0xFFFF {
 		entry.IsRedirect = true
-		if err := binary.Read(z.file, binary.LittleEndian, &entry.RedirectIdx); err != nil {
-			return nil, err
-		}
+		entry.RedirectIdx = binary.LittleEndian.Uint32(buf[8:])
 	} else {
-		if err := binary.Read(z.file, binary.LittleEndian, &entry.ClusterNum); err != nil {
-			return nil, err
-		}
-		if err := binary.Read(z.file, binary.LittleEndian, &entry.BlobNum); err != nil {
-			return nil, err
-		}
+		entry.ClusterNum = binary.LittleEndian.Uint32(buf[8:])
+		entry.BlobNum = binary.LittleEndian.Uint32(buf[12:])
+		pos += 4
 	}
 
-	// Read URL (null-terminated)
-	var urlBuf bytes.Buffer
-	b := make([]byte, 1)
-	for {
-		if _, err := z.file.Read(b); err != nil {
-			return nil, err
-		}
-		if b[0] == 0 {
-			break
-		}
-		urlBuf.WriteByte(b[0])
+	// URL and title are null-terminated
+	urlEnd := bytes.IndexByte(buf[pos:], 0)
+	if urlEnd < 0 {
+		return nil, false, nil
 	}
-	entry.URL = urlBuf.String()
+	entry.URL = string(buf[pos : pos+urlEnd])
+	pos += urlEnd + 1
 
-	// Read Title (null-terminated)
-	var titleBuf bytes.Buffer
-	for {
-		if _, err := z.file.Read(b); err != nil {
-			return nil, err
-		}
-		if b[0] == 0 {
-			break
-		}
-		titleBuf.WriteByte(b[0])
+	titleEnd := bytes.IndexByte(buf[pos:], 0)
+	if titleEnd < 0 {
+		return nil, false, nil
 	}
-	entry.Title = titleBuf.String()
+	entry.Title = string(buf[pos : pos+titleEnd])
 	if entry.Title == "" {
 		entry.Title = entry.URL
 	}
+	pos += titleEnd + 1
 
-	return entry, nil
+	if entry.ParamLen > 0 {
+		if len(buf) < pos+int(entry.ParamLen) {
+			return nil, false, nil
+		}
+		entry.Params = bytes.Clone(buf[pos : pos+int(entry.ParamLen)])
+	}
+
+	return entry, true, nil
+}
+
+// IsContentArticle reports whether a directory entry is a real article: in the article
+// namespace, not a redirect and not a resource file. Random articles, the article
+// listing and the search index all use it, so they agree on what an article is.
+func IsContentArticle(entry *DirectoryEntry) bool {
+	return !entry.IsRedirect && isArticleNamespace(entry.Namespace) && !isResourceURL(entry.URL)
+}
+
+// isArticleNamespace reports whether a namespace holds articles (A in old ZIM files, C in new ones)
+func isArticleNamespace(namespace byte) bool {
+	return namespace == 'A' || namespace == 'C'
+}
+
+// isResourceURL reports whether a URL names a stylesheet, script, image or font rather than an article
+func isResourceURL(url string) bool {
+	url = strings.ToLower(url)
+	return strings.HasSuffix(url, ".css") || strings.HasSuffix(url, ".js") ||
+		strings.HasSuffix(url, ".png") || strings.HasSuffix(url, ".jpg") ||
+		strings.HasSuffix(url, ".jpeg") || strings.HasSuffix(url, ".gif") ||
+		strings.HasSuffix(url, ".svg") || strings.HasSuffix(url, ".ico") ||
+		strings.HasSuffix(url, ".woff") || strings.HasSuffix(url, ".woff2") ||
+		strings.HasSuffix(url, ".ttf") || strings.HasSuffix(url, ".eot") ||
+		strings.Contains(url, "/-/")
+}
+
+// hasHTMLContent reports whether an entry's MIME type is HTML, or unknown
+func (z *ZIMReader) hasHTMLContent(entry *DirectoryEntry) bool {
+	mimeType := z.GetMIMEType(entry.MimeType)
+	return mimeType == "" || strings.Contains(mimeType, "html")
 }
 
 // GetArticleCount returns the number of articles in the ZIM file
@@ -385,62 +518,150 @@ func (z *ZIMReader) GetArticleCount() uint32 {
 	return z.header.ArticleCount
 }
 
+// UUID returns the ZIM file's UUID from its header as 32 hex digits
+func (z *ZIMReader) UUID() string {
+	return hex.EncodeToString(z.header.UUID[:])
+}
+
 // GetMainPageIndex returns the index of the main page
 func (z *ZIMReader) GetMainPageIndex() uint32 {
 	return z.header.MainPage
 }
 
+// Newer ZIM files keep well-known entries in namespace W, redirects to canonical entries
+// such as W/mainPage. Scrapers don't all set the main page in the header as well.
+const (
+	wellKnownNamespace = 'W'
+	wellKnownMainPage  = "mainPage"
+)
+
+// FindWellKnownEntry returns the index of the entry the well-known entry W/name points
+// at, following redirects
+func (z *ZIMReader) FindWellKnownEntry(name string) (uint32, error) {
+	idx, err := z.findURL(wellKnownNamespace, name)
+	if err != nil {
+		return 0, err
+	}
+	return z.canonicalIndex(idx)
+}
+
+// canonicalIndex returns the index of the entry idx is or redirects to
+func (z *ZIMReader) canonicalIndex(idx uint32) (uint32, error) {
+	entry, err := z.GetDirectoryEntry(idx)
+	if err != nil {
+		return 0, err
+	}
+	entry, err = z.resolveRedirect(entry)
+	if err != nil {
+		return 0, err
+	}
+	return entry.Index, nil
+}
+
 // GetBlob reads a blob from a cluster
 func (z *ZIMReader) GetBlob(clusterNum, blobNum uint32) ([]byte, error) {
+	return z.getBlob(context.Background(), clusterNum, blobNum)
+}
+
+// getBlob reads a blob from a cluster, not waiting for a cluster to be read once ctx is done
+func (z *ZIMReader) getBlob(ctx context.Context, clusterNum, blobNum uint32) ([]byte, error) {
 	if clusterNum >= z.header.ClusterCount {
 		return nil, errors.New("cluster index out of range")
 	}
 
 	// Check cluster cache first
-	if cachedData, ok := z.clusterCache.get(clusterNum); ok {
+	if cached, ok := z.clusterCache.get(clusterNum); ok {
 		//log.Printf("Cluster %d cache hit", clusterNum)
-		return z.extractBlobFromCluster(cachedData, blobNum)
+		return z.extractBlobFromCluster(cached.data, blobNum, cached.extended)
 	}
 
-	z.mu.RLock()
-	clusterPtr := z.clusterPtrs[clusterNum]
-	var nextClusterPtr uint64
-	if clusterNum+1 < z.header.ClusterCount {
-		nextClusterPtr = z.clusterPtrs[clusterNum+1]
-	} else {
-		nextClusterPtr = z.header.ChecksumPos
+	cluster, err := z.loadCluster(ctx, clusterNum)
+	if err != nil {
+		return nil, err
 	}
-	z.mu.RUnlock()
 
-	z.mu.Lock()
-	defer z.mu.Unlock()
+	// Extract the requested blob
+	return z.extractBlobFromCluster(cluster.data, blobNum, cluster.extended)
+}
 
-	if _, err := z.file.Seek(int64(clusterPtr), io.SeekStart); err != nil {
+// loadCluster reads and decompresses a cluster into the cache. Concurrent requests for the
+// same cluster wait for the first one instead of decompressing it again. A decompression
+// can't be interrupted, but once ctx is done no new one starts and waiting for one stops.
+func (z *ZIMReader) loadCluster(ctx context.Context, clusterNum uint32) (*clusterCacheEntry, error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	// Read cluster info byte
-	clusterInfo := make([]byte, 1)
-	if _, err := z.file.Read(clusterInfo); err != nil {
-		return nil, err
+	z.loadsMu.Lock()
+	if load, ok := z.loads[clusterNum]; ok {
+		z.loadsMu.Unlock()
+		select {
+		case <-load.done:
+			return load.entry, load.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	// A load may have finished between the cache miss and taking loadsMu
+	if cached, ok := z.clusterCache.peek(clusterNum); ok {
+		z.loadsMu.Unlock()
+		return cached, nil
+	}
+	load := &clusterLoad{done: make(chan struct{})}
+	z.loads[clusterNum] = load
+	z.loadsMu.Unlock()
+
+	start := time.Now()
+	load.entry, load.err = z.readCluster(clusterNum)
+	if load.err == nil {
+		// Cache the decompressed cluster
+		z.clusterCache.put(clusterNum, load.entry)
+		slog.Debug("Cluster cache miss", "cluster", clusterNum, "bytes", len(load.entry.data), "duration", time.Since(start))
+	} else {
+		slog.Warn("Failed to read cluster", "cluster", clusterNum, "error", load.err)
 	}
 
-	compression := clusterInfo[0] & 0x0F
+	z.loadsMu.Lock()
+	delete(z.loads, clusterNum)
+	z.loadsMu.Unlock()
+	close(load.done)
 
-	clusterSize := int64(nextClusterPtr - clusterPtr - 1)
-	//log.Printf("Reading cluster %d: compression=%d, size=%d bytes", clusterNum, compression, clusterSize)
+	return load.entry, load.err
+}
 
-	compressedData := make([]byte, clusterSize)
-	if _, err := io.ReadFull(z.file, compressedData); err != nil {
+// readCluster reads a cluster from the file and decompresses it
+func (z *ZIMReader) readCluster(clusterNum uint32) (*clusterCacheEntry, error) {
+	clusterPtr := z.clusterPtrs[clusterNum]
+	var nextClusterPtr uint64
+	if clusterNum+1 < z.header.ClusterCount {
+		nextClusterPtr = z.clusterPtrs[clusterNum+1]
+	} else {
+		nextClusterPtr = z.header.ChecksumPos
+	}
+
+	clusterInfo, compressedData, err := z.readClusterData(clusterPtr, nextClusterPtr)
+	if err != nil {
 		return nil, err
 	}
 
+	compression := clusterInfo & 0x0F
+	extended := clusterInfo&clusterExtendedFlag != 0
+
 	var clusterData []byte
-	var err error
 
 	switch compression {
 	case 0, 1: // uncompressed
 		clusterData = compressedData
+	case 2: // zlib; older writers also produced gzip streams
+		clusterData, err = decompressZlibFamily(compressedData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress zlib cluster: %w", err)
+		}
+	case 3: // bzip2
+		clusterData, err = io.ReadAll(bzip2.NewReader(bytes.NewReader(compressedData)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress bzip2 cluster: %w", err)
+		}
 	case 4: // zlib/deflate
 		reader := flate.NewReader(bytes.NewReader(compressedData))
 		clusterData, err = io.ReadAll(reader)
@@ -468,36 +689,93 @@ func (z *ZIMReader) GetBlob(clusterNum, blobNum uint32) ([]byte, error) {
 			return nil, err
 		}
 	default:
-		return nil, fmt.Errorf("unsupported compression type: %d", compression)
+		return nil, fmt.Errorf("%w %d in cluster %d (info byte 0x%02x)", ErrUnsupportedCompression, compression, clusterNum, clusterInfo)
 	}
 
-	// Release compressed data immediately
-	compressedData = nil
+	return &clusterCacheEntry{data: clusterData, extended: extended}, nil
+}
 
-	// Cache the decompressed cluster
-	z.clusterCache.put(clusterNum, clusterData)
-	//log.Printf("Cached cluster %d: %d bytes decompressed", clusterNum, len(clusterData))
+// decompressZlibFamily decompresses a gzip, zlib or raw deflate stream, telling them
+// apart by their header bytes
+func decompressZlibFamily(data []byte) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	switch {
+	case len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b:
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+	case len(data) >= 2 && data[0]&0x0f == 8 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0:
+		reader, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		reader = flate.NewReader(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
 
-	// Extract the requested blob
-	return z.extractBlobFromCluster(clusterData, blobNum)
+// readClusterData reads the info byte and compressed data of the cluster between two offsets
+func (z *ZIMReader) readClusterData(clusterPtr, nextClusterPtr uint64) (byte, []byte, error) {
+	if nextClusterPtr <= clusterPtr {
+		return 0, nil, fmt.Errorf("invalid cluster offsets %d-%d", clusterPtr, nextClusterPtr)
+	}
+
+	// Cluster info byte followed by the compressed data
+	data := make([]byte, nextClusterPtr-clusterPtr)
+	if _, err := z.file.ReadAt(data, int64(clusterPtr)); err != nil {
+		return 0, nil, err
+	}
+	//log.Printf("Reading cluster at %d: size=%d bytes", clusterPtr, len(data)-1)
+
+	return data[0], data[1:], nil
+}
+
+// maxRedirectChain bounds how many redirects resolveRedirect follows
+const maxRedirectChain = 10
+
+// resolveRedirect follows a redirect entry to the entry it finally points at. Cycles and
+// overly long chains in malformed ZIM files are reported as errors.
+func (z *ZIMReader) resolveRedirect(entry *DirectoryEntry) (*DirectoryEntry, error) {
+	start := entry.Index
+	visited := make(map[uint32]bool)
+	for entry.IsRedirect {
+		if visited[entry.Index] {
+			return nil, fmt.Errorf("redirect loop from entry %d at entry %d", start, entry.Index)
+		}
+		if len(visited) >= maxRedirectChain {
+			return nil, fmt.Errorf("redirect chain from entry %d is too long", start)
+		}
+		visited[entry.Index] = true
+
+		next, err := z.GetDirectoryEntry(entry.RedirectIdx)
+		if err != nil {
+			return nil, err
+		}
+		entry = next
+	}
+	return entry, nil
 }
 
 // GetArticleContent retrieves the content of an article by its index
 func (z *ZIMReader) GetArticleContent(idx uint32) ([]byte, string, error) {
+	return z.getArticleContent(context.Background(), idx)
+}
+
+// getArticleContent is GetArticleContent, giving up on reading the cluster once ctx is done
+func (z *ZIMReader) getArticleContent(ctx context.Context, idx uint32) ([]byte, string, error) {
 	entry, err := z.GetDirectoryEntry(idx)
 	if err != nil {
 		return nil, "", err
 	}
 
 	// Follow redirects
-	for entry.IsRedirect {
-		entry, err = z.GetDirectoryEntry(entry.RedirectIdx)
-		if err != nil {
-			return nil, "", err
-		}
+	entry, err = z.resolveRedirect(entry)
+	if err != nil {
+		return nil, "", err
 	}
 
-	content, err := z.GetBlob(entry.ClusterNum, entry.BlobNum)
+	content, err := z.getBlob(ctx, entry.ClusterNum, entry.BlobNum)
 	if err != nil {
 		return nil, "", err
 	}
@@ -507,11 +785,63 @@ func (z *ZIMReader) GetArticleContent(idx uint32) ([]byte, string, error) {
 		mimeType = z.mimeTypes[entry.MimeType]
 	}
 
+	// A blob cut short by a bad offset table would otherwise be rendered silently truncated
+	if strings.Contains(mimeType, "html") && !looksCompleteHTML(content) {
+		slog.Warn("Article content looks truncated", "entry", entry.Index, "url", entry.URL, "bytes", len(content))
+	}
+
 	return content, mimeType, nil
 }
 
-// FindArticleByURL finds an article by its URL
+// looksCompleteHTML reports whether an HTML document ends with its closing body or html tag
+func looksCompleteHTML(content []byte) bool {
+	tail := content
+	if len(tail) > 512 {
+		tail = tail[len(tail)-512:]
+	}
+	tail = bytes.ToLower(tail)
+	return bytes.Contains(tail, []byte("</html>")) || bytes.Contains(tail, []byte("</body>"))
+}
+
+// FindArticleByURL finds an article by its URL. Links write the same URL with spaces or
+// underscores and percent-encoded or not, so without an exact match the decoded URL and
+// the space and underscore forms of both are tried.
 func (z *ZIMReader) FindArticleByURL(namespace byte, url string) (uint32, error) {
+	var err error
+	for _, variant := range urlVariants(url) {
+		var idx uint32
+		if idx, err = z.findURL(namespace, variant); err == nil {
+			return idx, nil
+		}
+	}
+	return 0, err
+}
+
+// urlVariants returns url followed by its percent-decoded form and the forms of both with
+// underscores for spaces and spaces for underscores, without duplicates
+func urlVariants(url string) []string {
+	bases := []string{url}
+	if decoded, err := neturl.PathUnescape(url); err == nil && decoded != url {
+		bases = append(bases, decoded)
+	}
+
+	variants := make([]string, 0, 3*len(bases))
+	for _, base := range bases {
+		for _, variant := range []string{
+			base,
+			strings.ReplaceAll(base, " ", "_"),
+			strings.ReplaceAll(base, "_", " "),
+		} {
+			if !slices.Contains(variants, variant) {
+				variants = append(variants, variant)
+			}
+		}
+	}
+	return variants
+}
+
+// findURL finds the entry with exactly the given namespace and URL
+func (z *ZIMReader) findURL(namespace byte, url string) (uint32, error) {
 	// Binary search through URL pointers
 	left := uint32(0)
 	right := z.header.ArticleCount - 1
@@ -539,6 +869,170 @@ func (z *ZIMReader) FindArticleByURL(namespace byte, url string) (uint32, error)
 	return 0, errors.New("article not found")
 }
 
+// GetMetadata returns a metadata value stored in the M namespace, e.g. "Title" or "Language"
+func (z *ZIMReader) GetMetadata(key string) (string, error) {
+	idx, err := z.FindArticleByURL('M', key)
+	if err != nil {
+		return "", fmt.Errorf("metadata %q not found", key)
+	}
+	content, _, err := z.GetArticleContent(idx)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// readTitlePointers loads the title pointer list (directory entry indices sorted by namespace and title)
+func (z *ZIMReader) readTitlePointers() error {
+	z.titlePtrsOnce.Do(func() {
+		buf := make([]byte, int(z.header.ArticleCount)*4)
+		if _, err := z.file.ReadAt(buf, int64(z.header.TitlePtrPos)); err != nil {
+			z.titlePtrsErr = fmt.Errorf("failed to read title pointers: %w", err)
+			return
+		}
+
+		z.titlePtrs = make([]uint32, z.header.ArticleCount)
+		for i := range z.titlePtrs {
+			z.titlePtrs[i] = binary.LittleEndian.Uint32(buf[i*4:])
+		}
+		slog.Info("Loaded title pointers", "count", len(z.titlePtrs))
+	})
+	return z.titlePtrsErr
+}
+
+// findTitlePosition returns the position in the title pointer list of the first entry
+// sorting at or after the given namespace and title
+func (z *ZIMReader) findTitlePosition(namespace byte, title string) (uint32, error) {
+	left := uint32(0)
+	right := uint32(len(z.titlePtrs))
+
+	for left < right {
+		mid := left + (right-left)/2
+		entry, err := z.GetDirectoryEntry(z.titlePtrs[mid])
+		if err != nil {
+			return 0, err
+		}
+		if compareNamespaceURL(entry.Namespace, entry.Title, namespace, title) < 0 {
+			left = mid + 1
+		} else {
+			right = mid
+		}
+	}
+
+	return left, nil
+}
+
+// FindArticleByTitle finds an entry by its exact title using the title pointer list
+func (z *ZIMReader) FindArticleByTitle(namespace byte, title string) (uint32, error) {
+	if err := z.readTitlePointers(); err != nil {
+		return 0, err
+	}
+
+	pos, err := z.findTitlePosition(namespace, title)
+	if err != nil {
+		return 0, err
+	}
+	if pos < uint32(len(z.titlePtrs)) {
+		entry, err := z.GetDirectoryEntry(z.titlePtrs[pos])
+		if err != nil {
+			return 0, err
+		}
+		if entry.Namespace == namespace && entry.Title == title {
+			return entry.Index, nil
+		}
+	}
+	return 0, errors.New("article not found")
+}
+
+// nearbyTitleScan is the number of titles on each side of where a title would sort that
+// FindArticleByTitleFold compares
+const nearbyTitleScan = 4
+
+// FindArticleByTitleFold finds an entry whose title matches title ignoring case, among
+// the titles sorting next to it and next to its form with an upper case first letter,
+// which is how Wikipedia titles are written
+func (z *ZIMReader) FindArticleByTitleFold(namespace byte, title string) (uint32, error) {
+	if err := z.readTitlePointers(); err != nil {
+		return 0, err
+	}
+
+	starts := []string{title}
+	if first, size := utf8.DecodeRuneInString(title); first != utf8.RuneError {
+		if upper := string(unicode.ToUpper(first)) + title[size:]; upper != title {
+			starts = append(starts, upper)
+		}
+	}
+
+	for _, start := range starts {
+		pos, err := z.findTitlePosition(namespace, start)
+		if err != nil {
+			return 0, err
+		}
+		from := uint32(0)
+		if pos > nearbyTitleScan {
+			from = pos - nearbyTitleScan
+		}
+		for i := from; i < pos+nearbyTitleScan && i < uint32(len(z.titlePtrs)); i++ {
+			entry, err := z.GetDirectoryEntry(z.titlePtrs[i])
+			if err != nil {
+				return 0, err
+			}
+			if entry.Namespace == namespace && strings.EqualFold(entry.Title, title) {
+				return entry.Index, nil
+			}
+		}
+	}
+	return 0, errors.New("article not found")
+}
+
+// ListByTitlePrefix returns up to limit directory entries in the namespace whose title
+// starts with prefix, in title order
+func (z *ZIMReader) ListByTitlePrefix(namespace byte, prefix string, limit int) ([]*DirectoryEntry, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	var entries []*DirectoryEntry
+	err := z.scanTitles(namespace, prefix, prefix, func(entry *DirectoryEntry) bool {
+		entries = append(entries, entry)
+		return len(entries) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// scanTitles calls fn for each entry in the namespace whose title starts with prefix, in
+// title order, beginning at the first title at or after from, until fn returns false
+func (z *ZIMReader) scanTitles(namespace byte, prefix, from string, fn func(*DirectoryEntry) bool) error {
+	if err := z.readTitlePointers(); err != nil {
+		return err
+	}
+	if from < prefix {
+		from = prefix
+	}
+
+	pos, err := z.findTitlePosition(namespace, from)
+	if err != nil {
+		return err
+	}
+
+	for ; pos < uint32(len(z.titlePtrs)); pos++ {
+		entry, err := z.GetDirectoryEntry(z.titlePtrs[pos])
+		if err != nil {
+			return err
+		}
+		if entry.Namespace != namespace || !strings.HasPrefix(entry.Title, prefix) {
+			break
+		}
+		if !fn(entry) {
+			break
+		}
+	}
+	return nil
+}
+
 func compareNamespaceURL(ns1 byte, url1 string, ns2 byte, url2 string) int {
 	if ns1 < ns2 {
 		return -1
@@ -554,7 +1048,7 @@ func (z *ZIMReader) decompressZstdPooled(compressedData []byte) ([]byte, error)
 	decoderInterface := zstdDecoderPool.Get()
 	if decoderInterface == nil {
 		// Fallback: create new decoder
-		log.Println("Warning: failed to get pooled zstd decoder, creating new one")
+		slog.Warn("Failed to get pooled zstd decoder, creating a new one")
 		decoder, err := zstd.NewReader(bytes.NewReader(compressedData), zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create zstd reader: %w", err)
@@ -578,43 +1072,42 @@ func (z *ZIMReader) decompressZstdPooled(compressedData []byte) ([]byte, error)
 	return data, nil
 }
 
-// extractBlobFromCluster extracts a specific blob from decompressed cluster data
-func (z *ZIMReader) extractBlobFromCluster(clusterData []byte, blobNum uint32) ([]byte, error) {
-	if len(clusterData) < 4 {
-		return nil, errors.New("cluster data too small")
+// extractBlobFromCluster extracts a specific blob from decompressed cluster data.
+// Extended clusters, used for large content, store 8-byte blob offsets.
+func (z *ZIMReader) extractBlobFromCluster(clusterData []byte, blobNum uint32, extended bool) ([]byte, error) {
+	offsetSize := uint64(4)
+	if extended {
+		offsetSize = 8
 	}
-
-	// Parse blob offsets (4 bytes each)
-	offsetReader := bytes.NewReader(clusterData)
-
-	// Read first offset to determine number of blobs
-	var firstOffset uint32
-	if err := binary.Read(offsetReader, binary.LittleEndian, &firstOffset); err != nil {
-		return nil, err
+	readOffset := func(i uint64) uint64 {
+		if extended {
+			return binary.LittleEndian.Uint64(clusterData[i*8:])
+		}
+		return uint64(binary.LittleEndian.Uint32(clusterData[i*4:]))
 	}
 
-	numBlobs := firstOffset / 4
-	if blobNum >= numBlobs {
-		return nil, fmt.Errorf("blob index %d out of range (max %d)", blobNum, numBlobs-1)
+	dataLen := uint64(len(clusterData))
+	if dataLen < offsetSize {
+		return nil, errors.New("cluster data too small")
 	}
 
-	offsets := make([]uint32, numBlobs+1)
-	offsets[0] = firstOffset
-
-	for i := uint32(1); i <= numBlobs; i++ {
-		if i == numBlobs {
-			offsets[i] = uint32(len(clusterData))
-		} else {
-			if err := binary.Read(offsetReader, binary.LittleEndian, &offsets[i]); err != nil {
-				return nil, err
-			}
-		}
+	// The first offset points just past the offset table, which determines the number of blobs
+	firstOffset := readOffset(0)
+	numBlobs := firstOffset / offsetSize
+	if firstOffset > dataLen {
+		return nil, errors.New("blob offset table out of range")
+	}
+	if uint64(blobNum) >= numBlobs {
+		return nil, fmt.Errorf("blob index %d out of range (max %d)", blobNum, int64(numBlobs)-1)
 	}
 
-	blobStart := offsets[blobNum]
-	blobEnd := offsets[blobNum+1]
+	blobStart := readOffset(uint64(blobNum))
+	blobEnd := dataLen
+	if uint64(blobNum)+1 < numBlobs {
+		blobEnd = readOffset(uint64(blobNum) + 1)
+	}
 
-	if blobStart > uint32(len(clusterData)) || blobEnd > uint32(len(clusterData)) {
+	if blobStart > dataLen || blobEnd > dataLen || blobStart > blobEnd {
 		return nil, errors.New("blob offset out of range")
 	}
 
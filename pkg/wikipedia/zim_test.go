@@ -0,0 +1,756 @@
+package wikipedia
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// testMIMETypes are the MIME types of the ZIM files writeTestZIM writes
+var testMIMETypes = []string{"text/html", "image/png", "text/plain"}
+
+// testEntry is a directory entry writeTestZIM writes. Entries with a redirect point at the
+// entry with that namespace and URL ("A/Paris"), the others hold content in a cluster.
+type testEntry struct {
+	namespace byte
+	url       string
+	title     string
+	mimeType  uint16
+	content   []byte
+	redirect  string
+	params    []byte
+	cluster   int // cluster of the content, see testZIM.clusters
+}
+
+// testCluster is how writeTestZIM compresses a cluster
+type testCluster struct {
+	info     byte                            // info byte, compression type and extended flag
+	compress func(testing.TB, []byte) []byte // compresses the cluster data, nil to store it as is
+}
+
+// testZIM describes a ZIM file for writeTestZIM
+type testZIM struct {
+	entries  []testEntry
+	clusters []testCluster // clusters holding the entries' content, one uncompressed if nil
+}
+
+// writeTestZIM writes a ZIM file in a temporary directory and returns its path and the
+// entries in URL order, their positions being their directory indices
+func writeTestZIM(tb testing.TB, zim testZIM) (string, []testEntry) {
+	tb.Helper()
+
+	entries := append([]testEntry(nil), zim.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return compareNamespaceURL(entries[i].namespace, entries[i].url, entries[j].namespace, entries[j].url) < 0
+	})
+	index := make(map[string]uint32)
+	for i, entry := range entries {
+		index[string(entry.namespace)+"/"+entry.url] = uint32(i)
+	}
+	clusters := zim.clusters
+	if len(clusters) == 0 {
+		clusters = []testCluster{{info: 1}}
+	}
+
+	var buf bytes.Buffer
+	header := ZIMHeader{
+		MagicNumber:  ZimMagicNumber,
+		MajorVersion: 6,
+		UUID:         [16]byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef},
+		ArticleCount: uint32(len(entries)),
+		ClusterCount: uint32(len(clusters)),
+		MainPage:     NoMainPage,
+		LayoutPage:   NoMainPage,
+	}
+	buf.Write(make([]byte, binary.Size(header)))
+
+	header.MimeListPos = uint64(buf.Len())
+	for _, mimeType := range testMIMETypes {
+		buf.WriteString(mimeType + "\x00")
+	}
+	buf.WriteByte(0)
+
+	// Blobs are numbered in the order of the entries in each cluster
+	blobs := make([][][]byte, len(clusters))
+	blobNums := make([]uint32, len(entries))
+	for i, entry := range entries {
+		if entry.redirect != "" {
+			continue
+		}
+		if entry.cluster >= len(clusters) {
+			tb.Fatalf("entry %s is in cluster %d of %d", entry.url, entry.cluster, len(clusters))
+		}
+		blobNums[i] = uint32(len(blobs[entry.cluster]))
+		blobs[entry.cluster] = append(blobs[entry.cluster], entry.content)
+	}
+
+	dirents := make([]uint64, len(entries))
+	for i, entry := range entries {
+		dirents[i] = uint64(buf.Len())
+		target, ok := index[entry.redirect]
+		if entry.redirect != "" && !ok {
+			tb.Fatalf("entry %s redirects to %s, which is not an entry", entry.url, entry.redirect)
+		}
+		buf.Write(testDirent(entry, target, blobNums[i]))
+	}
+
+	header.URLPtrPos = uint64(buf.Len())
+	for _, ptr := range dirents {
+		binary.Write(&buf, binary.LittleEndian, ptr)
+	}
+
+	titleOrder := make([]uint32, len(entries))
+	for i := range titleOrder {
+		titleOrder[i] = uint32(i)
+	}
+	title := func(entry testEntry) string {
+		if entry.title == "" {
+			return entry.url
+		}
+		return entry.title
+	}
+	sort.SliceStable(titleOrder, func(i, j int) bool {
+		a, b := entries[titleOrder[i]], entries[titleOrder[j]]
+		return compareNamespaceURL(a.namespace, title(a), b.namespace, title(b)) < 0
+	})
+	header.TitlePtrPos = uint64(buf.Len())
+	binary.Write(&buf, binary.LittleEndian, titleOrder)
+
+	clusterPtrs := make([]uint64, len(clusters))
+	var clusterData bytes.Buffer
+	for i, cluster := range clusters {
+		data := testClusterData(blobs[i], cluster.info&clusterExtendedFlag != 0)
+		if cluster.compress != nil {
+			data = cluster.compress(tb, data)
+		}
+		clusterPtrs[i] = uint64(clusterData.Len())
+		clusterData.WriteByte(cluster.info)
+		clusterData.Write(data)
+	}
+	header.ClusterPtrPos = uint64(buf.Len())
+	clustersPos := header.ClusterPtrPos + uint64(8*len(clusters))
+	for _, ptr := range clusterPtrs {
+		binary.Write(&buf, binary.LittleEndian, clustersPos+ptr)
+	}
+	buf.Write(clusterData.Bytes())
+
+	header.ChecksumPos = uint64(buf.Len())
+	buf.Write(make([]byte, 16))
+
+	out := buf.Bytes()
+	var headerBuf bytes.Buffer
+	binary.Write(&headerBuf, binary.LittleEndian, header)
+	copy(out, headerBuf.Bytes())
+
+	path := filepath.Join(tb.TempDir(), "test.zim")
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return path, entries
+}
+
+// testClusterData returns the uncompressed data of a cluster holding blobs: the blob
+// offset table followed by the blobs
+func testClusterData(blobs [][]byte, extended bool) []byte {
+	var buf bytes.Buffer
+	offsetSize := 4
+	if extended {
+		offsetSize = 8
+	}
+	offset := offsetSize * (len(blobs) + 1)
+	for i := 0; i <= len(blobs); i++ {
+		if extended {
+			binary.Write(&buf, binary.LittleEndian, uint64(offset))
+		} else {
+			binary.Write(&buf, binary.LittleEndian, uint32(offset))
+		}
+		if i < len(blobs) {
+			offset += len(blobs[i])
+		}
+	}
+	for _, blob := range blobs {
+		buf.Write(blob)
+	}
+	return buf.Bytes()
+}
+
+// testDirent returns the directory entry of entry, redirecting to redirectIdx or with
+// its content in blob blobNum of its cluster
+func testDirent(entry testEntry, redirectIdx, blobNum uint32) []byte {
+	var buf bytes.Buffer
+	mimeType := entry.mimeType
+	if entry.redirect != "" {
+		mimeType = 0xFFFF
+	}
+	binary.Write(&buf, binary.LittleEndian, mimeType)
+	buf.WriteByte(byte(len(entry.params)))
+	buf.WriteByte(entry.namespace)
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // revision
+	if entry.redirect != "" {
+		binary.Write(&buf, binary.LittleEndian, redirectIdx)
+	} else {
+		binary.Write(&buf, binary.LittleEndian, uint32(entry.cluster))
+		binary.Write(&buf, binary.LittleEndian, blobNum)
+	}
+	buf.WriteString(entry.url + "\x00" + entry.title + "\x00")
+	buf.Write(entry.params)
+	return buf.Bytes()
+}
+
+// openTestZIM writes a ZIM file with writeTestZIM and opens it
+func openTestZIM(tb testing.TB, zim testZIM) (*ZIMReader, []testEntry) {
+	tb.Helper()
+	path, entries := writeTestZIM(tb, zim)
+	reader, err := NewZIMReaderWithOptions(path, ZIMReaderOptions{})
+	if err != nil {
+		tb.Fatalf("NewZIMReaderWithOptions() error = %v", err)
+	}
+	tb.Cleanup(func() { reader.Close() })
+	return reader, entries
+}
+
+// testArticle returns an HTML article entry in cluster 0
+func testArticle(url, body string) testEntry {
+	return testEntry{
+		namespace: 'A',
+		url:       url,
+		title:     url,
+		content:   []byte("<html><head><title>" + url + "</title></head><body><h1>" + url + "</h1>" + body + "</body></html>"),
+	}
+}
+
+// testRedirect returns an entry redirecting to the article entry with URL target
+func testRedirect(url, target string) testEntry {
+	return testEntry{namespace: 'A', url: url, title: url, redirect: "A/" + target}
+}
+
+// entryIndex returns the directory index of the entry with namespace ns and the URL
+func entryIndex(tb testing.TB, entries []testEntry, ns byte, url string) uint32 {
+	tb.Helper()
+	for i, entry := range entries {
+		if entry.namespace == ns && entry.url == url {
+			return uint32(i)
+		}
+	}
+	tb.Fatalf("no entry %c/%s", ns, url)
+	return 0
+}
+
+func compressGzip(tb testing.TB, data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func compressZlib(tb testing.TB, data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func compressFlate(tb testing.TB, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func compressXZ(tb testing.TB, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := xz.NewWriter(&buf)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func compressZstd(tb testing.TB, data []byte) []byte {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer encoder.Close()
+	return encoder.EncodeAll(data, nil)
+}
+
+// compressBzip2 returns testdata/cluster.bz2, as Go has no bzip2 compressor. It is the
+// cluster of compressionTestBlobs, made with bzip2(1).
+func compressBzip2(tb testing.TB, data []byte) []byte {
+	compressed, err := os.ReadFile(filepath.Join("testdata", "cluster.bz2"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	decompressed, err := io.ReadAll(bzip2.NewReader(bytes.NewReader(compressed)))
+	if err != nil || !bytes.Equal(decompressed, data) {
+		tb.Fatalf("testdata/cluster.bz2 is not the cluster of compressionTestBlobs (error %v)", err)
+	}
+	return compressed
+}
+
+// compressionTestBlobs are the blobs of the clusters of TestReadClusterCompression
+var compressionTestBlobs = []testEntry{
+	testArticle("Compressed", "<p>Clusters of every compression type hold this article.</p>"),
+	{namespace: 'I', url: "pixel.png", mimeType: 1, content: []byte("\x89PNG\r\n\x1a\n not really an image")},
+}
+
+func TestReadClusterCompression(t *testing.T) {
+	tests := []struct {
+		name    string
+		cluster testCluster
+	}{
+		{"uncompressed 0", testCluster{info: 0}},
+		{"uncompressed 1", testCluster{info: 1}},
+		{"extended", testCluster{info: 1 | clusterExtendedFlag}},
+		{"gzip", testCluster{info: 2, compress: compressGzip}},
+		{"zlib", testCluster{info: 2, compress: compressZlib}},
+		{"raw deflate", testCluster{info: 2, compress: compressFlate}},
+		{"bzip2", testCluster{info: 3, compress: compressBzip2}},
+		{"deflate", testCluster{info: 4, compress: compressFlate}},
+		{"xz", testCluster{info: 5, compress: compressXZ}},
+		{"zstd labelled xz", testCluster{info: 5, compress: compressZstd}},
+		{"zstd", testCluster{info: 6, compress: compressZstd}},
+		{"extended zstd", testCluster{info: 6 | clusterExtendedFlag, compress: compressZstd}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, entries := openTestZIM(t, testZIM{
+				entries:  compressionTestBlobs,
+				clusters: []testCluster{tt.cluster},
+			})
+
+			for i, want := range entries {
+				entry, err := reader.GetDirectoryEntry(uint32(i))
+				if err != nil {
+					t.Fatalf("GetDirectoryEntry(%d) error = %v", i, err)
+				}
+				blob, err := reader.GetBlob(entry.ClusterNum, entry.BlobNum)
+				if err != nil {
+					t.Fatalf("GetBlob(%d, %d) error = %v", entry.ClusterNum, entry.BlobNum, err)
+				}
+				if !bytes.Equal(blob, want.content) {
+					t.Errorf("GetBlob(%d, %d) = %q, want %q", entry.ClusterNum, entry.BlobNum, blob, want.content)
+				}
+			}
+
+			idx := entryIndex(t, entries, 'A', "Compressed")
+			content, mimeType, err := reader.GetArticleContent(idx)
+			if err != nil {
+				t.Fatalf("GetArticleContent(%d) error = %v", idx, err)
+			}
+			if !bytes.Equal(content, entries[idx].content) || mimeType != "text/html" {
+				t.Errorf("GetArticleContent(%d) = %q, %q, want %q, text/html", idx, content, mimeType, entries[idx].content)
+			}
+		})
+	}
+}
+
+func TestReadClusterUnsupportedCompression(t *testing.T) {
+	reader, entries := openTestZIM(t, testZIM{
+		entries:  compressionTestBlobs,
+		clusters: []testCluster{{info: 7}},
+	})
+
+	_, _, err := reader.GetArticleContent(entryIndex(t, entries, 'A', "Compressed"))
+	if !errors.Is(err, ErrUnsupportedCompression) {
+		t.Fatalf("GetArticleContent() error = %v, want ErrUnsupportedCompression", err)
+	}
+	if want := "unsupported cluster compression type 7 in cluster 0 (info byte 0x07)"; err.Error() != want {
+		t.Errorf("GetArticleContent() error = %q, want %q", err, want)
+	}
+}
+
+func TestGetArticleContentRedirects(t *testing.T) {
+	entries := []testEntry{
+		testArticle("Paris", "<p>Paris is the capital of France.</p>"),
+		testRedirect("Self", "Self"),
+		testRedirect("Ping", "Pong"),
+		testRedirect("Pong", "Ping"),
+		testRedirect("Into loop", "Ping"),
+	}
+	// A chain of maxRedirectChain redirects still resolves, one more is too long
+	for i := range maxRedirectChain + 1 {
+		target := "Paris"
+		if i > 0 {
+			target = fmt.Sprintf("Chain %02d", i-1)
+		}
+		entries = append(entries, testRedirect(fmt.Sprintf("Chain %02d", i), target))
+	}
+	reader, entries := openTestZIM(t, testZIM{entries: entries})
+
+	tests := []struct {
+		url     string
+		wantErr string
+	}{
+		{"Chain 00", ""},
+		{fmt.Sprintf("Chain %02d", maxRedirectChain-1), ""},
+		{"Self", "redirect loop"},
+		{"Ping", "redirect loop"},
+		{"Into loop", "redirect loop"},
+		{fmt.Sprintf("Chain %02d", maxRedirectChain), "too long"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			idx := entryIndex(t, entries, 'A', tt.url)
+
+			// A loop that is not detected would hang the test, fail it instead
+			type result struct {
+				content []byte
+				err     error
+			}
+			done := make(chan result, 1)
+			go func() {
+				content, _, err := reader.GetArticleContent(idx)
+				done <- result{content, err}
+			}()
+			var got result
+			select {
+			case got = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("GetArticleContent(%d) did not return", idx)
+			}
+
+			if tt.wantErr == "" {
+				if got.err != nil {
+					t.Fatalf("GetArticleContent(%d) error = %v", idx, got.err)
+				}
+				if want := entries[entryIndex(t, entries, 'A', "Paris")].content; !bytes.Equal(got.content, want) {
+					t.Errorf("GetArticleContent(%d) = %q, want %q", idx, got.content, want)
+				}
+				return
+			}
+			if got.err == nil || !strings.Contains(got.err.Error(), tt.wantErr) {
+				t.Fatalf("GetArticleContent(%d) error = %v, want one containing %q", idx, got.err, tt.wantErr)
+			}
+			if _, err := reader.canonicalIndex(idx); err == nil {
+				t.Errorf("canonicalIndex(%d) error = nil, want one", idx)
+			}
+		})
+	}
+}
+
+func TestParseDirectoryEntry(t *testing.T) {
+	params := []byte{0x00, 0x01, 0x02, 'x', 0x00, 0xff}
+	tests := []struct {
+		name      string
+		entry     testEntry
+		wantTitle string
+	}{
+		{"article", testEntry{namespace: 'A', url: "Paris", title: "Paris", cluster: 2}, "Paris"},
+		{"parameters", testEntry{namespace: 'C', url: "Mercury_(planet)", title: "Mercury (planet)", cluster: 2, params: params}, "Mercury (planet)"},
+		{"parameters without title", testEntry{namespace: 'C', url: "Zürich", cluster: 2, params: params}, "Zürich"},
+		{"redirect with parameters", testEntry{namespace: 'A', url: "NYC", title: "NYC", redirect: "A/New York City", params: params}, "NYC"},
+		{"parameter length 255", testEntry{namespace: 'A', url: "Long", title: "Long", cluster: 2, params: bytes.Repeat([]byte{'p'}, 255)}, "Long"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := testDirent(tt.entry, 42, 3)
+			// Bytes of the next entry follow in the file
+			entry, complete, err := parseDirectoryEntry(append(buf, "\x00\x00\x00A\x00\x00\x00\x00Next"...), 5)
+			if err != nil || !complete {
+				t.Fatalf("parseDirectoryEntry() = %v, %v, want a complete entry", complete, err)
+			}
+
+			if entry.Index != 5 || entry.Namespace != tt.entry.namespace {
+				t.Errorf("parseDirectoryEntry() index, namespace = %d, %c, want 5, %c", entry.Index, entry.Namespace, tt.entry.namespace)
+			}
+			if entry.URL != tt.entry.url || entry.Title != tt.wantTitle {
+				t.Errorf("parseDirectoryEntry() URL, title = %q, %q, want %q, %q", entry.URL, entry.Title, tt.entry.url, tt.wantTitle)
+			}
+			if int(entry.ParamLen) != len(tt.entry.params) || !bytes.Equal(entry.Params, tt.entry.params) {
+				t.Errorf("parseDirectoryEntry() params = %d %q, want %d %q", entry.ParamLen, entry.Params, len(tt.entry.params), tt.entry.params)
+			}
+			if tt.entry.redirect != "" {
+				if !entry.IsRedirect || entry.RedirectIdx != 42 {
+					t.Errorf("parseDirectoryEntry() redirect = %v to %d, want a redirect to 42", entry.IsRedirect, entry.RedirectIdx)
+				}
+			} else if entry.IsRedirect || entry.ClusterNum != 2 || entry.BlobNum != 3 {
+				t.Errorf("parseDirectoryEntry() redirect, cluster, blob = %v, %d, %d, want false, 2, 3", entry.IsRedirect, entry.ClusterNum, entry.BlobNum)
+			}
+
+			// Entries cut short anywhere, the parameter data included, are incomplete
+			for n := range len(buf) {
+				if entry, complete, err := parseDirectoryEntry(buf[:n], 5); complete || entry != nil || err != nil {
+					t.Fatalf("parseDirectoryEntry() of %d of %d bytes = %v, %v, %v, want incomplete", n, len(buf), entry, complete, err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetDirectoryEntryParams(t *testing.T) {
+	paris := testArticle("Paris", "<p>Paris is the capital of France.</p>")
+	paris.params = []byte("param\x00data")
+	france := testArticle("France", "<p>France is a country.</p>")
+	france.params = bytes.Repeat([]byte{0xff}, 200)
+	reader, entries := openTestZIM(t, testZIM{entries: []testEntry{paris, france, testArticle("Zürich", "<p>A city.</p>")}})
+
+	for i, want := range entries {
+		entry, err := reader.GetDirectoryEntry(uint32(i))
+		if err != nil {
+			t.Fatalf("GetDirectoryEntry(%d) error = %v", i, err)
+		}
+		if entry.URL != want.url || entry.Title != want.title || !bytes.Equal(entry.Params, want.params) {
+			t.Errorf("GetDirectoryEntry(%d) = %q, %q, %q, want %q, %q, %q", i, entry.URL, entry.Title, entry.Params, want.url, want.title, want.params)
+		}
+		content, _, err := reader.GetArticleContent(uint32(i))
+		if err != nil || !bytes.Equal(content, want.content) {
+			t.Errorf("GetArticleContent(%d) = %q, %v, want %q", i, content, err, want.content)
+		}
+	}
+
+	idx, err := reader.FindArticleByURL('A', "Zürich")
+	if err != nil || idx != entryIndex(t, entries, 'A', "Zürich") {
+		t.Errorf("FindArticleByURL(Zürich) = %d, %v, want the entry after those with parameters", idx, err)
+	}
+}
+
+func TestLooksCompleteHTML(t *testing.T) {
+	long := strings.Repeat("<p>Lorem ipsum dolor sit amet.</p>", 100)
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"complete", "<html><body><p>Paris</p></body></html>", true},
+		{"no closing html", "<html><body><p>Paris</p></body>", true},
+		{"upper case", "<HTML><BODY><P>Paris</P></BODY></HTML>", true},
+		{"trailing newline", "<html><body><p>Paris</p></body></html>\n", true},
+		{"long", "<html><body>" + long + "</body></html>", true},
+		{"cut short", "<html><body><p>Paris is the cap", false},
+		{"long cut short", "<html><body>" + long, false},
+		{"closing tag early in a long article", "<html><body></body></html>" + long, false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksCompleteHTML([]byte(tt.content)); got != tt.want {
+				t.Errorf("looksCompleteHTML() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// captureLogs sends the messages of slog's default logger to the returned buffer for the
+// rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	t.Cleanup(func() { slog.SetDefault(logger) })
+	return &buf
+}
+
+func TestGetArticleContentTruncated(t *testing.T) {
+	long := testArticle("Long", strings.Repeat("<p>Lorem ipsum dolor sit amet.</p>", 100))
+	truncated := testArticle("Truncated", strings.Repeat("<p>Lorem ipsum dolor sit amet.</p>", 100))
+	truncated.content = truncated.content[:len(truncated.content)-100]
+	text := testEntry{namespace: 'M', url: "Description", mimeType: 2, content: []byte("A test wiki")}
+	// The entries are blobs of one cluster, as in real ZIM files
+	reader, entries := openTestZIM(t, testZIM{
+		entries:  []testEntry{testArticle("Paris", "<p>Paris is the capital of France.</p>"), long, truncated, text},
+		clusters: []testCluster{{info: 6, compress: compressZstd}},
+	})
+
+	tests := []struct {
+		ns       byte
+		url      string
+		wantWarn bool
+	}{
+		{'A', "Paris", false},
+		{'A', "Long", false},
+		{'A', "Truncated", true},
+		{'M', "Description", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			logs := captureLogs(t)
+			idx := entryIndex(t, entries, tt.ns, tt.url)
+			content, _, err := reader.GetArticleContent(idx)
+			if err != nil {
+				t.Fatalf("GetArticleContent(%d) error = %v", idx, err)
+			}
+			// Content that looks truncated is still returned, as it is
+			if !bytes.Equal(content, entries[idx].content) {
+				t.Errorf("GetArticleContent(%d) = %d bytes, want %d", idx, len(content), len(entries[idx].content))
+			}
+
+			warned := strings.Contains(logs.String(), "Article content looks truncated")
+			if warned != tt.wantWarn {
+				t.Errorf("GetArticleContent(%d) warned = %v, want %v, logs: %s", idx, warned, tt.wantWarn, logs)
+			}
+			if warned && !strings.Contains(logs.String(), "url=Truncated") {
+				t.Errorf("warning does not name the article: %s", logs)
+			}
+		})
+	}
+}
+
+// BenchmarkGetBlobParallel reads blobs of many zstd clusters from parallel goroutines, like
+// concurrent requests do. With a cache of one cluster nearly every read decompresses one.
+func BenchmarkGetBlobParallel(b *testing.B) {
+	const clusterCount, blobsPerCluster = 64, 8
+	var entries []testEntry
+	clusters := make([]testCluster, clusterCount)
+	for c := range clusters {
+		clusters[c] = testCluster{info: 6, compress: compressZstd}
+		for i := range blobsPerCluster {
+			entry := testArticle(fmt.Sprintf("Article %02d-%d", c, i), strings.Repeat(fmt.Sprintf("<p>Paragraph of article %d in cluster %d.</p>", i, c), 200))
+			entry.cluster = c
+			entries = append(entries, entry)
+		}
+	}
+	path, _ := writeTestZIM(b, testZIM{entries: entries, clusters: clusters})
+
+	for _, bb := range []struct {
+		name      string
+		cacheSize int
+	}{
+		{"cached", clusterCount},
+		{"uncached", 1},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			reader, err := NewZIMReaderWithOptions(path, ZIMReaderOptions{ClusterCacheSize: bb.cacheSize})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer reader.Close()
+
+			var next atomic.Uint32
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				// Each goroutine starts at another cluster and steps through the blobs
+				n := next.Add(7919)
+				for pb.Next() {
+					n++
+					if _, err := reader.GetBlob(n%clusterCount, n/clusterCount%blobsPerCluster); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestURLVariants(t *testing.T) {
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"Paris", []string{"Paris"}},
+		{"New York City", []string{"New York City", "New_York_City"}},
+		{"New_York_City", []string{"New_York_City", "New York City"}},
+		{"Mercury_(planet)", []string{"Mercury_(planet)", "Mercury (planet)"}},
+		{"Mercury_%28planet%29", []string{"Mercury_%28planet%29", "Mercury %28planet%29", "Mercury_(planet)", "Mercury (planet)"}},
+		{"Mercury%20%28planet%29", []string{"Mercury%20%28planet%29", "Mercury (planet)", "Mercury_(planet)"}},
+		{"Z%C3%BCrich", []string{"Z%C3%BCrich", "Zürich"}},
+		{"Mixed_case and_spaces", []string{"Mixed_case and_spaces", "Mixed_case_and_spaces", "Mixed case and spaces"}},
+		{"100%_pure", []string{"100%_pure", "100% pure"}},
+	}
+	for _, tt := range tests {
+		if got := urlVariants(tt.url); !slices.Equal(got, tt.want) {
+			t.Errorf("urlVariants(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestFindArticleByURLVariants(t *testing.T) {
+	reader, entries := openTestZIM(t, testZIM{entries: []testEntry{
+		testArticle("Mercury_(planet)", "<p>Mercury is a planet.</p>"),
+		testArticle("New York City", "<p>New York City is a city.</p>"),
+		testArticle("Zürich", "<p>Zürich is a city.</p>"),
+		testArticle("100%_pure", "<p>A phrase.</p>"),
+	}})
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"Mercury_(planet)", "Mercury_(planet)"},
+		{"Mercury (planet)", "Mercury_(planet)"},
+		{"Mercury_%28planet%29", "Mercury_(planet)"},
+		{"Mercury%20%28planet%29", "Mercury_(planet)"},
+		{"New_York_City", "New York City"},
+		{"New%20York%20City", "New York City"},
+		{"New%20York_City", "New York City"},
+		{"Z%C3%BCrich", "Zürich"},
+		{"100%_pure", "100%_pure"},
+		{"100% pure", "100%_pure"},
+	}
+	for _, tt := range tests {
+		idx, err := reader.FindArticleByURL('A', tt.url)
+		if want := entryIndex(t, entries, 'A', tt.want); err != nil || idx != want {
+			t.Errorf("FindArticleByURL(%q) = %d, %v, want %d (%s)", tt.url, idx, err, want, tt.want)
+		}
+	}
+
+	for _, url := range []string{"Mercury", "mercury_(planet)", "New-York-City", "Zurich"} {
+		if idx, err := reader.FindArticleByURL('A', url); err == nil {
+			t.Errorf("FindArticleByURL(%q) = %d, want an error", url, idx)
+		}
+	}
+}
+
+func TestVerifyZIMProgress(t *testing.T) {
+	path, entries := writeTestZIM(t, testZIM{
+		entries: []testEntry{
+			testArticle("Paris", "<p>Paris</p>"),
+			testArticle("London", "<p>London</p>"),
+			testRedirect("Paname", "Paris"),
+		},
+	})
+
+	var progress []VerifyProgress
+	report, err := VerifyZIM(path, VerifyOptions{Progress: func(p VerifyProgress) {
+		progress = append(progress, p)
+	}})
+	if err != nil {
+		t.Fatalf("VerifyZIM() error = %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("VerifyZIM() problems = %v", report.Problems)
+	}
+	want := []VerifyProgress{
+		{Stage: VerifyEntries, Total: uint32(len(entries))},
+		{Stage: VerifyClusters, Total: report.Clusters},
+	}
+	if !slices.Equal(progress, want) {
+		t.Errorf("VerifyZIM() progress = %v, want %v", progress, want)
+	}
+}